@@ -0,0 +1,165 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var zipMagic = []byte("PK\x03\x04")
+
+// archiveExts are the archive file extensions we look inside of.
+var archiveExts = []string{".zip", ".tar", ".tgz", ".tar.gz", ".tar.bz2", ".tar.zst"}
+
+// isArchive reports whether name looks like a zip or tar archive.
+func isArchive(name string) bool {
+	return archiveExt(name) != ""
+}
+
+func archiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// archiveDirFor maps "dir/bundle.zip" to "dir/bundle", or to
+// "outdir/bundle" if outdir is not empty. This is the directory
+// that the csv files for the archive's members are written into.
+func archiveDirFor(archivePath, outdir string) string {
+	base := archivePath[:len(archivePath)-len(archiveExt(archivePath))]
+	if outdir == "" {
+		return base
+	}
+	return joinPath(outdir, filepath.Base(base))
+}
+
+// eachArchiveMember calls fn on each XML file inside the zip or tar
+// archive at archivePath. Compressed members are decompressed first.
+func eachArchiveMember(archivePath string, opts *Options, fn func(name string, r io.Reader) error) error {
+	// readInput also takes care of the gzip in .tar.gz
+	data, err := readInput(archivePath, opts)
+	if err != nil {
+		return err
+	}
+
+	visit := func(name string, r io.Reader) error {
+		dr, err := decompress(io.NopCloser(r))
+		if err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		defer dr.Close()
+		return fn(name, dr)
+	}
+
+	if bytes.HasPrefix(data, zipMagic) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || !isXMLName(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%v: %w", f.Name, err)
+			}
+			err = visit(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || !isXMLName(hdr.Name) {
+			continue
+		}
+		if err := visit(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// memberPath checks that an archive member name stays inside the
+// archive's output directory, so "../../etc/x.xml" can't escape it.
+func memberPath(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return "", fmt.Errorf("archive member '%v' points outside the archive", name)
+	}
+	return clean, nil
+}
+
+// convertArchive converts each XML member of the archive at archivePath
+// to its own csv file under outdir, mirroring the archive's layout.
+// Like a batch of files, a bad member does not stop the others.
+func convertArchive(archivePath, outdir string, opts *Options) error {
+	total, failed := 0, 0
+	err := eachArchiveMember(archivePath, opts, func(name string, r io.Reader) error {
+		if interrupted() {
+			return errInterrupted
+		}
+		total++
+		err := convertMember(name, r, outdir, opts)
+		if errors.Is(err, errInterrupted) {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%v: %v: %v\n", archivePath, name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &batchError{failed: failed, total: total, what: "archive members"}
+	}
+	return nil
+}
+
+func convertMember(name string, r io.Reader, outdir string, opts *Options) error {
+	clean, err := memberPath(name)
+	if err != nil {
+		return err
+	}
+	target := joinPath(outdir, csvPathFor(clean, "", opts))
+	if !isRemote(target) {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+	}
+	err = safely(target, opts, func() error {
+		return convertToFile(r, target, opts)
+	})
+	if err == nil {
+		opts.progressf("converted '%v' -> '%v'", name, target)
+	}
+	return err
+}
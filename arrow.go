@@ -0,0 +1,355 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// -format arrow writes the rows as an Apache Arrow IPC stream, for
+// pyarrow, pandas, polars and the like to take up without parsing
+// anything: pyarrow.ipc.open_stream(path).read_pandas(). The columns
+// are typed as for -format parquet, and nullable. A record batch is
+// written for each arrowBatchRows rows, so with -stream, only one
+// batch is ever held in memory.
+//
+// Arrow's metadata is in flatbuffers, which fbTable and its kin below
+// write, as much of them as the Schema and RecordBatch messages need.
+
+const arrowBatchRows = 1 << 17
+
+// The Arrow enums we use, from Schema.fbs and Message.fbs.
+const (
+	arrowV5 = 4 // MetadataVersion
+
+	arrowSchema      = 1 // MessageHeader
+	arrowRecordBatch = 3
+
+	arrowInt           = 2 // Type
+	arrowFloatingPoint = 3
+	arrowUtf8          = 5
+
+	arrowDouble = 2 // Precision
+)
+
+// arrowSink writes the rows as an Arrow IPC stream, for -format arrow.
+type arrowSink struct {
+	bw *bufio.Writer
+	c  io.Closer
+
+	cols    []*typedColumn
+	rows    int // in the batch being filled
+	total   int
+	started bool // the schema is written
+}
+
+func newArrowSink(wc io.WriteCloser) *arrowSink {
+	return &arrowSink{bw: bufio.NewWriter(wc), c: wc}
+}
+
+func (s *arrowSink) header(names, types []string) error {
+	s.cols = newTypedColumns(names, types)
+	return s.writeSchema()
+}
+
+func (s *arrowSink) writeSchema() error {
+	s.started = true
+	var fields []fbObject
+	for _, col := range s.cols {
+		typ, table := arrowType(col.typ)
+		fields = append(fields, fbTable{
+			fbString(col.name),
+			fbBool(true), // nullable
+			fbU8(typ),
+			table,
+			nil, // dictionary
+			fbTables(nil),
+		})
+	}
+	schema := fbTable{nil, fbTables(fields)}
+	return s.writeMessage(arrowSchema, schema, nil)
+}
+
+func arrowType(typ string) (byte, fbTable) {
+	switch typ {
+	case typeInteger:
+		return arrowInt, fbTable{fbI32(64), fbBool(true)}
+	case typeDecimal:
+		return arrowFloatingPoint, fbTable{fbI16(arrowDouble)}
+	}
+	return arrowUtf8, fbTable{}
+}
+
+func (s *arrowSink) row(cells []cell) error {
+	for i, c := range cells {
+		if err := s.cols[i].add(c, s.total+s.rows+1); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	if s.rows >= arrowBatchRows {
+		return s.writeBatch()
+	}
+	return nil
+}
+
+// flush leaves the rows of a batch that is not yet full, for close,
+// rather than writing a batch for each row that -stream flushes.
+func (s *arrowSink) flush() error { return nil }
+
+func (s *arrowSink) close() error {
+	var err error
+	if !s.started {
+		err = s.writeSchema()
+	}
+	if err == nil && s.rows > 0 {
+		err = s.writeBatch()
+	}
+	if err == nil {
+		// the end of the stream.
+		_, err = s.bw.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	}
+	if err == nil {
+		err = s.bw.Flush()
+	}
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeBatch writes the rows held as a record batch: for each column,
+// a validity bitmap, then the values, or for strings, their offsets
+// and then their bytes.
+func (s *arrowSink) writeBatch() error {
+	var body []byte
+	var nodes, buffers []byte
+	buffer := func(b []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(b)))
+		body = append(body, b...)
+		for len(body)%8 != 0 {
+			body = append(body, 0)
+		}
+	}
+	for _, col := range s.cols {
+		n := len(col.valid)
+		nulls := 0
+		bitmap := make([]byte, (n+7)/8)
+		for i, ok := range col.valid {
+			if ok {
+				bitmap[i/8] |= 1 << (i % 8)
+			} else {
+				nulls++
+			}
+		}
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(n))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(nulls))
+		buffer(bitmap)
+
+		// a null still has a slot, left zero.
+		j := 0
+		switch col.typ {
+		case typeInteger, typeDecimal:
+			values := make([]byte, 8*n)
+			for i, ok := range col.valid {
+				if !ok {
+					continue
+				}
+				if col.typ == typeInteger {
+					binary.LittleEndian.PutUint64(values[8*i:], uint64(col.ints[j]))
+				} else {
+					binary.LittleEndian.PutUint64(values[8*i:], math.Float64bits(col.floats[j]))
+				}
+				j++
+			}
+			buffer(values)
+		default:
+			offsets := make([]byte, 4, 4*(n+1))
+			var data []byte
+			for _, ok := range col.valid {
+				if ok {
+					data = append(data, col.strs[j]...)
+					j++
+				}
+				offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+			}
+			buffer(offsets)
+			buffer(data)
+		}
+		col.reset()
+	}
+	batch := fbTable{
+		fbI64(int64(s.rows)),
+		fbStructs(nodes),
+		fbStructs(buffers),
+	}
+	s.total += s.rows
+	s.rows = 0
+	if err := s.writeMessage(arrowRecordBatch, batch, body); err != nil {
+		return err
+	}
+	return s.bw.Flush()
+}
+
+// writeMessage writes a Message holding header, of the MessageHeader
+// type typ, then the body it describes.
+func (s *arrowSink) writeMessage(typ byte, header fbTable, body []byte) error {
+	msg := fbTable{
+		fbI16(arrowV5),
+		fbU8(typ),
+		header,
+		fbI64(int64(len(body))),
+	}
+	meta := fbFinish(msg)
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	if _, err := s.bw.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := s.bw.Write(meta); err != nil {
+		return err
+	}
+	_, err := s.bw.Write(body)
+	return err
+}
+
+// A flatbuffer is written front to back here: each object goes after
+// the one referring to it, whose offset to it is then filled in, as
+// offsets only point forward.
+
+// fbObject is a flatbuffer table, vector, or string, that is referred
+// to by offset. place appends it to b, and returns where it starts.
+type fbObject interface {
+	place(b *[]byte) int
+}
+
+// fbScalar is a little endian scalar field of a table.
+type fbScalar []byte
+
+func fbU8(v byte) fbScalar   { return fbScalar{v} }
+func fbI16(v int16) fbScalar { return binary.LittleEndian.AppendUint16(nil, uint16(v)) }
+func fbI32(v int32) fbScalar { return binary.LittleEndian.AppendUint32(nil, uint32(v)) }
+func fbI64(v int64) fbScalar { return binary.LittleEndian.AppendUint64(nil, uint64(v)) }
+
+func fbBool(v bool) fbScalar {
+	if v {
+		return fbScalar{1}
+	}
+	return fbScalar{0}
+}
+
+// place is never called, as a scalar is written into its table.
+func (fbScalar) place(*[]byte) int { panic("a scalar is inline") }
+
+// fbTable is a table, its fields by id: an fbScalar, an fbObject
+// referred to by offset, or nil when absent.
+type fbTable []fbObject
+
+// fbString is a string.
+type fbString string
+
+// fbTables is a vector of tables.
+type fbTables []fbObject
+
+// fbStructs is a vector of structs of two longs each, like FieldNode
+// and Buffer, already laid out.
+type fbStructs []byte
+
+// fbFinish returns the flatbuffer whose root is t, padded to 8 bytes.
+func fbFinish(t fbTable) []byte {
+	b := make([]byte, 4)
+	fbPatch(b, 0, t.place(&b))
+	fbPad(&b, 8, 0)
+	return b
+}
+
+// fbPad pads b with zeros until its length is off past a multiple of align.
+func fbPad(b *[]byte, align, off int) {
+	for len(*b)%align != off {
+		*b = append(*b, 0)
+	}
+}
+
+// fbPatch fills in the offset at, to the object at pos.
+func fbPatch(b []byte, at, pos int) {
+	binary.LittleEndian.PutUint32(b[at:], uint32(pos-at))
+}
+
+func (t fbTable) place(b *[]byte) int {
+	// lay out the fields after the offset to the vtable, each
+	// aligned to its size, with the table itself aligned to 8.
+	offs := make([]int, len(t))
+	size := 4
+	for i, f := range t {
+		n := 4
+		if s, ok := f.(fbScalar); ok {
+			n = len(s)
+		} else if f == nil {
+			continue
+		}
+		for size%n != 0 {
+			size++
+		}
+		offs[i] = size
+		size += n
+	}
+	fbPad(b, 2, 0)
+	vpos := len(*b)
+	*b = binary.LittleEndian.AppendUint16(*b, uint16(4+2*len(t)))
+	*b = binary.LittleEndian.AppendUint16(*b, uint16(size))
+	for _, off := range offs {
+		*b = binary.LittleEndian.AppendUint16(*b, uint16(off))
+	}
+	fbPad(b, 8, 0)
+	tpos := len(*b)
+	*b = append(*b, make([]byte, size)...)
+	binary.LittleEndian.PutUint32((*b)[tpos:], uint32(tpos-vpos))
+	for i, f := range t {
+		if s, ok := f.(fbScalar); ok {
+			copy((*b)[tpos+offs[i]:], s)
+		}
+	}
+	for i, f := range t {
+		if _, ok := f.(fbScalar); ok || f == nil {
+			continue
+		}
+		fbPatch(*b, tpos+offs[i], f.place(b))
+	}
+	return tpos
+}
+
+func (s fbString) place(b *[]byte) int {
+	fbPad(b, 4, 0)
+	pos := len(*b)
+	*b = binary.LittleEndian.AppendUint32(*b, uint32(len(s)))
+	*b = append(*b, s...)
+	*b = append(*b, 0)
+	return pos
+}
+
+func (v fbTables) place(b *[]byte) int {
+	fbPad(b, 4, 0)
+	pos := len(*b)
+	*b = binary.LittleEndian.AppendUint32(*b, uint32(len(v)))
+	*b = append(*b, make([]byte, 4*len(v))...)
+	for i, t := range v {
+		fbPatch(*b, pos+4+4*i, t.place(b))
+	}
+	return pos
+}
+
+func (v fbStructs) place(b *[]byte) int {
+	// the length goes just before the structs, aligned to 8.
+	fbPad(b, 8, 4)
+	pos := len(*b)
+	*b = binary.LittleEndian.AppendUint32(*b, uint32(len(v)/16))
+	*b = append(*b, v...)
+	return pos
+}
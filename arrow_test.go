@@ -0,0 +1,177 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fbReader reads the flatbuffer it holds, by the positions in it of
+// its tables and fields.
+type fbReader []byte
+
+func (b fbReader) u32(at int) int { return int(binary.LittleEndian.Uint32(b[at:])) }
+func (b fbReader) u16(at int) int { return int(binary.LittleEndian.Uint16(b[at:])) }
+
+func (b fbReader) root() int { return b.u32(0) }
+
+// field returns where field i of the table at t is, or 0 if it is absent.
+func (b fbReader) field(t, i int) int {
+	vt := t - int(int32(b.u32(t)))
+	if 4+2*i >= b.u16(vt) {
+		return 0
+	}
+	if off := b.u16(vt + 4 + 2*i); off != 0 {
+		return t + off
+	}
+	return 0
+}
+
+// deref follows the offset at p to what it refers to.
+func (b fbReader) deref(p int) int { return p + b.u32(p) }
+
+func (b fbReader) string(p int) string {
+	s := b.deref(p)
+	return string(b[s+4 : s+4+b.u32(s)])
+}
+
+// vector returns where the elements of the vector at p start, and
+// how many there are.
+func (b fbReader) vector(p int) (int, int) {
+	v := b.deref(p)
+	return v + 4, b.u32(v)
+}
+
+// arrowField is a field of an Arrow schema.
+type arrowField struct {
+	name     string
+	nullable bool
+	typ      byte
+	bits     int // of an Int, or the Precision of a FloatingPoint
+}
+
+// readArrow returns the schema of the Arrow IPC stream b, and the
+// values of each of its columns, with nil for a null.
+func readArrow(t *testing.T, b []byte) ([]arrowField, [][]any) {
+	t.Helper()
+	var fields []arrowField
+	var columns [][]any
+	for {
+		if len(b) < 8 || binary.LittleEndian.Uint32(b) != 0xffffffff {
+			t.Fatalf("no continuation marker where a message should be")
+		}
+		n := int(binary.LittleEndian.Uint32(b[4:]))
+		if n == 0 {
+			if len(b) != 8 {
+				t.Errorf("%v bytes after the end of the stream", len(b)-8)
+			}
+			return fields, columns
+		}
+		meta := fbReader(b[8 : 8+n])
+		msg := meta.root()
+		if v := meta.u16(meta.field(msg, 0)); v != arrowV5 {
+			t.Errorf("metadata version %v, want %v", v, arrowV5)
+		}
+		header := meta.deref(meta.field(msg, 2))
+		bodyLen := int(binary.LittleEndian.Uint64(meta[meta.field(msg, 3):]))
+		body := b[8+n : 8+n+bodyLen]
+		b = b[8+n+bodyLen:]
+
+		switch typ := meta[meta.field(msg, 1)]; typ {
+		case arrowSchema:
+			if fields != nil {
+				t.Fatalf("a second schema")
+			}
+			at, count := meta.vector(meta.field(header, 1))
+			for i := 0; i < count; i++ {
+				f := meta.deref(at + 4*i)
+				field := arrowField{
+					name:     meta.string(meta.field(f, 0)),
+					nullable: meta[meta.field(f, 1)] == 1,
+					typ:      meta[meta.field(f, 2)],
+				}
+				switch p := meta.deref(meta.field(f, 3)); field.typ {
+				case arrowInt:
+					field.bits = meta.u32(meta.field(p, 0))
+				case arrowFloatingPoint:
+					field.bits = meta.u16(meta.field(p, 0))
+				}
+				fields = append(fields, field)
+			}
+			columns = make([][]any, len(fields))
+		case arrowRecordBatch:
+			nodes, _ := meta.vector(meta.field(header, 1))
+			buffers, _ := meta.vector(meta.field(header, 2))
+			buffer := func() []byte {
+				off := binary.LittleEndian.Uint64(meta[buffers:])
+				size := binary.LittleEndian.Uint64(meta[buffers+8:])
+				buffers += 16
+				return body[off : off+size]
+			}
+			for i, f := range fields {
+				rows := int(binary.LittleEndian.Uint64(meta[nodes+16*i:]))
+				valid := buffer()
+				var values, data []byte
+				values = buffer()
+				if f.typ == arrowUtf8 {
+					data = buffer()
+				}
+				for r := 0; r < rows; r++ {
+					var v any
+					switch {
+					case valid[r/8]&(1<<(r%8)) == 0:
+					case f.typ == arrowInt:
+						v = int64(binary.LittleEndian.Uint64(values[8*r:]))
+					case f.typ == arrowFloatingPoint:
+						v = math.Float64frombits(binary.LittleEndian.Uint64(values[8*r:]))
+					default:
+						v = string(data[binary.LittleEndian.Uint32(values[4*r:]):binary.LittleEndian.Uint32(values[4*r+4:])])
+					}
+					columns[i] = append(columns[i], v)
+				}
+			}
+		default:
+			t.Fatalf("message of type %v", typ)
+		}
+	}
+}
+
+func TestArrow(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(shopXML), &out, Options{Format: "arrow"}); err != nil {
+		t.Fatal(err)
+	}
+	fields, columns := readArrow(t, out.Bytes())
+	want := []arrowField{
+		{"added", true, arrowUtf8, 0},
+		{"price", true, arrowFloatingPoint, arrowDouble},
+		{"qty", true, arrowInt, 64},
+		{"sku", true, arrowUtf8, 0},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("schema %+v, want %+v", fields, want)
+	}
+	for i, c := range shopColumns {
+		if !reflect.DeepEqual(columns[i], c.values) {
+			t.Errorf("%v holds %v, want %v", c.name, columns[i], c.values)
+		}
+	}
+}
+
+// With no records, the stream is still a schema, and its end.
+func TestArrowEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader("<shop/>"), &out, Options{Format: "arrow"}); err != nil {
+		t.Fatal(err)
+	}
+	fields, columns := readArrow(t, out.Bytes())
+	if len(fields) != 0 || len(columns) != 0 {
+		t.Errorf("got %v fields and %v columns, want none", len(fields), len(columns))
+	}
+}
@@ -0,0 +1,65 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"strings"
+)
+
+// attr is one name="value" attribute of a tag. The value
+// is as written, without its quotes, and not unescaped.
+type attr struct {
+	name  string
+	value string
+}
+
+// attrs returns the attributes of t, in the order written.
+func (t *Tag) attrs() (r []attr) {
+	s := strings.TrimSuffix(strings.TrimSuffix(t.btwn, ">"), "/")
+	s = strings.TrimPrefix(s, "<")
+	// skip the element name.
+	i := strings.IndexAny(s, " \t\r\n")
+	if i < 0 {
+		return nil
+	}
+	s = s[i:]
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t\r\n")
+		if s == "" {
+			return
+		}
+		var value string
+		if q := s[0]; q == '"' || q == '\'' {
+			end := strings.IndexByte(s[1:], q)
+			if end < 0 {
+				return
+			}
+			value, s = s[1:1+end], s[2+end:]
+		} else {
+			// unquoted, as in sloppy input.
+			end := strings.IndexAny(s, " \t\r\n")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		r = append(r, attr{name: name, value: value})
+	}
+}
+
+// attr returns the value of t's attribute name, and whether it has one.
+func (t *Tag) attr(name string) (string, bool) {
+	for _, a := range t.attrs() {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,210 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+)
+
+// -format avro writes the rows as an Avro Object Container File, for
+// Kafka and Hadoop, with the schema in its header: a record with a
+// field for each column, typed as for -format parquet, as a long, a
+// double, or a string, and each a union with null, for the records
+// that lack it. A column's name is made a legal Avro name, with _ for
+// any character other than a letter, digit or _, so Contributor.Name
+// becomes Contributor_Name. The blocks are compressed with deflate.
+
+const avroBlockRows = 1 << 12
+
+// avroSink writes the rows as an Avro Object Container File, for -format avro.
+type avroSink struct {
+	bw *bufio.Writer
+	c  io.Closer
+
+	cols    []*typedColumn
+	rows    int // in the block being filled
+	total   int
+	sync    [16]byte
+	started bool // the header is written
+}
+
+func newAvroSink(wc io.WriteCloser) *avroSink {
+	s := &avroSink{bw: bufio.NewWriter(wc), c: wc}
+	rand.Read(s.sync[:])
+	return s
+}
+
+func (s *avroSink) header(names, types []string) error {
+	s.cols = newTypedColumns(names, types)
+	return s.writeHeader()
+}
+
+// avroRecord is the schema.
+type avroRecord struct {
+	Type   string      `json:"type"`
+	Name   string      `json:"name"`
+	Fields []avroField `json:"fields"`
+}
+
+// avroField is a field of the schema.
+type avroField struct {
+	Name    string      `json:"name"`
+	Type    []string    `json:"type"`
+	Default interface{} `json:"default"`
+}
+
+// writeHeader writes the magic, the schema and codec, and the sync marker.
+func (s *avroSink) writeHeader() error {
+	s.started = true
+	fields := []avroField{}
+	used := make(map[string]bool)
+	for _, col := range s.cols {
+		name := avroName(col.name)
+		for i := 1; used[name]; i++ {
+			name = avroName(col.name) + "_" + strconv.Itoa(i)
+		}
+		used[name] = true
+		fields = append(fields, avroField{Name: name, Type: []string{"null", avroType(col.typ)}})
+	}
+	schema, err := json.Marshal(avroRecord{Type: "record", Name: "Record", Fields: fields})
+	if err != nil {
+		return err
+	}
+	var b []byte
+	b = append(b, "Obj\x01"...)
+	b = avroLong(b, 2)
+	b = avroBytes(b, []byte("avro.schema"))
+	b = avroBytes(b, schema)
+	b = avroBytes(b, []byte("avro.codec"))
+	b = avroBytes(b, []byte("deflate"))
+	b = avroLong(b, 0)
+	b = append(b, s.sync[:]...)
+	_, err = s.bw.Write(b)
+	return err
+}
+
+// avroName makes name a legal Avro name.
+func avroName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+func avroType(typ string) string {
+	switch typ {
+	case typeInteger:
+		return "long"
+	case typeDecimal:
+		return "double"
+	}
+	return "string"
+}
+
+func (s *avroSink) row(cells []cell) error {
+	for i, c := range cells {
+		if err := s.cols[i].add(c, s.total+s.rows+1); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	if s.rows >= avroBlockRows {
+		return s.writeBlock()
+	}
+	return nil
+}
+
+// flush leaves the rows of a block that is not yet full, for close,
+// rather than writing a block for each row that -stream flushes.
+func (s *avroSink) flush() error { return nil }
+
+func (s *avroSink) close() error {
+	var err error
+	if !s.started {
+		err = s.writeHeader()
+	}
+	if err == nil && s.rows > 0 {
+		err = s.writeBlock()
+	}
+	if err == nil {
+		err = s.bw.Flush()
+	}
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeBlock writes the rows held as a block: their count, the size
+// of them deflated, them, and the sync marker.
+func (s *avroSink) writeBlock() error {
+	var data []byte
+	next := make([]int, len(s.cols)) // each column's next value
+	for r := 0; r < s.rows; r++ {
+		for i, col := range s.cols {
+			if !col.valid[r] {
+				data = avroLong(data, 0)
+				continue
+			}
+			data = avroLong(data, 1)
+			j := next[i]
+			next[i]++
+			switch col.typ {
+			case typeInteger:
+				data = avroLong(data, col.ints[j])
+			case typeDecimal:
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(col.floats[j]))
+			default:
+				data = avroBytes(data, []byte(col.strs[j]))
+			}
+		}
+	}
+	for _, col := range s.cols {
+		col.reset()
+	}
+
+	var z bytes.Buffer
+	zw, _ := flate.NewWriter(&z, flate.DefaultCompression) // the level is valid.
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	b := avroLong(nil, int64(s.rows))
+	b = avroLong(b, int64(z.Len()))
+	b = append(b, z.Bytes()...)
+	b = append(b, s.sync[:]...)
+	s.total += s.rows
+	s.rows = 0
+	if _, err := s.bw.Write(b); err != nil {
+		return err
+	}
+	return s.bw.Flush()
+}
+
+// avroLong appends v, zigzag varint encoded.
+func avroLong(b []byte, v int64) []byte {
+	return binary.AppendVarint(b, v)
+}
+
+// avroBytes appends p, after its length.
+func avroBytes(b, p []byte) []byte {
+	return append(avroLong(b, int64(len(p))), p...)
+}
@@ -0,0 +1,183 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// avroReader reads the Avro binary encoding.
+type avroReader struct {
+	b []byte
+}
+
+func (r *avroReader) long() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		panic("bad long")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *avroReader) bytes() []byte {
+	n := r.long()
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// readAvro returns the metadata of the Avro Object Container File b,
+// its schema, and its records, a field's value nil when it is null,
+// and the number of its blocks.
+func readAvro(t *testing.T, b []byte) (map[string]string, avroRecord, [][]any, int) {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("Obj\x01")) {
+		t.Fatalf("no Avro magic")
+	}
+	r := &avroReader{b: b[4:]}
+	meta := map[string]string{}
+	for {
+		n := r.long()
+		if n == 0 {
+			break
+		}
+		if n < 0 {
+			n = -n
+			r.long() // the size of the block
+		}
+		for i := int64(0); i < n; i++ {
+			k := string(r.bytes())
+			meta[k] = string(r.bytes())
+		}
+	}
+	var schema avroRecord
+	if err := json.Unmarshal([]byte(meta["avro.schema"]), &schema); err != nil {
+		t.Fatalf("the schema %q: %v", meta["avro.schema"], err)
+	}
+	sync := r.b[:16]
+	r.b = r.b[16:]
+
+	var records [][]any
+	blocks := 0
+	for len(r.b) > 0 {
+		count := r.long()
+		data := r.bytes()
+		if !bytes.Equal(r.b[:16], sync) {
+			t.Fatalf("block %v does not end in the sync marker", blocks)
+		}
+		r.b = r.b[16:]
+		blocks++
+		if meta["avro.codec"] == "deflate" {
+			var err error
+			if data, err = io.ReadAll(flate.NewReader(bytes.NewReader(data))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d := &avroReader{b: data}
+		for i := int64(0); i < count; i++ {
+			var rec []any
+			for _, f := range schema.Fields {
+				branch := d.long()
+				switch typ := f.Type[branch]; typ {
+				case "null":
+					rec = append(rec, nil)
+				case "long":
+					rec = append(rec, d.long())
+				case "double":
+					rec = append(rec, math.Float64frombits(binary.LittleEndian.Uint64(d.b)))
+					d.b = d.b[8:]
+				case "string":
+					rec = append(rec, string(d.bytes()))
+				default:
+					t.Fatalf("field %v of type %v", f.Name, typ)
+				}
+			}
+			records = append(records, rec)
+		}
+		if len(d.b) != 0 {
+			t.Errorf("%v bytes left over in block %v", len(d.b), blocks)
+		}
+	}
+	return meta, schema, records, blocks
+}
+
+func TestAvro(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(shopXML), &out, Options{Format: "avro"}); err != nil {
+		t.Fatal(err)
+	}
+	meta, schema, records, _ := readAvro(t, out.Bytes())
+	if meta["avro.codec"] != "deflate" {
+		t.Errorf("codec %q, want deflate", meta["avro.codec"])
+	}
+	want := avroRecord{Type: "record", Name: "Record", Fields: []avroField{
+		{Name: "added", Type: []string{"null", "string"}},
+		{Name: "price", Type: []string{"null", "double"}},
+		{Name: "qty", Type: []string{"null", "long"}},
+		{Name: "sku", Type: []string{"null", "string"}},
+	}}
+	if !reflect.DeepEqual(schema, want) {
+		t.Fatalf("schema %+v, want %+v", schema, want)
+	}
+	if len(records) != 3 {
+		t.Fatalf("%v records, want 3", len(records))
+	}
+	for i, c := range shopColumns {
+		for r, rec := range records {
+			if !reflect.DeepEqual(rec[i], c.values[r]) {
+				t.Errorf("%v of record %v is %v, want %v", c.name, r, rec[i], c.values[r])
+			}
+		}
+	}
+}
+
+// The names are made legal, and kept apart, and the rows go in blocks
+// of avroBlockRows.
+func TestAvroNamesAndBlocks(t *testing.T) {
+	var in strings.Builder
+	in.WriteString("<r>")
+	n := avroBlockRows + 1
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&in, "<p><a-b>%v</a-b><a_b>x</a_b></p>", i)
+	}
+	in.WriteString("</r>")
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(in.String()), &out, Options{Format: "avro", Stream: true}); err != nil {
+		t.Fatal(err)
+	}
+	_, schema, records, blocks := readAvro(t, out.Bytes())
+	var names []string
+	for _, f := range schema.Fields {
+		names = append(names, f.Name)
+	}
+	if want := []string{"a_b", "a_b_1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names %v, want %v", names, want)
+	}
+	if blocks != 2 || len(records) != n || records[n-1][0] != int64(n-1) {
+		t.Errorf("%v records in %v blocks, want %v in 2", len(records), blocks, n)
+	}
+}
+
+func TestAvroName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Contributor.Name": "Contributor_Name",
+		"a_b9":             "a_b9",
+		"9lives":           "_lives",
+		"":                 "_",
+	} {
+		if got := avroName(in); got != want {
+			t.Errorf("avroName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// safeConvertFile is convertFile, but no partial csv is left behind
+// on failure, and even a bug that panics only fails this one file.
+func safeConvertFile(inPath, outPath string, opts *Options) error {
+	return safely(outPath, opts, func() error {
+		return convertFile(inPath, outPath, opts)
+	})
+}
+
+// safely runs fn, which writes outPath, turning a panic into an
+// error, and removing outPath if fn did not succeed; unless the rows
+// go into a database, which may hold much else, and which is only
+// changed if the conversion succeeds.
+func safely(outPath string, opts *Options, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error: %v", r)
+		}
+		// an interrupted conversion has written whole records, so keep them.
+		if err != nil && !errors.Is(err, errInterrupted) && !isRemote(outPath) && !opts.database() {
+			os.Remove(outPath)
+		}
+	}()
+	return fn()
+}
+
+// convertFile converts the XML file at inPath into a csv file at outPath.
+// Either may be an s3:// or gs:// object path.
+func convertFile(inPath, outPath string, opts *Options) (err error) {
+	in, err := openInput(inPath, opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err = convertToFile(in, outPath, opts); err != nil {
+		return err
+	}
+	return in.Close()
+}
+
+// convertToFile converts the XML read from r into a csv file at outPath.
+func convertToFile(r io.Reader, outPath string, opts *Options) (err error) {
+	opts, rejects := withRejects(outPath, opts)
+	defer func() {
+		err2 := rejects.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	if opts.SplitDocs {
+		return convertDocs(r, outPath, opts)
+	}
+	if opts.SplitRecords {
+		return convertRecordTypes(r, outPath, opts)
+	}
+	if opts.Relational {
+		return convertTables(r, outPath, opts)
+	}
+	sink, err := openSink(outPath, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if abortSink(sink, err) {
+			return
+		}
+		err2 := sink.close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	return convert(context.Background(), r, sink, opts)
+}
+
+// targetFor returns where the csv output for path goes: a .csv file,
+// or for an archive, a directory to hold one .csv per member.
+func targetFor(path, outdir string, opts *Options) string {
+	if isArchive(path) {
+		return archiveDirFor(path, outdir)
+	}
+	return csvPathFor(path, outdir, opts)
+}
+
+// csvPathFor maps "dir/name.xml" (or "dir/name.xml.gz") to "dir/name.csv",
+// or to "outdir/name.csv" if outdir is not empty. When compressing
+// output, the ".csv" becomes ".csv.gz" or ".csv.zst".
+func csvPathFor(xmlPath, outdir string, opts *Options) string {
+	xmlPath = trimCompressedExt(xmlPath)
+	base := strings.TrimSuffix(xmlPath, filepath.Ext(xmlPath)) + opts.csvExt()
+	if outdir == "" {
+		return base
+	}
+	return joinPath(outdir, filepath.Base(base))
+}
+
+// listXMLFiles returns the *.xml (and *.xml.gz, etc) files inside dir,
+// along with any .zip or .tar archives, sorted. If recursive, the
+// files in all subdirectories are included too.
+func listXMLFiles(dir string, recursive bool) (r []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isXMLName(d.Name()) || isArchive(d.Name()) {
+			r = append(r, path)
+		}
+		return nil
+	})
+	sort.Strings(r)
+	return
+}
+
+// mirrorPathFor maps "dir/sub/name.xml" to "outdir/sub/name.csv", so that
+// the directory hierarchy under dir is reproduced under outdir. With no
+// outdir, the .csv goes next to the .xml.
+func mirrorPathFor(dir, xmlPath, outdir string, opts *Options) (string, error) {
+	if outdir == "" {
+		return targetFor(xmlPath, "", opts), nil
+	}
+	rel, err := filepath.Rel(dir, xmlPath)
+	if err != nil {
+		return "", err
+	}
+	return joinPath(outdir, targetFor(rel, "", opts)), nil
+}
+
+// convertDir converts every *.xml file in dir, writing a matching .csv
+// next to each one, or into outdir when it is given. If recursive,
+// subdirectories are converted too, and their layout is mirrored
+// under outdir.
+func convertDir(dir, outdir string, recursive bool, workers int, opts *Options) error {
+	paths, err := listXMLFiles(dir, recursive)
+	if err != nil {
+		return err
+	}
+	targets := make([]string, len(paths))
+	for i, path := range paths {
+		targets[i], err = mirrorPathFor(dir, path, outdir, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return convertAll(paths, targets, workers, opts)
+}
+
+// convertFiles converts each of paths to its own csv file.
+func convertFiles(paths []string, outdir string, workers int, opts *Options) error {
+	targets := make([]string, len(paths))
+	for i, path := range paths {
+		targets[i] = targetFor(path, outdir, opts)
+	}
+	return convertAll(paths, targets, workers, opts)
+}
+
+// convertAll converts paths[i] into targets[i], using up to
+// workers goroutines at once. A file that fails to convert
+// does not stop the others; the failures are reported at the end.
+func convertAll(paths, targets []string, workers int, opts *Options) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	errs := make([]error, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if !isRemote(targets[i]) {
+					errs[i] = os.MkdirAll(filepath.Dir(targets[i]), 0755)
+					if errs[i] != nil {
+						continue
+					}
+				}
+				if isArchive(paths[i]) {
+					errs[i] = convertArchive(paths[i], targets[i], opts)
+				} else {
+					errs[i] = safeConvertFile(paths[i], targets[i], opts)
+				}
+				if errs[i] == nil {
+					opts.progressf("converted '%v' -> '%v'", paths[i], targets[i])
+				}
+			}
+		}()
+	}
+	started := 0
+	for i := range paths {
+		if interrupted() {
+			break
+		}
+		jobs <- i
+		started++
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(paths) == 1 {
+		if errs[0] != nil {
+			return withFile(paths[0], errs[0])
+		}
+		return nil
+	}
+	failed := 0
+	stopped := started < len(paths)
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", withFile(paths[i], err))
+			if errors.Is(err, errInterrupted) {
+				stopped = true
+				continue
+			}
+			failed++
+		}
+	}
+	opts.warnf("converted %v of %v files; %v failed.\n", started-failed, len(paths), failed)
+	if stopped {
+		return fmt.Errorf("%w after converting %v of %v files", errInterrupted, started-failed, len(paths))
+	}
+	if failed > 0 {
+		return &batchError{failed: failed, total: len(paths), what: "files"}
+	}
+	return nil
+}
+
+// combineFiles parses all of paths and writes their records
+// out as one csv, under a single header.
+func combineFiles(paths []string, sink rowSink, opts *Options) error {
+	all := &doc{simpleMap: make(map[string]*valueSet)}
+	for _, path := range paths {
+		if isArchive(path) {
+			err := eachArchiveMember(path, opts, func(name string, r io.Reader) error {
+				d, err := parse(context.Background(), r, opts)
+				if err != nil {
+					return err
+				}
+				if opts.SourceColumn {
+					d.noteSource(path + "/" + name)
+				}
+				all.merge(d)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		in, err := openInput(path, opts)
+		if err != nil {
+			return err
+		}
+		d, err := parse(context.Background(), in, opts)
+		err2 := in.Close()
+		if err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
+		}
+		if opts.SourceColumn {
+			d.noteSource(path)
+		}
+		all.merge(d)
+	}
+	return writeCsv(context.Background(), sink, all, opts)
+}
+
+// readInput returns the whole contents of the file or object at path.
+func readInput(path string, opts *Options) ([]byte, error) {
+	in, err := openInput(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(in)
+	err2 := in.Close()
+	if err == nil {
+		err = err2
+	}
+	return data, err
+}
+
+// expandGlobs returns the files matched by each of patterns, in order
+// and without duplicates. A pattern that is not a glob is taken as is.
+func expandGlobs(patterns []string) (r []string, err error) {
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		var matches []string
+		if hasMeta(pattern) {
+			matches, err = expandGlob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match '%v'", pattern)
+			}
+		} else {
+			matches = []string{pattern}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				r = append(r, m)
+			}
+		}
+	}
+	return
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// expandGlob returns the files matching pattern. Besides the usual
+// filepath.Match syntax, a "**" path element matches any number of
+// directories, so "data/**/*.xml" finds .xml files at any depth under data.
+func expandGlob(pattern string) (r []string, err error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	// walk from the longest leading directory that has no wildcards.
+	pat := strings.Split(filepath.ToSlash(pattern), "/")
+	var rootSegs []string
+	for _, seg := range pat {
+		if hasMeta(seg) {
+			break
+		}
+		rootSegs = append(rootSegs, seg)
+	}
+	root := strings.Join(rootSegs, "/")
+	switch {
+	case len(rootSegs) == 0:
+		root = "."
+	case root == "":
+		root = "/"
+	}
+	rest := pat[len(rootSegs):]
+
+	err = filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(root), p)
+		if err != nil {
+			return err
+		}
+		if matchSegs(rest, strings.Split(filepath.ToSlash(rel), "/")) {
+			r = append(r, p)
+		}
+		return nil
+	})
+	return
+}
+
+// matchSegs matches the slash separated path elements in name
+// against those in pat, where "**" matches zero or more elements.
+func matchSegs(pat, name []string) bool {
+	if len(pat) == 0 {
+		return len(name) == 0
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegs(pat[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, err := path.Match(pat[0], name[0])
+	if err != nil || !ok {
+		return false
+	}
+	return matchSegs(pat[1:], name[1:])
+}
@@ -0,0 +1,58 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// -bq-schema writes, next to the csv, as out.schema.json for out.csv,
+// the schema that bq load --schema takes for it: a name, type and mode
+// for each column, in order, typed as -types-row infers them. bq load
+// matches the csv's columns to the schema's by position, so a name
+// that BigQuery would not take, like Contributor.Name, is made one,
+// as Contributor_Name, just as for -format avro.
+
+// bqField is a column of the schema.
+type bqField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+}
+
+// bqSchema returns the BigQuery schema of the columns of s.
+func bqSchema(s *schemaSink) ([]byte, error) {
+	fields := []bqField{}
+	used := make(map[string]bool)
+	for i, col := range s.names {
+		name := avroName(col)
+		for n := 1; used[strings.ToLower(name)]; n++ {
+			name = avroName(col) + "_" + strconv.Itoa(n)
+		}
+		used[strings.ToLower(name)] = true
+		fields = append(fields, bqField{Name: name, Type: bqType(s.types[i], s.shapes[i]), Mode: "NULLABLE"})
+	}
+	return json.MarshalIndent(fields, "", "  ")
+}
+
+// bqType returns the BigQuery type of a column of type typ, shaped as shape.
+func bqType(typ string, shape columnShape) string {
+	switch typ {
+	case typeInteger:
+		return "INTEGER"
+	case typeDecimal:
+		return "FLOAT"
+	case typeDate:
+		switch {
+		case shape.zone:
+			return "TIMESTAMP"
+		case shape.time:
+			return "DATETIME"
+		}
+		return "DATE"
+	}
+	return "STRING"
+}
@@ -0,0 +1,42 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBQSchema(t *testing.T) {
+	in := `<r>
+  <p><n>1</n><d>1.5</d><day>2023-01-02</day><local>2023-01-02T03:04:05</local><at>2023-01-02T03:04:05Z</at><big>123456789012345678901234</big><s>x</s></p>
+  <p><n>-2</n><d>2</d><day>2023-02-03</day><local>2023-01-02</local><at>2023-01-02T03:04:05+01:00</at><big>1</big><my.name>y</my.name><My_Name>z</My_Name></p>
+</r>`
+	dir := convertTo(t, in, "out.csv", Options{BQSchema: true})
+	b, err := os.ReadFile(filepath.Join(dir, "out.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []bqField
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []bqField{
+		{"My_Name", "STRING", "NULLABLE"},
+		{"at", "TIMESTAMP", "NULLABLE"},
+		{"big", "STRING", "NULLABLE"},
+		{"d", "FLOAT", "NULLABLE"},
+		{"day", "DATE", "NULLABLE"},
+		{"local", "DATETIME", "NULLABLE"},
+		{"my_name_1", "STRING", "NULLABLE"},
+		{"n", "INTEGER", "NULLABLE"},
+		{"s", "STRING", "NULLABLE"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
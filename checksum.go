@@ -0,0 +1,63 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// checksumColumn holds the checksum of each record, for -checksum.
+const checksumColumn = "_checksum"
+
+// A record's checksum is taken over a canonical form of its XML, so
+// that only a change in what it says changes the checksum, and not
+// how it says it: the whitespace between elements, the order and
+// quoting of attributes, and the choice of entity or character
+// reference are all ironed out first.
+
+// newHash returns the hash for the -checksum algorithm.
+func newHash(algo string) hash.Hash {
+	if algo == "fnv64" {
+		return fnv.New64a()
+	}
+	return sha256.New()
+}
+
+// recordChecksum returns the checksum of rec, in hex.
+func recordChecksum(rec *Tag, algo string) string {
+	var b strings.Builder
+	canonical(&b, rec)
+	h := newHash(algo)
+	h.Write([]byte(b.String()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var canonEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// canonical writes t, and everything in it, in canonical form.
+func canonical(b *strings.Builder, t *Tag) {
+	b.WriteString("<" + t.name)
+	attrs := t.attrs()
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].name < attrs[j].name })
+	for _, a := range attrs {
+		b.WriteString(" " + a.name + `="` + canonEscaper.Replace(unescapeEntities(a.value)) + `"`)
+	}
+	b.WriteString(">")
+	if t.isSimple {
+		content := t.content
+		if !t.preserve {
+			content = strings.TrimSpace(content)
+		}
+		b.WriteString(canonEscaper.Replace(content))
+	}
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		canonical(b, c)
+	}
+	b.WriteString("</" + t.name + ">")
+}
@@ -0,0 +1,16 @@
+package main
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"os"
+
+	"github.com/glycerine/xml2csv"
+)
+
+func main() {
+	// time-stamp the progress notes of -v in Chicago time.
+	os.Setenv("TZ", "America/Chicago")
+	xml2csv.Main()
+}
@@ -0,0 +1,155 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A column pattern is a glob, where * matches any run of characters,
+// even the path separator, ? any one character, and [abc] any one of
+// those listed; or, when it starts with "re:", a regular expression
+// that must match somewhere in the column name.
+
+// splitPatterns splits a comma separated list of globs. A regular
+// expression may hold commas of its own, so it is taken whole.
+func splitPatterns(s string) []string {
+	if strings.HasPrefix(s, "re:") {
+		return []string{s}
+	}
+	return strings.Split(s, ",")
+}
+
+// compilePatterns compiles the column patterns.
+func compilePatterns(patterns []string) (r []*regexp.Regexp, err error) {
+	for _, pat := range patterns {
+		expr, ok := strings.CutPrefix(pat, "re:")
+		if !ok {
+			expr = globRegexp(pat)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, usagef("bad column pattern '%v': %v", pat, err)
+		}
+		r = append(r, re)
+	}
+	return
+}
+
+// globRegexp translates a glob into the regular expression for it.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func matchesAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterColumns keeps those of names that match one of the
+// opts.Include patterns, if there are any, and then drops those
+// that match one of the opts.Exclude patterns.
+func filterColumns(names []string, opts *Options) (r []string) {
+	if len(opts.Include) == 0 && len(opts.Exclude) == 0 {
+		return names
+	}
+	// the patterns were checked by opts.validate.
+	include, _ := compilePatterns(opts.Include)
+	exclude, _ := compilePatterns(opts.Exclude)
+	for _, name := range names {
+		if len(include) > 0 && !matchesAny(include, name) {
+			continue
+		}
+		if matchesAny(exclude, name) {
+			continue
+		}
+		r = append(r, name)
+	}
+	return
+}
+
+// moveToFront moves name, if it is among names, to the front.
+func moveToFront(names []string, name string) []string {
+	for i, nm := range names {
+		if nm == name {
+			copy(names[1:i+1], names[:i])
+			names[0] = name
+			break
+		}
+	}
+	return names
+}
+
+// A rename file maps the flattened column names to the names to give
+// them in the header instead. For example:
+//
+//	DescriptiveDetail_TitleDetail_TitleElement_TitleText: title
+//	PublishingDetail_PublishingDate_Date: published
+
+// loadRenames reads the rename file at path.
+func loadRenames(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, usagef("%v: %v", path, err)
+	}
+	return m, nil
+}
+
+// renameColumns returns the header for the columns names, renamed
+// by opts.Rename. Renaming two columns alike gets a warning.
+func renameColumns(names []string, opts *Options) []string {
+	if len(opts.Rename) == 0 {
+		return names
+	}
+	r := make([]string, len(names))
+	seen := make(map[string]bool)
+	for i, name := range names {
+		if new, ok := opts.Rename[name]; ok {
+			name = new
+		}
+		if seen[name] {
+			opts.warnf("warning: more than one column is named '%v' after renaming.\n", name)
+		}
+		seen[name] = true
+		r[i] = name
+	}
+	return r
+}
@@ -0,0 +1,182 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// To enable completion, for bash:
+//
+// source <(xml2csv completion bash)
+//
+// for zsh, put the output of "xml2csv completion zsh" in a file
+// named _xml2csv somewhere on your $fpath; for fish:
+//
+// xml2csv completion fish > ~/.config/fish/completions/xml2csv.fish
+
+func completionSetup(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usagef("completion needs one of: bash, zsh, fish")
+		}
+		subs := subcommands()
+		switch args[0] {
+		case "bash":
+			bashCompletion(os.Stdout, subs)
+		case "zsh":
+			zshCompletion(os.Stdout, subs)
+		case "fish":
+			fishCompletion(os.Stdout, subs)
+		default:
+			return usagef("no completion for shell '%v'; use bash, zsh, or fish", args[0])
+		}
+		return nil
+	}
+}
+
+// compFlag is one flag, as offered for completion.
+type compFlag struct {
+	name   string // with its dashes: -i or --input
+	usage  string
+	isBool bool
+}
+
+// compFlags returns the flags of sub. One letter flags get
+// one dash, and longer ones two, as the README writes them.
+func compFlags(sub subcommand) (r []compFlag) {
+	fs, _ := sub.flagSet()
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := compFlag{name: "--" + f.Name, usage: f.Usage}
+		if len(f.Name) == 1 {
+			cf.name = "-" + f.Name
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.isBool = true
+		}
+		r = append(r, cf)
+	})
+	return
+}
+
+func flagNames(flags []compFlag) string {
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.name)
+	}
+	return strings.Join(names, " ")
+}
+
+func bashCompletion(w io.Writer, subs []subcommand) {
+	var names []string
+	for _, sub := range subs {
+		names = append(names, sub.name)
+	}
+	fmt.Fprintf(w, `# bash completion for xml2csv
+_xml2csv() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local sub=convert flags
+    local subs="%v"
+    if [[ $COMP_CWORD -gt 1 ]] && [[ " $subs " == *" ${COMP_WORDS[1]} "* ]]; then
+        sub=${COMP_WORDS[1]}
+    fi
+    case $sub in
+`, strings.Join(names, " "))
+	for _, sub := range subs {
+		fmt.Fprintf(w, "        %v) flags=\"%v\" ;;\n", sub.name, flagNames(compFlags(sub)))
+	}
+	fmt.Fprintf(w, `    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "$subs" -- "$cur"))
+    fi
+}
+complete -o default -F _xml2csv xml2csv
+`)
+}
+
+// zshQuote escapes s for use inside a single quoted _arguments spec.
+func zshQuote(s string) string {
+	s = strings.ReplaceAll(s, `'`, `'\''`)
+	s = strings.ReplaceAll(s, `[`, `\[`)
+	s = strings.ReplaceAll(s, `]`, `\]`)
+	return strings.ReplaceAll(s, `:`, `\:`)
+}
+
+func zshCompletion(w io.Writer, subs []subcommand) {
+	fmt.Fprintf(w, "#compdef xml2csv\n\n")
+	for _, sub := range subs {
+		fmt.Fprintf(w, "_xml2csv_%v() {\n    _arguments \\\n", sub.name)
+		for _, f := range compFlags(sub) {
+			if f.isBool {
+				fmt.Fprintf(w, "        '%v[%v]' \\\n", f.name, zshQuote(f.usage))
+			} else {
+				fmt.Fprintf(w, "        '%v[%v]:value:_files' \\\n", f.name, zshQuote(f.usage))
+			}
+		}
+		fmt.Fprintf(w, "        '*:file:_files'\n}\n\n")
+	}
+	fmt.Fprintf(w, "_xml2csv() {\n    local -a subs\n    subs=(\n")
+	for _, sub := range subs {
+		fmt.Fprintf(w, "        '%v:%v'\n", sub.name, zshQuote(sub.about))
+	}
+	fmt.Fprintf(w, `    )
+    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+        _describe subcommand subs
+        _files
+        return
+    fi
+    if (( ${subs[(I)$words[2]:*]} )); then
+        shift words
+        (( CURRENT-- ))
+        _xml2csv_$words[1]
+    else
+        _xml2csv_convert
+    fi
+}
+
+_xml2csv "$@"
+`)
+}
+
+// fishQuote escapes s for use inside a single quoted fish string.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `'`, `\'`)
+}
+
+func fishCompletion(w io.Writer, subs []subcommand) {
+	var names []string
+	for _, sub := range subs {
+		names = append(names, sub.name)
+	}
+	fmt.Fprintf(w, "# fish completion for xml2csv\n")
+	for _, sub := range subs {
+		fmt.Fprintf(w, "complete -c xml2csv -n __fish_use_subcommand -a %v -d '%v'\n", sub.name, fishQuote(sub.about))
+	}
+	for _, sub := range subs {
+		// convert's flags also apply when no subcommand is given.
+		cond := fmt.Sprintf("'__fish_seen_subcommand_from %v'", sub.name)
+		if sub.name == "convert" {
+			cond = fmt.Sprintf("'not __fish_seen_subcommand_from %v'", strings.Join(names[1:], " "))
+		}
+		for _, f := range compFlags(sub) {
+			opt := "-l " + strings.TrimPrefix(f.name, "--")
+			if len(f.name) == 2 {
+				opt = "-s " + f.name[1:]
+			}
+			req := " -r"
+			if f.isBool {
+				req = ""
+			}
+			fmt.Fprintf(w, "complete -c xml2csv -n %v %v%v -d '%v'\n", cond, opt, req, fishQuote(f.usage))
+		}
+	}
+	fmt.Fprintf(w, "complete -c xml2csv -n '__fish_seen_subcommand_from completion' -f -a 'bash zsh fish'\n")
+}
@@ -0,0 +1,43 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressWriter wraps w so that everything written is compressed
+// with the named method ("gzip" or "zstd"). Closing the returned
+// writer finishes the compressed stream and then closes w.
+func compressWriter(w io.WriteCloser, method string) (io.WriteCloser, error) {
+	switch method {
+	case "gzip":
+		return &compWriter{WriteCloser: gzip.NewWriter(w), under: w}, nil
+
+	case "zstd":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &compWriter{WriteCloser: zw, under: w}, nil
+	}
+	return w, nil
+}
+
+type compWriter struct {
+	io.WriteCloser
+	under io.Closer
+}
+
+func (c *compWriter) Close() (err error) {
+	err = c.WriteCloser.Close()
+	err2 := c.under.Close()
+	if err == nil {
+		err = err2
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type bufCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestCompressWriter(t *testing.T) {
+	text := strings.Repeat("a,b,c\n\"1\",\"2\",\"3\"\n", 1000)
+	for _, method := range []string{"", "gzip", "zstd"} {
+		var out bufCloser
+		w, err := compressWriter(&out, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, text)
+		if err := w.Close(); err != nil {
+			t.Errorf("%q: %v", method, err)
+		}
+		if !out.closed {
+			t.Errorf("%q: the output was not closed", method)
+		}
+		if method != "" && out.Len() >= len(text) {
+			t.Errorf("%q: %v bytes is no smaller than the %v written", method, out.Len(), len(text))
+		}
+		rc, err := decompress(io.NopCloser(&out.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(rc)
+		if string(got) != text {
+			t.Errorf("%q: does not decompress to what was written", method)
+		}
+	}
+}
+
+type failWriter struct{ closed bool }
+
+func (f *failWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+func (f *failWriter) Close() error                { f.closed = true; return nil }
+
+// An output that fails part way gives its error, and is still closed.
+func TestCompressWriterFails(t *testing.T) {
+	for _, method := range []string{"gzip", "zstd"} {
+		out := &failWriter{}
+		w, err := compressWriter(out, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if _, err = io.WriteString(w, strings.Repeat("x", 1<<16)); err != nil {
+				break
+			}
+		}
+		err2 := w.Close()
+		if err == nil && err2 == nil {
+			t.Errorf("%v: no error from an output that fails", method)
+		}
+		if !out.closed {
+			t.Errorf("%v: the output was not closed", method)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfig is read from the current directory, if present,
+// when no -config file is named.
+const defaultConfig = ".xml2csv.yaml"
+
+// A config file lets a team commit a reproducible conversion spec,
+// instead of a long command line. Its keys are simply our flag names,
+// and "inputs" lists the input files or glob patterns. For example:
+//
+//	inputs:
+//	  - "feeds/**/*.xml"
+//	combine: true
+//	o: catalog.csv
+//	compress: gzip
+//
+// A flag given on the command line overrides the config file.
+
+// loadConfig reads the YAML config file at path, and sets each flag in fs
+// that was not already set on the command line. It returns the inputs
+// listed in the file. With required false, a missing file is not an error.
+func loadConfig(fs *flag.FlagSet, path string, required bool) (inputs []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var conf map[string]interface{}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	// set in sorted order, so errors come out the same every time.
+	var keys []string
+	for k := range conf {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		vals := configValues(conf[k])
+		if k == "inputs" {
+			inputs = vals
+			continue
+		}
+		if fs.Lookup(k) == nil {
+			return nil, usagef("%v: unknown setting '%v'", path, k)
+		}
+		if given[k] {
+			continue
+		}
+		// a list sets a repeatable flag once per element.
+		for _, v := range vals {
+			if err := fs.Set(k, v); err != nil {
+				return nil, usagef("%v: bad value for '%v': %v", path, k, err)
+			}
+		}
+	}
+	return
+}
+
+// configValues turns a scalar or list from the config file into strings.
+func configValues(v interface{}) (r []string) {
+	switch x := v.(type) {
+	case []interface{}:
+		for _, e := range x {
+			r = append(r, fmt.Sprint(e))
+		}
+	case nil:
+	default:
+		r = append(r, fmt.Sprint(x))
+	}
+	return
+}
@@ -0,0 +1,143 @@
+// Package xml2csv converts XML to csv, and to the other formats of
+// Options.Format, without a schema: each record element becomes a
+// row, with a column for each path within it. The xml2csv command,
+// in cmd/xml2csv, is Main; Convert does what it does for one input,
+// in process, from an io.Reader to an io.Writer.
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"io"
+)
+
+// Stats tells what Convert did.
+type Stats struct {
+	Records      int      // records written: rows, objects, or messages
+	Columns      []string // the header, as renamed; none for Format json
+	BytesRead    int64    // of the XML, from r, compressed or not
+	BytesWritten int64    // to w, compressed or not
+}
+
+// Convert converts the XML read from r, as the convert command does,
+// writing the csv, or whatever opts.Format is, to w. As with stdin,
+// gzip, zstd, or bzip2 compressed XML is decompressed. The zero Options
+// give the command's defaults. The outputs that need a file of their
+// own, or a database, can't be written to w: Format duckdb, a DSN,
+// parts split by MaxRows or MaxBytes, SplitDocs, SplitRecords,
+// Relational, and the files of BQSchema, JSONSchema, and DataPackage.
+// The records that fail an XSD go to opts.Rejects, or stderr.
+func Convert(r io.Reader, w io.Writer, opts Options) (Stats, error) {
+	return ConvertContext(context.Background(), r, w, opts)
+}
+
+// ConvertContext is Convert, but stops once ctx is done, returning
+// ctx.Err(), and leaving what it wrote to w unfinished. It checks ctx
+// between reads of r, so a read that blocks holds it up; close r to
+// end one, or give a reader that ctx stops.
+func ConvertContext(ctx context.Context, r io.Reader, w io.Writer, opts Options) (stats Stats, err error) {
+	o := &opts
+	if err := o.validate(); err != nil {
+		return stats, err
+	}
+	switch {
+	case o.database():
+		return stats, usagef("Convert writes to w, so cannot load a database, as Format duckdb or a DSN does")
+	case o.MaxRows > 0 || o.MaxBytes > 0 || o.SplitDocs || o.SplitRecords || o.Relational:
+		return stats, usagef("Convert writes to w, so cannot split the output, as MaxRows, MaxBytes, SplitDocs, SplitRecords, and Relational do")
+	case o.BQSchema || o.JSONSchema || o.DataPackage:
+		return stats, usagef("Convert writes to w, so has no output file to name a BQSchema, JSONSchema, or DataPackage after")
+	}
+
+	cr := &countingReader{r: r, ctx: ctx}
+	cw := &countingWriter{w: w}
+	in, err := decompress(io.NopCloser(cr))
+	if err != nil {
+		return stats, err
+	}
+	defer in.Close()
+	wc, err := compressWriter(nopWriteCloser{cw}, o.Compress)
+	if err != nil {
+		return stats, err
+	}
+	sink, err := newSink(wc, "", o)
+	if err != nil {
+		return stats, err
+	}
+	err = convert(ctx, in, withStats(sink, &stats), o)
+	err2 := sink.close()
+	if err == nil {
+		err = err2
+	}
+	stats.BytesRead, stats.BytesWritten = cr.n, cw.n
+	return stats, err
+}
+
+// withStats wraps sink so that it notes the header and records in stats.
+func withStats(sink rowSink, stats *Stats) rowSink {
+	s := &statsSink{rowSink: sink, stats: stats}
+	if rs, ok := sink.(recordSink); ok {
+		return &statsRecordSink{statsSink: s, rs: rs}
+	}
+	return s
+}
+
+type statsSink struct {
+	rowSink
+	stats *Stats
+}
+
+func (s *statsSink) header(names, types []string) error {
+	s.stats.Columns = names
+	return s.rowSink.header(names, types)
+}
+
+func (s *statsSink) row(cells []cell) error {
+	s.stats.Records++
+	return s.rowSink.row(cells)
+}
+
+// statsRecordSink is a statsSink for a recordSink, as for Format json.
+type statsRecordSink struct {
+	*statsSink
+	rs recordSink
+}
+
+func (s *statsRecordSink) record(rec *Tag) error {
+	s.stats.Records++
+	return s.rs.record(rec)
+}
+
+func (s *statsRecordSink) repeats(first *Tag) {
+	s.rs.repeats(first)
+}
+
+// countingReader counts what is read from r, until ctx is done.
+type countingReader struct {
+	r   io.Reader
+	ctx context.Context
+	n   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts what is written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
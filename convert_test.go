@@ -0,0 +1,149 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// convertTo converts in to the file name, in a new directory, as the
+// command does, and returns the directory, for what it writes beside.
+func convertTo(t *testing.T, in, name string, opts Options) string {
+	t.Helper()
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := convertToFile(strings.NewReader(in), filepath.Join(dir, name), &opts); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+const catalogXML = `<?xml version="1.0"?>
+<catalog>
+  <book id="b1">
+    <title>Go &amp; XML</title>
+    <price>12.50</price>
+    <author><name>Ann</name></author>
+  </book>
+  <book id="b2">
+    <title><![CDATA[A <b> tale]]></title>
+    <price>8</price>
+    <author><name>Bob</name></author>
+  </book>
+</catalog>
+`
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		what string
+		opts Options
+		want string
+	}{
+		{"csv", Options{}, `author_name,price,title
+"Ann","12.50","Go & XML"
+"Bob","8","A <b> tale"
+`},
+		{"types row", Options{Quote: "minimal", TypesRow: true}, `author_name,price,title
+string,decimal,string
+Ann,12.50,Go & XML
+Bob,8,A <b> tale
+`},
+		{"jsonl", Options{Format: "jsonl"}, `{"author_name":"Ann","price":"12.50","title":"Go & XML"}
+{"author_name":"Bob","price":"8","title":"A <b> tale"}
+`},
+		{"json", Options{Format: "json"}, `[{"@id":"b1","title":"Go & XML","price":"12.50","author":{"name":"Ann"}},
+{"@id":"b2","title":"A <b> tale","price":"8","author":{"name":"Bob"}}
+]
+`},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		stats, err := Convert(strings.NewReader(catalogXML), &out, c.opts)
+		if err != nil {
+			t.Errorf("%v: %v", c.what, err)
+			continue
+		}
+		if out.String() != c.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.what, out.String(), c.want)
+		}
+		if stats.Records != 2 {
+			t.Errorf("%v: %v records, want 2", c.what, stats.Records)
+		}
+		if stats.BytesRead != int64(len(catalogXML)) || stats.BytesWritten != int64(out.Len()) {
+			t.Errorf("%v: read %v and wrote %v bytes, want %v and %v", c.what, stats.BytesRead, stats.BytesWritten, len(catalogXML), out.Len())
+		}
+	}
+}
+
+func TestConvertStats(t *testing.T) {
+	stats, err := Convert(strings.NewReader(catalogXML), io.Discard, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"author_name", "price", "title"}
+	if !reflect.DeepEqual(stats.Columns, want) {
+		t.Errorf("columns %v, want %v", stats.Columns, want)
+	}
+}
+
+// Streaming gives the same csv as reading it all first.
+func TestConvertStream(t *testing.T) {
+	var all, streamed bytes.Buffer
+	if _, err := Convert(strings.NewReader(catalogXML), &all, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Convert(strings.NewReader(catalogXML), &streamed, Options{Stream: true}); err != nil {
+		t.Fatal(err)
+	}
+	if all.String() != streamed.String() {
+		t.Errorf("streamed\n%v\nbut all at once\n%v", streamed.String(), all.String())
+	}
+}
+
+func TestConvertWarnings(t *testing.T) {
+	in := `<r><p><a>1</a></p><p><a>2</b></p><p><a>3</a></p></r>`
+	var out, warnings bytes.Buffer
+	stats, err := Convert(strings.NewReader(in), &out, Options{Lenient: true, Warnings: &warnings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 2 {
+		t.Errorf("%v records, want 2, without the broken one", stats.Records)
+	}
+	if !strings.Contains(warnings.String(), "leaving out the broken record") {
+		t.Errorf("warnings %q do not tell of the broken record", warnings.String())
+	}
+
+	if _, err := Convert(strings.NewReader(in), &out, Options{}); err == nil {
+		t.Errorf("no error for the mismatched tags without Lenient")
+	}
+	if _, err := Convert(strings.NewReader(`<r><p><a>1</a></p>`), &out, Options{}); err == nil {
+		t.Errorf("no error for input that ends inside the root")
+	}
+}
+
+func TestConvertContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ConvertContext(ctx, strings.NewReader(catalogXML), io.Discard, Options{})
+	if err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConvertUnwritable(t *testing.T) {
+	for _, opts := range []Options{{Format: "duckdb"}, {MaxRows: 10}, {SplitDocs: true}, {JSONSchema: true}} {
+		if _, err := Convert(strings.NewReader(catalogXML), io.Discard, opts); err == nil {
+			t.Errorf("no error for %+v, which can't be written to one writer", opts)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"strings"
+)
+
+// The csv we write follows RFC 4180: a field is put in double quotes
+// when it holds the delimiter (a comma, unless Options.Delimiter says
+// otherwise), a double quote, or a line break, and any
+// double quote in it is doubled. Beyond that, every field with a value
+// is quoted, while one with no value is left bare, so that a missing
+// element can be told apart from an empty one. Options.Quote can ask
+// for minimal quoting instead, or none at all.
+
+// cell is one field of a csv row.
+type cell struct {
+	value string
+
+	// quoted fields always get quotes. The rest, the fields with no
+	// value, or the NilString of an xsi:nil element, only get them
+	// when their value needs them.
+	quoted bool
+
+	// null marks the field of an xsi:nil element, which the formats
+	// with a null of their own, like jsonl, write as that.
+	null bool
+}
+
+// empty reports whether c has nothing to write: the record lacks the
+// element, or it is xsi:nil, with no NilString to write for it.
+func (c cell) empty() bool {
+	return c.value == "" && !c.quoted
+}
+
+// csvHeader formats the header line, naming the columns.
+func csvHeader(names []string, opts *Options) string {
+	delim := opts.delimiter()
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteRune(delim)
+		}
+		writeField(&b, name, false, opts)
+	}
+	return b.String()
+}
+
+// csvRow formats one row.
+func csvRow(cells []cell, opts *Options) string {
+	delim := opts.delimiter()
+	var b strings.Builder
+	for i, c := range cells {
+		if i > 0 {
+			b.WriteRune(delim)
+		}
+		if c.empty() {
+			// no value at all: the record lacks the element.
+			c.value = opts.NullString
+		}
+		writeField(&b, lineBreaks(c.value, opts), c.quoted, opts)
+	}
+	if b.Len() == 0 && len(cells) == 1 {
+		// a blank line would be skipped by csv readers, losing the row.
+		return `""`
+	}
+	return b.String()
+}
+
+// lineBreaks handles the line breaks in a value as opts.Newlines says:
+// escaped as \n, replaced by spaces, or else kept, and quoted.
+func lineBreaks(s string, opts *Options) string {
+	if !strings.ContainsAny(s, "\r\n") {
+		return s
+	}
+	switch opts.Newlines {
+	case "escape":
+		return crlfReplacer(`\n`).Replace(s)
+	case "space":
+		return crlfReplacer(" ").Replace(s)
+	}
+	return s
+}
+
+// crlfReplacer replaces each line break, whether "\r\n", "\n" or "\r", by s.
+func crlfReplacer(s string) *strings.Replacer {
+	return strings.NewReplacer("\r\n", s, "\n", s, "\r", s)
+}
+
+// writeField writes s to b, in quotes if quoted, or if it needs them.
+// With minimal quoting, only a quoted "" is quoted regardless, to
+// tell it apart from a missing value, as PostgreSQL does; with
+// none, nothing is.
+func writeField(b *strings.Builder, s string, quoted bool, opts *Options) {
+	needs := strings.ContainsRune(s, opts.delimiter()) || strings.ContainsAny(s, "\"\r\n")
+	switch opts.Quote {
+	case "never":
+		quoted = false
+	case "minimal":
+		quoted = needs || (quoted && s == "")
+	default:
+		quoted = quoted || needs
+	}
+	if !quoted {
+		b.WriteString(s)
+		return
+	}
+	b.WriteByte('"')
+	b.WriteString(esc(s))
+	b.WriteByte('"')
+}
+
+// parseDelimiter reads the -delimiter flag: one character,
+// or one of the names tab, comma, pipe, or semicolon.
+func parseDelimiter(s string) (rune, error) {
+	switch strings.ToLower(s) {
+	case "tab", `\t`:
+		return '\t', nil
+	case "comma":
+		return ',', nil
+	case "pipe":
+		return '|', nil
+	case "semicolon":
+		return ';', nil
+	}
+	r := []rune(s)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' {
+		return 0, usagef("-delimiter must be one character, other than a quote or line break, or tab, comma, pipe, or semicolon; not '%v'", s)
+	}
+	return r[0], nil
+}
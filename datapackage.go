@@ -0,0 +1,130 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// -datapackage writes, next to the csv, as out.datapackage.json for
+// out.csv, a Frictionless Data Package describing it, for Frictionless
+// (formerly Goodtables), OpenRefine and the like: one tabular resource,
+// the csv, with its dialect, and a Table Schema of its fields, typed as
+// -types-row infers them, and required if no record lacks a value.
+
+// dataPackageJSON is the package, of the one resource.
+type dataPackageJSON struct {
+	Profile   string             `json:"profile"`
+	Name      string             `json:"name"`
+	Resources []dataResourceJSON `json:"resources"`
+}
+
+type dataResourceJSON struct {
+	Profile   string          `json:"profile"`
+	Name      string          `json:"name"`
+	Path      string          `json:"path"`
+	Format    string          `json:"format"`
+	Mediatype string          `json:"mediatype"`
+	Encoding  string          `json:"encoding"`
+	Dialect   dataDialectJSON `json:"dialect"`
+	Schema    tableSchemaJSON `json:"schema"`
+}
+
+type dataDialectJSON struct {
+	Delimiter      string `json:"delimiter"`
+	LineTerminator string `json:"lineTerminator"`
+	QuoteChar      string `json:"quoteChar"`
+	DoubleQuote    bool   `json:"doubleQuote"`
+	Header         bool   `json:"header"`
+}
+
+type tableSchemaJSON struct {
+	Fields        []tableFieldJSON `json:"fields"`
+	MissingValues []string         `json:"missingValues"`
+}
+
+type tableFieldJSON struct {
+	Name        string               `json:"name"`
+	Type        string               `json:"type"`
+	Format      string               `json:"format,omitempty"`
+	Constraints *tableConstraintJSON `json:"constraints,omitempty"`
+}
+
+type tableConstraintJSON struct {
+	Required bool `json:"required"`
+}
+
+// dataPackage returns the Data Package describing the csv of s.
+func dataPackage(s *schemaSink) ([]byte, error) {
+	file := filepath.Base(s.path)
+	base, _ := splitCsvExt(file)
+	name := dataPackageName(base)
+
+	schema := tableSchemaJSON{Fields: []tableFieldJSON{}, MissingValues: []string{""}}
+	for i, col := range s.names {
+		f := tableFieldJSON{Name: col, Type: tableType(s.types[i], s.shapes[i])}
+		if f.Type == "datetime" {
+			f.Format = "any" // the default takes only UTC, and no plain dates.
+		}
+		if s.shapes[i].filled == s.rows {
+			f.Constraints = &tableConstraintJSON{Required: true}
+		}
+		schema.Fields = append(schema.Fields, f)
+	}
+	pkg := dataPackageJSON{
+		Profile: "tabular-data-package",
+		Name:    name,
+		Resources: []dataResourceJSON{{
+			Profile:   "tabular-data-resource",
+			Name:      name,
+			Path:      file,
+			Format:    "csv",
+			Mediatype: "text/csv",
+			Encoding:  "utf-8",
+			Dialect: dataDialectJSON{
+				Delimiter:      string(s.opts.delimiter()),
+				LineTerminator: string(s.opts.newline()),
+				QuoteChar:      `"`,
+				DoubleQuote:    true,
+				Header:         !s.opts.NoHeader,
+			},
+			Schema: schema,
+		}},
+	}
+	return json.MarshalIndent(pkg, "", "  ")
+}
+
+// tableType returns the Table Schema type of a column of type typ,
+// shaped as shape.
+func tableType(typ string, shape columnShape) string {
+	switch typ {
+	case typeInteger:
+		return "integer"
+	case typeDecimal:
+		return "number"
+	case typeDate:
+		if shape.time {
+			return "datetime"
+		}
+		return "date"
+	}
+	return "string"
+}
+
+// dataPackageName makes name one that a Data Package allows: lower
+// case letters, digits, and -._ only.
+func dataPackageName(name string) string {
+	b := []byte(strings.ToLower(name))
+	for i, c := range b {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "data"
+	}
+	return string(b)
+}
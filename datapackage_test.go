@@ -0,0 +1,74 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDataPackage(t *testing.T) {
+	in := `<r>
+  <p><n>1</n><d>1.5</d><day>2023-01-02</day><at>2023-01-02T03:04:05Z</at><s>x</s></p>
+  <p><n>-2</n><d>2</d><day>2023-02-03</day><at>2023-01-02</at><s></s></p>
+</r>`
+	dir := convertTo(t, in, "My Books.tsv", Options{Delimiter: '\t', CRLF: true, DataPackage: true})
+	b, err := os.ReadFile(filepath.Join(dir, "My Books.datapackage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got dataPackageJSON
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	required := &tableConstraintJSON{Required: true}
+	want := dataPackageJSON{
+		Profile: "tabular-data-package",
+		Name:    "my_books",
+		Resources: []dataResourceJSON{{
+			Profile:   "tabular-data-resource",
+			Name:      "my_books",
+			Path:      "My Books.tsv",
+			Format:    "csv",
+			Mediatype: "text/csv",
+			Encoding:  "utf-8",
+			Dialect: dataDialectJSON{
+				Delimiter:      "\t",
+				LineTerminator: "\r\n",
+				QuoteChar:      `"`,
+				DoubleQuote:    true,
+				Header:         true,
+			},
+			Schema: tableSchemaJSON{
+				Fields: []tableFieldJSON{
+					{"at", "datetime", "any", required},
+					{"d", "number", "", required},
+					{"day", "date", "", required},
+					{"n", "integer", "", required},
+					{"s", "string", "", nil},
+				},
+				MissingValues: []string{""},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%+v", b, want)
+	}
+}
+
+func TestDataPackageName(t *testing.T) {
+	for in, want := range map[string]string{
+		"books":       "books",
+		"My Books":    "my_books",
+		"feed-2023.1": "feed-2023.1",
+		"":            "data",
+	} {
+		if got := dataPackageName(in); got != want {
+			t.Errorf("dataPackageName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// xml2csv schema -ddl postgres|mysql|sqlite prints a CREATE TABLE for
+// the csv's columns, typed as -types-row infers them, so a table can be
+// made ready to load the csv into. Every column is nullable, since any
+// record may lack it. A date column whose values all lack a time of
+// day is a DATE, and otherwise a timestamp. SQLite has no date types,
+// so its dates are TEXT, which its date functions read.
+
+// ddlType is a column's type, refined for the DDL.
+type ddlType struct {
+	typ  string
+	time bool // a date column with a time of day
+}
+
+// ddlTypes infers the types of the columns of cs from the records of tree.
+func ddlTypes(tree *Tag, cs *colset) []ddlType {
+	types := columnTypes(tree, cs)
+	r := make([]ddlType, len(types))
+	for i, typ := range types {
+		r[i].typ = typ
+	}
+	for rec := tree.firstChild; rec != nil; rec = rec.nextSib {
+		for i, c := range csvCells(rec.firstChild, cs) {
+			if r[i].typ == typeDate && c.quoted && len(c.value) > len("2006-01-02") {
+				r[i].time = true
+			}
+		}
+	}
+	return r
+}
+
+// sqlType returns t as a column type of dialect.
+func (t ddlType) sqlType(dialect string) string {
+	switch dialect {
+	case "postgres":
+		switch {
+		case t.typ == typeDecimal:
+			return "NUMERIC"
+		case t.typ == typeInteger:
+			return "BIGINT"
+		case t.time:
+			return "TIMESTAMPTZ"
+		case t.typ == typeDate:
+			return "DATE"
+		}
+	case "mysql":
+		switch {
+		case t.typ == typeInteger:
+			return "BIGINT"
+		case t.typ == typeDecimal:
+			return "DOUBLE"
+		case t.time:
+			return "DATETIME"
+		case t.typ == typeDate:
+			return "DATE"
+		}
+	case "sqlite":
+		switch {
+		case t.typ == typeInteger:
+			return "INTEGER"
+		case t.typ == typeDecimal:
+			return "REAL"
+		}
+	}
+	return "TEXT"
+}
+
+// createTable returns the CREATE TABLE statement, in dialect, for
+// a table of the columns of cs, typed as types says.
+func createTable(dialect, table string, cs *colset, types []ddlType) string {
+	quote := sqlIdent
+	if dialect == "mysql" {
+		quote = func(name string) string {
+			return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %v (\n", quote(table))
+	for i, name := range cs.header {
+		fmt.Fprintf(&b, "    %v %v", quote(name), types[i].sqlType(dialect))
+		if i < len(cs.header)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(");\n")
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// typesXML has a column of each type, dates with and without a time
+// of day and a zone, a whole number too big for 64 bits, which is a
+// string, and a column the second record lacks.
+const typesXML = `<r>
+  <p><n>1</n><big>123456789012345678901234</big><d>1.5</d><day>2023-01-02</day><at>2023-01-02T03:04:05Z</at><s>x</s></p>
+  <p><n>-2</n><big>1</big><d>2</d><day>2023-02-03</day><at>2023-01-02T03:04:05</at></p>
+</r>`
+
+// schemaDoc parses in, and gives its columns, as xml2csv schema does.
+func schemaDoc(t *testing.T, in string) (*doc, *colset) {
+	t.Helper()
+	opts := &Options{}
+	d, err := parse(context.Background(), strings.NewReader(in), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, newColset(d, opts)
+}
+
+func TestCreateTable(t *testing.T) {
+	d, cs := schemaDoc(t, typesXML)
+	types := ddlTypes(d.tree, cs)
+	cases := []struct {
+		dialect, table, want string
+	}{
+		{"postgres", `my"t`, `CREATE TABLE "my""t" (
+    "at" TIMESTAMPTZ,
+    "big" TEXT,
+    "d" NUMERIC,
+    "day" DATE,
+    "n" BIGINT,
+    "s" TEXT
+);
+`},
+		{"mysql", "my`t", "CREATE TABLE `my``t` (\n" +
+			"    `at` DATETIME,\n" +
+			"    `big` TEXT,\n" +
+			"    `d` DOUBLE,\n" +
+			"    `day` DATE,\n" +
+			"    `n` BIGINT,\n" +
+			"    `s` TEXT\n" +
+			");\n"},
+		{"sqlite", "records", `CREATE TABLE "records" (
+    "at" TEXT,
+    "big" TEXT,
+    "d" REAL,
+    "day" TEXT,
+    "n" INTEGER,
+    "s" TEXT
+);
+`},
+	}
+	for _, c := range cases {
+		if got := createTable(c.dialect, c.table, cs, types); got != c.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.dialect, got, c.want)
+		}
+	}
+}
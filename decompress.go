@@ -0,0 +1,87 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressedExts are the file extensions we recognize on
+// compressed input, as in "dump.xml.gz".
+var compressedExts = []string{".gz", ".bz2", ".zst"}
+
+// trimCompressedExt turns "dump.xml.gz" into "dump.xml".
+func trimCompressedExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, c := range compressedExts {
+		if ext == c {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// isXMLName reports whether name looks like an XML file,
+// possibly compressed.
+func isXMLName(name string) bool {
+	return strings.EqualFold(filepath.Ext(trimCompressedExt(name)), ".xml")
+}
+
+// decompress returns a reader that transparently decompresses gzip,
+// bzip2, or zstd input, as detected by its leading magic bytes.
+// Anything else is passed through unchanged. Closing the returned
+// reader closes rc.
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &decompReader{Reader: gz, under: rc}, nil
+
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return &decompReader{Reader: bzip2.NewReader(br), under: rc}, nil
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return &decompReader{Reader: zr, under: rc, stop: zr.Close}, nil
+	}
+	return &decompReader{Reader: br, under: rc}, nil
+}
+
+type decompReader struct {
+	io.Reader
+	under io.Closer
+	stop  func() // frees the decoder, if it needs that
+}
+
+func (r *decompReader) Close() error {
+	if r.stop != nil {
+		r.stop()
+	}
+	return r.under.Close()
+}
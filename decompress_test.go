@@ -0,0 +1,93 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// manyRecords is XML of n small records.
+func manyRecords(n int) string {
+	var b strings.Builder
+	b.WriteString("<r>\n")
+	for i := 0; i < n; i++ {
+		b.WriteString("  <p><a>some text to fill the record</a><b>12345</b></p>\n")
+	}
+	b.WriteString("</r>\n")
+	return b.String()
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	io.WriteString(w, s)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func zstded(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	w, err := zstd.NewWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, s)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	xml := manyRecords(100)
+	for what, in := range map[string][]byte{
+		"plain": []byte(xml),
+		"gzip":  gzipped(t, xml),
+		"zstd":  zstded(t, xml),
+	} {
+		rc, err := decompress(io.NopCloser(bytes.NewReader(in)))
+		if err != nil {
+			t.Errorf("%v: %v", what, err)
+			continue
+		}
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Errorf("%v: %v", what, err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Errorf("%v: close: %v", what, err)
+		}
+		if string(got) != xml {
+			t.Errorf("%v: got %v bytes that differ from the %v of the XML", what, len(got), len(xml))
+		}
+	}
+}
+
+// A conversion that stops early, here at MaxTags, must not leave the
+// decompression of the rest of its input hanging.
+func TestDecompressStopsEarly(t *testing.T) {
+	in := zstded(t, manyRecords(100000))
+	done := make(chan error, 1)
+	go func() {
+		_, err := Convert(bytes.NewReader(in), io.Discard, Options{MaxTags: 10})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "more than 10") {
+			t.Errorf("got %v, want the MaxTags error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the conversion hung after stopping early")
+	}
+}
@@ -0,0 +1,175 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// detectSample is how much of the input we look at
+// to find the record element, when -record is not given.
+var detectSample = 1 << 20
+
+// Without -record, the records are the children of the root, unless
+// they are plainly held deeper down, as the Product elements of an ONIX
+// file are within its one Products: of the elements that have children
+// of their own, the one that occurs the most, over the whole of the
+// sample, inside elements that occur just once within their parent, and
+// at least twice as often as the root has children. An element that
+// repeats within each record, like the authors of a book, never counts,
+// since the book it is in repeats as well. Anything less plain, like
+// three records next to a header, is left to -record; -v notes why no
+// records were found deeper down. With -stream, the input may
+// be arriving slowly through a pipe, and we can't wait for a sample, so
+// the records are the children of the root, unless -record says.
+
+// detectRecord looks at the start of the input to pick the records,
+// setting p.recordPath if they are not the children of the root.
+func (p *parser) detectRecord() error {
+	head := make([]byte, detectSample)
+	n, err := io.ReadFull(p.sc.r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	p.sc.r = bufio.NewReaderSize(io.MultiReader(bytes.NewReader(head), p.sc.r), 64<<10)
+
+	steps, count, why := heldRecords(p.ctx, head, p.opts)
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	if steps == nil {
+		p.opts.progressf("taking the children of the root as the records, since %v. Use -record to choose others.", why)
+		return nil
+	}
+	p.recordPath = steps
+	if p.opts.Fragment {
+		steps = steps[1:]
+	}
+	p.opts.warnf("note: taking '%v' as the records, since the first part of the input holds %v of them, within one '%v'. Use -record to choose others.\n",
+		strings.Join(steps, "/"), count, steps[len(steps)-2])
+	return nil
+}
+
+// heldRecords finds the records in the XML sample head, if they are
+// not the children of the root, returning their path, from the root,
+// and how many of them the sample holds. Of those that occur as often,
+// the shallowest wins. It returns nil if the records are the children
+// of the root, and why, for -v.
+func heldRecords(ctx context.Context, head []byte, opts *Options) (best []string, count int, why string) {
+	type frame struct {
+		path        string // from the root, joined by "/"
+		hasChildren bool
+	}
+	var stack []*frame
+	seen := make(map[string]int)    // how many of each path
+	parents := make(map[string]int) // ... of which have children
+	if opts.Fragment {
+		stack = append(stack, &frame{path: "*"})
+		seen["*"] = 1
+	}
+
+	sc := newScanner(bytes.NewReader(head), opts)
+	for n := 1; ; n++ {
+		t, err := sc.next()
+		if err != nil || t == nil {
+			// the sample may well end mid-tag.
+			break
+		}
+		if n%1024 == 0 && ctx.Err() != nil {
+			return nil, 0, "" // for detectRecord to report.
+		}
+		if t.isClose {
+			// close the match, and anything left open inside
+			// it; a close that matches nothing is ignored.
+			for i := len(stack) - 1; i >= 0; i-- {
+				if path.Base(stack[i].path) == t.name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+		if opts.HTML {
+			for len(stack) > 0 && impliedEnds[path.Base(stack[len(stack)-1].path)][t.name] {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		f := &frame{path: t.name}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			if !parent.hasChildren {
+				parent.hasChildren = true
+				parents[parent.path]++
+			}
+			f.path = parent.path + "/" + t.name
+		}
+		seen[f.path]++
+		if !t.selfClosed {
+			stack = append(stack, f)
+		}
+	}
+
+	rootKids := 0
+	for p, n := range seen {
+		if strings.Count(p, "/") == 1 {
+			rootKids += n
+		}
+	}
+	// before reports whether path p, of n, wins over q, of m.
+	before := func(p string, n int, q string, m int) bool {
+		if q == "" || n != m {
+			return n > m
+		}
+		if dp, dq := strings.Count(p, "/"), strings.Count(q, "/"); dp != dq {
+			return dp < dq
+		}
+		return p < q
+	}
+	// of those left out, the most common that are held as records
+	// would be, only too few, or else that repeat within one.
+	var few, within, inWhat string
+	fewN, withinN := 0, 0
+	for p, n := range parents {
+		steps := strings.Split(p, "/")
+		if len(steps) < 3 {
+			continue
+		}
+		inside := ""
+		for i := 2; i < len(steps) && inside == ""; i++ {
+			if seen[strings.Join(steps[:i], "/")] > seen[strings.Join(steps[:i-1], "/")] {
+				inside = steps[i-1]
+			}
+		}
+		switch {
+		case inside != "":
+			if before(p, n, within, withinN) {
+				within, withinN, inWhat = p, n, inside
+			}
+		case n < 2*rootKids:
+			if before(p, n, few, fewN) {
+				few, fewN = p, n
+			}
+		case before(p, n, strings.Join(best, "/"), count):
+			best, count = steps, n
+		}
+	}
+	switch {
+	case best != nil:
+		why = ""
+	case few != "":
+		why = fmt.Sprintf("'%v', which could be the records, occurs %v times, not twice as often as the %v children of the root", strings.TrimPrefix(few, "*/"), fewN, rootKids)
+	case within != "":
+		why = fmt.Sprintf("'%v', the most common element with children deeper down, repeats within '%v', which repeats itself", strings.TrimPrefix(within, "*/"), inWhat)
+	default:
+		why = "no element with children repeats deeper down"
+	}
+	return best, count, why
+}
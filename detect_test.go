@@ -0,0 +1,87 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// products is an ONIX-ish message of n products.
+func products(n int) string {
+	var b strings.Builder
+	b.WriteString("<ONIX><Header><Sender>a</Sender></Header><Products>")
+	for i := 0; i < n; i++ {
+		b.WriteString("<Product><Title>t</Title><Author><Name>a</Name></Author><Author><Name>b</Name></Author></Product>")
+	}
+	b.WriteString("</Products></ONIX>")
+	return b.String()
+}
+
+func TestHeldRecords(t *testing.T) {
+	cases := []struct {
+		what, in string
+		want     string // the path of the records, or "" for the root's children
+		count    int
+		why      string
+	}{
+		{"onix", products(10), "ONIX/Products/Product", 10, ""},
+		{"few", products(3), "", 0, "'ONIX/Products/Product', which could be the records, occurs 3 times, not twice as often as the 2 children of the root"},
+		{"root children", `<r><p><a><b>1</b></a></p><p><a><b>2</b></a></p></r>`, "", 0, "'r/p/a', the most common element with children deeper down, repeats within 'p'"},
+		{"repeats within", `<r><b><a><n>1</n></a><a><n>2</n></a><a><n>3</n></a></b><b><a><n>4</n></a><a><n>5</n></a></b></r>`, "", 0, "'r/b/a', the most common element with children deeper down, repeats within 'b'"},
+		{"flat", `<r><p><a>1</a></p><p><a>2</a></p></r>`, "", 0, "no element with children repeats deeper down"},
+	}
+	for _, c := range cases {
+		steps, count, why := heldRecords(context.Background(), []byte(c.in), &Options{})
+		if strings.Join(steps, "/") != c.want || count != c.count {
+			t.Errorf("%v: got %v of %v, want %v of %v", c.what, count, strings.Join(steps, "/"), c.count, c.want)
+		}
+		if !strings.Contains(why, c.why) {
+			t.Errorf("%v: why %q, want it to say %q", c.what, why, c.why)
+		}
+	}
+}
+
+func TestDetectRecord(t *testing.T) {
+	var out, warnings bytes.Buffer
+	stats, err := Convert(strings.NewReader(products(10)), &out, Options{Warnings: &warnings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 10 {
+		t.Errorf("%v records, want the 10 products", stats.Records)
+	}
+	if !strings.Contains(warnings.String(), "note: taking 'ONIX/Products/Product' as the records") {
+		t.Errorf("no note of the records taken: %q", warnings.String())
+	}
+
+	// declined, it says why only with Verbose.
+	warnings.Reset()
+	if _, err := Convert(strings.NewReader(products(3)), &out, Options{Warnings: &warnings}); err != nil {
+		t.Fatal(err)
+	}
+	if warnings.Len() > 0 {
+		t.Errorf("unexpected warnings: %q", warnings.String())
+	}
+	if _, err := Convert(strings.NewReader(products(3)), &out, Options{Warnings: &warnings, Verbose: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warnings.String(), "taking the children of the root as the records, since") {
+		t.Errorf("no note of why with Verbose: %q", warnings.String())
+	}
+
+	// nor with -stream or -record.
+	warnings.Reset()
+	for _, opts := range []Options{{Stream: true}, {Record: "ONIX/Products"}} {
+		opts.Warnings = &warnings
+		if _, err := Convert(strings.NewReader(products(10)), &out, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if warnings.Len() > 0 {
+		t.Errorf("detected with -stream or -record: %q", warnings.String())
+	}
+}
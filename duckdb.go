@@ -0,0 +1,125 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// -format duckdb writes the rows into a table of a DuckDB database
+// file, creating the file and the table if need be, and otherwise
+// appending to the table, adding any columns it lacks. DuckDB's own
+// files are best written by DuckDB, so as for xmllint, we
+// lean on the duckdb tool: the rows go to a Parquet file next to the
+// database, which duckdb then loads, and which is then removed.
+
+// duckdbSink writes the rows into a DuckDB table, for -format duckdb.
+type duckdbSink struct {
+	*parquetSink
+	db    string
+	table string
+	tmp   string // the Parquet file
+}
+
+func newDuckDBSink(db string, opts *Options) (*duckdbSink, error) {
+	if db == "" || db == "-" || isRemote(db) {
+		return nil, usagef("-format duckdb needs a local database file (-o) to write to")
+	}
+	f, err := os.CreateTemp(filepath.Dir(db), ".xml2csv-*.parquet")
+	if err != nil {
+		return nil, err
+	}
+	return &duckdbSink{parquetSink: newParquetSink(f), db: db, table: opts.table(), tmp: f.Name()}, nil
+}
+
+func (s *duckdbSink) close() error {
+	defer os.Remove(s.tmp)
+	if err := s.parquetSink.close(); err != nil {
+		return err
+	}
+	if len(s.cols) == 0 {
+		return nil // no records, so nothing to make a table of.
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("duckdb", "-bail", s.db)
+	cmd.Stdin = strings.NewReader(s.sql())
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return fmt.Errorf("-format duckdb needs the duckdb tool on the PATH")
+	case err != nil:
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		return fmt.Errorf("could not load the rows into '%v': %v", s.db, msg)
+	}
+	return nil
+}
+
+// abort removes the Parquet file without loading it, leaving the
+// database as it was, for a conversion that failed.
+func (s *duckdbSink) abort() {
+	s.parquetSink.close()
+	os.Remove(s.tmp)
+}
+
+// aborter is a rowSink into a database, which abort closes without
+// changing the database, for a conversion that failed.
+type aborter interface {
+	abort()
+}
+
+// abortSink aborts sink if it is an aborter and err is a failure,
+// rather than an interruption, which keeps the records it got, as
+// for csv. It reports whether it did.
+func abortSink(sink rowSink, err error) bool {
+	a, ok := sink.(aborter)
+	if !ok || err == nil || errors.Is(err, errInterrupted) {
+		return false
+	}
+	a.abort()
+	return true
+}
+
+// sql creates the table, or adds any columns it lacks, and inserts
+// the rows, matching the columns by name, all or nothing.
+func (s *duckdbSink) sql() string {
+	var b strings.Builder
+	table := sqlIdent(s.table)
+	b.WriteString("BEGIN;\n")
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %v (", table)
+	for i, col := range s.cols {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%v %v", sqlIdent(col.name), duckdbType(col.typ))
+	}
+	b.WriteString(");\n")
+	for _, col := range s.cols {
+		fmt.Fprintf(&b, "ALTER TABLE %v ADD COLUMN IF NOT EXISTS %v %v;\n", table, sqlIdent(col.name), duckdbType(col.typ))
+	}
+	fmt.Fprintf(&b, "INSERT INTO %v BY NAME SELECT * FROM read_parquet('%v');\n", table, strings.ReplaceAll(s.tmp, "'", "''"))
+	b.WriteString("COMMIT;\n")
+	return b.String()
+}
+
+func duckdbType(typ string) string {
+	switch typ {
+	case typeInteger:
+		return "BIGINT"
+	case typeDecimal:
+		return "DOUBLE"
+	}
+	return "VARCHAR"
+}
+
+// sqlIdent quotes name as an SQL identifier.
+func sqlIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,93 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDuckDB notes what it is run with, and keeps the Parquet file
+// that it is to load, which xml2csv removes after.
+const fakeDuckDB = `d=$(dirname "$0")
+echo "$@" > "$d/args"
+cat > "$d/sql"
+cp "$(sed -n "s/.*read_parquet('\(.*\)');/\1/p" "$d/sql")" "$d/loaded.parquet"
+`
+
+func TestDuckDB(t *testing.T) {
+	tool := fakeTool(t, "duckdb", fakeDuckDB)
+	dir := convertTo(t, shopXML, "shop.duckdb", Options{Format: "duckdb", Table: "items"})
+	args, err := os.ReadFile(filepath.Join(tool, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-bail " + filepath.Join(dir, "shop.duckdb") + "\n"; string(args) != want {
+		t.Errorf("duckdb ran with %q, want %q", args, want)
+	}
+
+	sql, err := os.ReadFile(filepath.Join(tool, "sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `BEGIN;
+CREATE TABLE IF NOT EXISTS "items" ("added" VARCHAR, "price" DOUBLE, "qty" BIGINT, "sku" VARCHAR);
+ALTER TABLE "items" ADD COLUMN IF NOT EXISTS "added" VARCHAR;
+ALTER TABLE "items" ADD COLUMN IF NOT EXISTS "price" DOUBLE;
+ALTER TABLE "items" ADD COLUMN IF NOT EXISTS "qty" BIGINT;
+ALTER TABLE "items" ADD COLUMN IF NOT EXISTS "sku" VARCHAR;
+INSERT INTO "items" BY NAME SELECT * FROM read_parquet('PARQUET');
+COMMIT;
+`
+	start := strings.Index(string(sql), "read_parquet('") + len("read_parquet('")
+	end := strings.Index(string(sql), "');")
+	tmp := string(sql)[start:end]
+	if got := strings.Replace(string(sql), tmp, "PARQUET", 1); got != want {
+		t.Errorf("got the SQL\n%v\nwant\n%v", got, want)
+	}
+	if filepath.Dir(tmp) != dir {
+		t.Errorf("the Parquet file %v is not beside the database, in %v", tmp, dir)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("the Parquet file %v is left behind", tmp)
+	}
+
+	b, err := os.ReadFile(filepath.Join(tool, "loaded.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, columns := readParquet(t, b)
+	for _, c := range shopColumns {
+		if !reflect.DeepEqual(columns[c.name], c.values) {
+			t.Errorf("%v holds %v, want %v", c.name, columns[c.name], c.values)
+		}
+	}
+}
+
+func TestDuckDBFails(t *testing.T) {
+	fakeTool(t, "duckdb", `cat > /dev/null; echo 'Error: Catalog Error: no such table' >&2; echo more >&2; exit 1`)
+	dir := t.TempDir()
+	db := filepath.Join(dir, "shop.duckdb")
+	err := convertToFile(strings.NewReader(shopXML), db, &Options{Format: "duckdb"})
+	if want := "could not load the rows into '" + db + "': Error: Catalog Error: no such table"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Errorf("left %v behind", left)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	err = convertToFile(strings.NewReader(shopXML), db, &Options{Format: "duckdb"})
+	if err == nil || !strings.Contains(err.Error(), "needs the duckdb tool") {
+		t.Errorf("got %v without duckdb, want that it is needed", err)
+	}
+
+	err = convertToFile(strings.NewReader(shopXML), "-", &Options{Format: "duckdb"})
+	if err == nil || !strings.Contains(err.Error(), "needs a local database file") {
+		t.Errorf("got %v for stdout, want that a database file is needed", err)
+	}
+}
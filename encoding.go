@@ -0,0 +1,139 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// We tokenize UTF-8. Input in any other encoding is transcoded
+// to UTF-8 first: the encoding comes from -encoding if given, or
+// else from the encoding="..." of the <?xml ...?> declaration.
+// A byte order mark is stripped, and says what the encoding is; without
+// one, UTF-16 is still recognized from the first bytes, as in appendix F
+// of the XML spec.
+
+// transcode wraps s.r to decode the input into UTF-8,
+// if it is in some other encoding.
+func (s *scanner) transcode() error {
+	head := s.head()
+	bom, n := byteOrderMark(head)
+	if n > 0 {
+		s.r.Discard(n)
+		s.pos = n
+		head = head[n:]
+	}
+	name := s.encoding
+	switch {
+	case name != "":
+	case bom != "":
+		name = bom
+	default:
+		name = sniffEncoding(head)
+	}
+	if isUTF8(name) {
+		return nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		if s.encoding != "" {
+			return usagef("unsupported -encoding '%v'", name)
+		}
+		return mark{line: 1, col: 1}.errorf("unsupported encoding '%v'", name)
+	}
+	s.opts.progressf("transcoding from '%v'", name)
+	s.r = bufio.NewReaderSize(enc.NewDecoder().Reader(s.r), 64<<10)
+	s.transcoded = true
+	return nil
+}
+
+// head peeks at the start of the input, to find its encoding in: what
+// has arrived so far, up to 1024 bytes, and through the first '>', which
+// ends any <?xml ...?> declaration. It doesn't wait for more than that,
+// so that input arriving slowly through a pipe isn't held up.
+func (s *scanner) head() []byte {
+	s.r.Peek(1)
+	head, _ := s.r.Peek(intMin(s.r.Buffered(), 1024))
+	for len(head) < 1024 && bytes.IndexByte(head, '>') < 0 {
+		more, err := s.r.Peek(len(head) + 1)
+		if err != nil {
+			break
+		}
+		head = more
+	}
+	return head
+}
+
+func isUTF8(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+// byteOrderMark returns the encoding given by the byte order mark
+// at the start of head, and its length, if there is one.
+func byteOrderMark(head []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xef\xbb\xbf")):
+		return "utf-8", 3
+	case bytes.HasPrefix(head, []byte("\xff\xfe")):
+		return "utf-16le", 2
+	case bytes.HasPrefix(head, []byte("\xfe\xff")):
+		return "utf-16be", 2
+	}
+	return "", 0
+}
+
+// sniffEncoding guesses the encoding of the input from its first bytes.
+func sniffEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("<\x00?\x00")):
+		return "utf-16le"
+	case bytes.HasPrefix(head, []byte("\x00<\x00?")):
+		return "utf-16be"
+	}
+	name := declaredEncoding(head)
+	if strings.HasPrefix(strings.ToLower(name), "utf-16") {
+		// the declaration was readable one byte per character,
+		// so whatever it says, this isn't UTF-16.
+		return ""
+	}
+	return name
+}
+
+// declaredEncoding returns the encoding named in
+// <?xml version="1.0" encoding="ISO-8859-1"?>, if any.
+func declaredEncoding(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("<?xml")) {
+		return ""
+	}
+	end := bytes.Index(head, []byte("?>"))
+	if end < 0 {
+		return ""
+	}
+	decl := string(head[:end])
+	i := strings.Index(decl, "encoding")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(decl[i+len("encoding"):], " \t\r\n")
+	if !strings.HasPrefix(rest, "=") {
+		return ""
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\r\n")
+	if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+		return ""
+	}
+	q := strings.IndexByte(rest[1:], rest[0])
+	if q < 0 {
+		return ""
+	}
+	return rest[1 : 1+q]
+}
@@ -0,0 +1,142 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// The exit codes, so scripts can tell what went wrong.
+const (
+	exitOK      = 0
+	exitError   = 1 // anything not covered below
+	exitUsage   = 2 // bad flags or settings; package flag uses 2 as well
+	exitBadXML  = 3 // the input could not be parsed
+	exitIO      = 4 // a file or object could not be read or written
+	exitPartial = 5 // some files of a batch converted, but not all
+
+	exitInterrupted = 130 // stopped by Ctrl-C or SIGTERM, as shells report it
+)
+
+// ParseError reports XML that we could not make sense of.
+type ParseError struct {
+	File string // the input's name, if it has one
+	Line int    // from 1
+	Col  int    // in characters, from 1
+	Pos  int    // byte position in the input
+	Msg  string
+}
+
+// Error gives the position as file:line:column, as editors and
+// compilers do, so it can be jumped to.
+func (e *ParseError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%v:%v:%v: bad xml: %v", e.File, e.Line, e.Col, e.Msg)
+	}
+	return fmt.Sprintf("bad xml at %v: %v", mark{pos: e.Pos, line: e.Line, col: e.Col}, e.Msg)
+}
+
+// mark is a position in the input.
+type mark struct {
+	pos  int // in bytes, from 0
+	line int // from 1
+	col  int // in characters, from 1
+}
+
+func (m mark) String() string {
+	return fmt.Sprintf("line %v, column %v (byte %v)", m.line, m.col, m.pos)
+}
+
+func (m mark) errorf(format string, a ...interface{}) error {
+	return &ParseError{Line: m.line, Col: m.col, Pos: m.pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+// withFile says that err came from the input file path.
+func withFile(path string, err error) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) && parseErr.File == "" {
+		parseErr.File = path
+		return err
+	}
+	return fmt.Errorf("%v: %w", path, err)
+}
+
+// usageError reports flags or settings that don't make sense.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, a ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+// batchError reports that some of a batch of conversions failed.
+// The individual failures have already been reported.
+type batchError struct {
+	failed, total int
+	what          string // "files" or "archive members"
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("%v of %v %v failed to convert", e.failed, e.total, e.what)
+}
+
+// invalidError reports that validate found problems with the XML.
+// The problems themselves have already been listed.
+type invalidError struct {
+	problems, files int
+}
+
+func (e *invalidError) Error() string {
+	return fmt.Sprintf("found %v in %v", plural(e.problems, "problem"), plural(e.files, "file"))
+}
+
+// plural gives n and the noun, as in "1 file" and "2 files".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%v %vs", n, noun)
+}
+
+// exitCode picks the exit code that describes err.
+func exitCode(err error) int {
+	var parseErr *ParseError
+	var usageErr *usageError
+	var batchErr *batchError
+	var invalidErr *invalidError
+	var pathErr *fs.PathError
+	var exitErr *exec.ExitError
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errInterrupted):
+		return exitInterrupted
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &batchErr):
+		return exitPartial
+	case errors.As(err, &parseErr), errors.As(err, &invalidErr):
+		return exitBadXML
+	case errors.As(err, &pathErr), errors.As(err, &exitErr), errors.As(err, &errno):
+		return exitIO
+	}
+	return exitError
+}
+
+// exit reports err, if any, on stderr, and exits with its exit code.
+func exit(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xml2csv: %v\n", err)
+	}
+	os.Exit(exitCode(err))
+}
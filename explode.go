@@ -0,0 +1,127 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import "strings"
+
+// A record with several of the same child, like three <Contributor>
+// blocks, normally becomes one row with the columns Contributor_Name,
+// Contributor1_Name, Contributor2_Name, and so on. Exploding the
+// record on Contributor instead makes three rows of it, each with
+// one of the Contributors, and everything else in the record repeated.
+
+// explode splits rec on the elements at the path of steps from it:
+// rec keeps the first of them, and for each of the others, a copy of
+// rec that has just that one is returned. If carry names any paths,
+// the copies hold only what is at those, rather than all the rest of
+// the record.
+func explode(rec *Tag, steps, carry []string) (r []*Tag) {
+	parent := findPath(rec, steps[:len(steps)-1])
+	if parent == nil {
+		return nil
+	}
+	step := steps[len(steps)-1]
+	n := 0
+	for c := parent.firstChild; c != nil; c = c.nextSib {
+		if stepMatches(step, c.name) {
+			n++
+		}
+	}
+	for i := 1; i < n; i++ {
+		cp := deepCopy(rec)
+		keepOnly(findPath(cp, steps[:len(steps)-1]), step, i)
+		if len(carry) > 0 {
+			carryOnly(cp, steps, carry)
+		}
+		r = append(r, cp)
+	}
+	if n > 1 {
+		keepOnly(parent, step, 0)
+	}
+	return
+}
+
+// keepOnly removes the children of t that match step, but for the
+// one numbered keep, from 0.
+func keepOnly(t *Tag, step string, keep int) {
+	c := t.firstChild
+	t.firstChild, t.lastChild, t.numChild = nil, nil, 0
+	for i := 0; c != nil; {
+		next := c.nextSib
+		c.nextSib = nil
+		if !stepMatches(step, c.name) {
+			t.addChild(c)
+		} else {
+			if i == keep {
+				t.addChild(c)
+			}
+			i++
+		}
+		c = next
+	}
+}
+
+// carryOnly removes from the exploded copy rec all but the element at
+// the path of steps, what is at the carry paths, and the fields, like
+// _row, that were added to the record.
+func carryOnly(rec *Tag, steps, carry []string) {
+	paths := [][]string{steps}
+	for _, path := range carry {
+		paths = append(paths, strings.Split(path, "/"))
+	}
+	c := rec.firstChild
+	rec.firstChild, rec.lastChild, rec.numChild = nil, nil, 0
+	for c != nil {
+		next := c.nextSib
+		c.nextSib = nil
+		switch c.name {
+		case checksumColumn, uuidColumn, rowColumn, offsetColumn, lineColumn, recordTypeColumn:
+			rec.addChild(c)
+		default:
+			if prune(c, paths) {
+				rec.addChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+// prune reports whether t is on one of the paths, and if so removes
+// from it whatever is not, so an element at the end of one is kept whole.
+func prune(t *Tag, paths [][]string) bool {
+	var rest [][]string
+	for _, path := range paths {
+		if !stepMatches(path[0], t.name) {
+			continue
+		}
+		if len(path) == 1 {
+			return true
+		}
+		rest = append(rest, path[1:])
+	}
+	if rest == nil {
+		return false
+	}
+	c := t.firstChild
+	t.firstChild, t.lastChild, t.numChild = nil, nil, 0
+	for c != nil {
+		next := c.nextSib
+		c.nextSib = nil
+		if prune(c, rest) {
+			t.addChild(c)
+		}
+		c = next
+	}
+	return true
+}
+
+// deepCopy copies t and everything in it.
+func deepCopy(t *Tag) *Tag {
+	cp := *t
+	cp.firstChild, cp.lastChild, cp.nextSib, cp.numChild = nil, nil, nil, 0
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		cp.addChild(deepCopy(c))
+	}
+	return &cp
+}
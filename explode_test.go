@@ -0,0 +1,104 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// booksXML has records with two, one, and no Contributors, in their
+// DescriptiveDetail.
+const booksXML = `<ONIXMessage>
+  <Product>
+    <Title>One</Title>
+    <ProductIdentifier><IDValue>111</IDValue></ProductIdentifier>
+    <DescriptiveDetail><Form>BC</Form>
+      <Contributor><Name>Ann</Name></Contributor>
+      <Contributor><Name>Bob</Name></Contributor>
+    </DescriptiveDetail>
+  </Product>
+  <Product>
+    <Title>Two</Title>
+    <ProductIdentifier><IDValue>222</IDValue></ProductIdentifier>
+    <DescriptiveDetail><Form>BB</Form>
+      <Contributor><Name>Cy</Name></Contributor>
+    </DescriptiveDetail>
+  </Product>
+  <Product>
+    <Title>Three</Title>
+    <ProductIdentifier><IDValue>333</IDValue></ProductIdentifier>
+  </Product>
+</ONIXMessage>`
+
+func TestExplode(t *testing.T) {
+	cases := []struct {
+		what string
+		opts Options
+		want string
+	}{
+		{"by path", Options{Explode: "DescriptiveDetail/Contributor"}, `DescriptiveDetail_Contributor_Name,DescriptiveDetail_Form,ProductIdentifier_IDValue,Title
+Ann,BC,111,One
+Bob,BC,111,One
+Cy,BB,222,Two
+,,333,Three
+`},
+		{"row numbers", Options{Explode: "DescriptiveDetail/Contributor", RowNumbers: true, Exclude: []string{"DescriptiveDetail_Form", "ProductIdentifier_IDValue"}}, `_row,DescriptiveDetail_Contributor_Name,Title
+1,Ann,One
+1,Bob,One
+2,Cy,Two
+3,,Three
+`},
+		// the path is from the record, so Contributor alone is not there.
+		{"not there", Options{Explode: "Contributor"}, `DescriptiveDetail_Contributor1_Name,DescriptiveDetail_Contributor_Name,DescriptiveDetail_Form,ProductIdentifier_IDValue,Title
+Bob,Ann,BC,111,One
+,Cy,BB,222,Two
+,,,333,Three
+`},
+	}
+	for _, c := range cases {
+		c.opts.Quote = "minimal"
+		var out bytes.Buffer
+		if _, err := Convert(strings.NewReader(booksXML), &out, c.opts); err != nil {
+			t.Errorf("%v: %v", c.what, err)
+			continue
+		}
+		if out.String() != c.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.what, out.String(), c.want)
+		}
+	}
+}
+
+// With Carry, the rows after the first get only the carried paths,
+// next to their Contributor.
+func TestExplodeCarry(t *testing.T) {
+	opts := Options{Quote: "minimal", Explode: "DescriptiveDetail/Contributor", Carry: []string{"Title", "ProductIdentifier/IDValue"}}
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(booksXML), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := `DescriptiveDetail_Contributor_Name,DescriptiveDetail_Form,ProductIdentifier_IDValue,Title
+Ann,BC,111,One
+Bob,,111,One
+Cy,BB,222,Two
+,,333,Three
+`
+	if out.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", out.String(), want)
+	}
+
+	opts.Carry = []string{"Title"}
+	out.Reset()
+	if _, err := Convert(strings.NewReader(booksXML), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(out.String(), "\n")[2]; got != "Bob,,,One" {
+		t.Errorf("carrying only the Title, the second row is %v, want Bob,,,One", got)
+	}
+
+	if _, err := Convert(strings.NewReader(booksXML), &out, Options{Carry: []string{"Title"}}); err == nil {
+		t.Errorf("no error for Carry without Explode")
+	}
+}
@@ -0,0 +1,162 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"strings"
+)
+
+// With -html, we read HTML, and SGML-ish XML, forgivingly: names are
+// case insensitive, void elements like <br> need no close tag, the text
+// of <script> and <style> may hold '<', the close tags HTML lets you
+// leave out are implied, and any other close tag that doesn't match
+// closes the elements it skips over, or is ignored if nothing matches.
+// Attributes may be unquoted, as they may anyway.
+
+// voidElements never have content, so are never closed.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements hold text that isn't markup, and that we leave out.
+var rawTextElements = map[string]bool{
+	"script": true,
+	"style":  true,
+}
+
+// impliedEnds gives, for the elements whose close tag may be left
+// out, the elements that close them by opening.
+var impliedEnds = map[string]map[string]bool{
+	"li":     setOf("li"),
+	"dt":     setOf("dt", "dd"),
+	"dd":     setOf("dt", "dd"),
+	"p":      setOf("p", "div", "ul", "ol", "dl", "table", "pre", "blockquote", "form", "hr", "h1", "h2", "h3", "h4", "h5", "h6"),
+	"tr":     setOf("tr", "thead", "tbody", "tfoot"),
+	"td":     setOf("td", "th", "tr", "thead", "tbody", "tfoot"),
+	"th":     setOf("td", "th", "tr", "thead", "tbody", "tfoot"),
+	"thead":  setOf("tbody", "tfoot"),
+	"tbody":  setOf("tbody", "tfoot"),
+	"option": setOf("option", "optgroup"),
+}
+
+func setOf(names ...string) map[string]bool {
+	m := make(map[string]bool)
+	for _, name := range names {
+		m[name] = true
+	}
+	return m
+}
+
+// collapseSpace turns each run of whitespace in s into one space, as
+// HTML is displayed. (A &nbsp; is not whitespace, so it is kept.)
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\r', '\n', '\f':
+			space = true
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteByte(c)
+		}
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// trimHTML trims the spaces from around the content s of an element,
+// if we are reading HTML, where they are not part of it.
+func (p *parser) trimHTML(s string) string {
+	if !p.opts.HTML || p.opts.RawEntities {
+		return s
+	}
+	return strings.Trim(s, " ")
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// htmlTag makes t, as read, into HTML.
+func (s *scanner) htmlTag(t *Tag) {
+	t.name = strings.ToLower(t.name)
+	if voidElements[t.name] && !t.isClose {
+		t.selfClosed = true
+	}
+	if rawTextElements[t.name] {
+		t.skip = true
+	}
+}
+
+// closeImplied closes the open elements that opening t implies the
+// end of, like an open <li> when the next <li> starts.
+func (p *parser) closeImplied(t *Tag) (done bool, err error) {
+	for top := p.top(); top != nil && impliedEnds[top.name][t.name]; top = p.top() {
+		if done, err = p.endImplied(t); done || err != nil {
+			return
+		}
+	}
+	return false, nil
+}
+
+// closeUpTo closes the elements left open inside the one that the
+// close tag t matches, reporting whether there is one. If not, t is
+// to be ignored.
+func (p *parser) closeUpTo(t *Tag) (ok bool, err error) {
+	i := len(p.stack) - 1
+	for i >= 0 && p.stack[i].name != t.name {
+		i--
+	}
+	if i < 0 {
+		return false, nil
+	}
+	for len(p.stack)-1 > i {
+		if _, err := p.endImplied(t); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// closeAll closes every element still open at the end of the input.
+func (p *parser) closeAll() error {
+	end := &Tag{}
+	for len(p.stack) > 0 {
+		if _, err := p.endImplied(end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endImplied closes the element at the top of the stack, whose end is
+// implied by next. Any text before next is the closed element's.
+func (p *parser) endImplied(next *Tag) (done bool, err error) {
+	open := p.top()
+	end := &Tag{
+		isClose: true,
+		name:    open.name,
+		beg:     next.beg,
+		line:    next.line,
+		col:     next.col,
+		endx:    next.beg,
+		pre:     next.pre,
+	}
+	next.pre = ""
+	if open.numChild == 0 && !open.skip {
+		// then it is simple after all, as in <li>item<li>...
+		open.isSimple = true
+		open.content = p.trimHTML(p.text(end.pre))
+		p.addSimple(open)
+	}
+	return p.closeTop(end)
+}
@@ -0,0 +1,143 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// -format html writes the rows as a table in a standalone HTML page,
+// to open in a browser or mail to someone without a spreadsheet at
+// hand. With -html-style, the page also gets a little styling, a
+// header that stays put while scrolling, and headers that sort the
+// rows by their column when clicked, numerically if its values are
+// all numbers, and back the other way when clicked again.
+
+// htmlSink writes the rows as an HTML table, for -format html.
+type htmlSink struct {
+	bw    *bufio.Writer
+	c     io.Closer
+	opts  *Options
+	title string
+
+	started bool // the page up to the rows is written
+}
+
+func newHTMLSink(path string, wc io.WriteCloser, opts *Options) *htmlSink {
+	title := "xml2csv"
+	if path != "" && path != "-" {
+		title = strings.TrimSuffix(filepath.Base(path), ".html")
+	}
+	return &htmlSink{bw: bufio.NewWriter(wc), c: wc, opts: opts, title: title}
+}
+
+func (s *htmlSink) header(names, types []string) error {
+	s.start()
+	if s.opts.NoHeader || len(names) == 0 {
+		_, err := s.bw.WriteString("<tbody>\n")
+		return err
+	}
+	s.bw.WriteString("<thead>\n<tr>")
+	for _, name := range names {
+		s.bw.WriteString("<th>" + htmlEscape(name) + "</th>")
+	}
+	_, err := s.bw.WriteString("</tr>\n</thead>\n<tbody>\n")
+	return err
+}
+
+// start writes the page up to the table's header.
+func (s *htmlSink) start() {
+	s.started = true
+	s.bw.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	s.bw.WriteString("<title>" + htmlEscape(s.title) + "</title>\n")
+	if s.opts.HTMLStyle {
+		s.bw.WriteString(htmlStyle)
+	}
+	s.bw.WriteString("</head>\n<body>\n<table>\n")
+}
+
+func (s *htmlSink) row(cells []cell) error {
+	s.bw.WriteString("<tr>")
+	for _, c := range cells {
+		s.bw.WriteString("<td>" + htmlEscape(c.value) + "</td>")
+	}
+	_, err := s.bw.WriteString("</tr>\n")
+	return err
+}
+
+func (s *htmlSink) flush() error {
+	return s.bw.Flush()
+}
+
+func (s *htmlSink) close() error {
+	if !s.started {
+		s.start() // no records: an empty table.
+		s.bw.WriteString("<tbody>\n")
+	}
+	s.bw.WriteString("</tbody>\n</table>\n")
+	if s.opts.HTMLStyle {
+		s.bw.WriteString(htmlSort)
+	}
+	s.bw.WriteString("</body>\n</html>\n")
+	err := s.bw.Flush()
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// htmlEscape escapes s for the page, with a line break as <br>.
+func htmlEscape(s string) string {
+	s = html.EscapeString(s)
+	if strings.ContainsAny(s, "\r\n") {
+		s = strings.NewReplacer("\r\n", "<br>", "\n", "<br>", "\r", "<br>").Replace(s)
+	}
+	return s
+}
+
+// htmlStyle and htmlSort are the styling and the sorting of -html-style.
+const (
+	htmlStyle = `<style>
+body { font-family: system-ui, sans-serif; font-size: 14px; margin: 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; position: sticky; top: 0; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+tbody tr:nth-child(even) { background: #fafafa; }
+tbody tr:hover { background: #eef4ff; }
+</style>
+`
+
+	htmlSort = `<script>
+document.querySelectorAll("th").forEach(function (th, col) {
+  th.addEventListener("click", function () {
+    var tbody = th.closest("table").tBodies[0];
+    var rows = Array.from(tbody.rows);
+    var desc = th.classList.contains("asc");
+    th.parentNode.querySelectorAll("th").forEach(function (h) { h.classList.remove("asc", "desc"); });
+    th.classList.add(desc ? "desc" : "asc");
+    var text = function (r) { return r.cells[col].textContent; };
+    var numeric = rows.every(function (r) { var v = text(r); return v === "" || !isNaN(Number(v)); });
+    rows.sort(function (a, b) {
+      var x = text(a), y = text(b), d;
+      if (numeric) {
+        d = (x === "" ? -Infinity : Number(x)) - (y === "" ? -Infinity : Number(y));
+        if (isNaN(d)) { d = 0; }
+      } else {
+        d = x.localeCompare(y, undefined, { numeric: true });
+      }
+      return desc ? -d : d;
+    });
+    rows.forEach(function (r) { tbody.appendChild(r); });
+  });
+});
+</script>
+`
+)
@@ -0,0 +1,74 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLTable(t *testing.T) {
+	in := "<r><p><a>&lt;z&gt; &amp;</a><b>two\nlines</b></p><p><a>x</a></p></r>"
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(in), &out, Options{Format: "html"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>xml2csv</title>
+</head>
+<body>
+<table>
+<thead>
+<tr><th>a</th><th>b</th></tr>
+</thead>
+<tbody>
+<tr><td>&lt;z&gt; &amp;</td><td>two<br>lines</td></tr>
+<tr><td>x</td><td></td></tr>
+</tbody>
+</table>
+</body>
+</html>
+`
+	if out.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", out.String(), want)
+	}
+
+	out.Reset()
+	if _, err := Convert(strings.NewReader(in), &out, Options{Format: "html", NoHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "<thead>") || !strings.Contains(out.String(), "<tbody>\n<tr><td>&lt;z&gt;") {
+		t.Errorf("with NoHeader, got\n%v", out.String())
+	}
+
+	out.Reset()
+	if _, err := Convert(strings.NewReader("<r/>"), &out, Options{Format: "html"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<table>\n<tbody>\n</tbody>\n</table>") {
+		t.Errorf("with no records, got\n%v\nnot an empty table", out.String())
+	}
+}
+
+// The page is titled after its file, and styled and sortable with
+// HTMLStyle.
+func TestHTMLTableStyle(t *testing.T) {
+	dir := convertTo(t, "<r><p><a>1</a></p></r>", "report.html", Options{Format: "html", HTMLStyle: true})
+	b, err := os.ReadFile(filepath.Join(dir, "report.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	for _, want := range []string{"<title>report</title>", "<style>", "position: sticky", "</style>\n</head>", "</table>\n<script>", "</script>\n</body>"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page lacks %q", want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"strings"
+)
+
+// -format json writes each record as it was nested, instead of
+// flattening it into columns: an element holding others becomes an
+// object, keyed by their names; a name that repeats among siblings,
+// in any of the records, an array of them, in all of the records,
+// so that each key always holds the same kind of value; and an
+// element holding just text, that text, or null if marked xsi:nil.
+// Attributes become "@name" keys, with the element's own text then
+// under "#text". The records make up one JSON array, a record to a
+// line, each but the last ending in a comma.
+
+// recordSink is a rowSink that takes the records whole, rather than
+// their rows, which writeCsv and convertStream hand it instead.
+type recordSink interface {
+	rowSink
+	record(rec *Tag) error
+
+	// repeats notes the elements that repeat among their siblings in
+	// the records from first on, along its nextSib, before they are
+	// handed to record.
+	repeats(first *Tag)
+}
+
+// jsonSink writes the records as a JSON array, for -format json.
+type jsonSink struct {
+	*lineSink
+	started bool
+	arrays  map[string]bool // the paths, from the record, of the elements that repeat
+}
+
+func (s *jsonSink) header(names, types []string) error { return nil }
+
+func (s *jsonSink) row(cells []cell) error { return nil }
+
+// repeats notes the elements that repeat, so that each is an array in
+// every record, even one that holds just one of them. With -stream,
+// those of the sample records are noted before any record is written;
+// one that first repeats after them is an array only from there on,
+// with a warning.
+func (s *jsonSink) repeats(first *Tag) {
+	if s.arrays == nil {
+		s.arrays = make(map[string]bool)
+	}
+	for rec := first; rec != nil; rec = rec.nextSib {
+		for _, path := range addRepeats(s.arrays, rec, rec.base) {
+			if s.started {
+				s.opts.warnf("warning: '%v' first repeats after the first %v records, so it is an array only from there on.\n", path, s.opts.streamSample())
+			}
+		}
+	}
+}
+
+// addRepeats adds the paths of the elements under t, at path, that
+// repeat among their siblings to arrays, returning those that are new.
+func addRepeats(arrays map[string]bool, t *Tag, path string) (added []string) {
+	if t.isSimple {
+		return nil
+	}
+	count := make(map[string]int)
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		count[c.base]++
+	}
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		cpath := path + "/" + c.base
+		if count[c.base] > 1 && !arrays[cpath] {
+			arrays[cpath] = true
+			added = append(added, cpath)
+		}
+		added = append(added, addRepeats(arrays, c, cpath)...)
+	}
+	return added
+}
+
+// record writes rec, after a comma ending the line of the one before.
+func (s *jsonSink) record(rec *Tag) error {
+	var b strings.Builder
+	if s.started {
+		b.WriteByte(',')
+		b.Write(s.opts.newline())
+	} else {
+		b.WriteByte('[')
+		s.started = true
+	}
+	s.value(&b, rec, nil, rec.base)
+	_, err := s.bw.WriteString(b.String())
+	return err
+}
+
+// close ends the array, which is empty if there were no records.
+func (s *jsonSink) close() error {
+	var err error
+	if s.started {
+		_, err = s.bw.Write(s.opts.newline())
+	} else {
+		_, err = s.bw.WriteString("[")
+	}
+	if err == nil {
+		err = s.line("]")
+	}
+	err2 := s.lineSink.close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeRecords hands each record of tree to sink.
+func writeRecords(ctx context.Context, sink recordSink, tree *Tag, opts *Options) error {
+	sink.repeats(tree.firstChild)
+	n := 0
+	for rec := tree.firstChild; rec != nil; rec = rec.nextSib {
+		if err := sink.record(rec); err != nil {
+			return err
+		}
+		n++
+		if n%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	opts.manifest.records(sink, tree.numChild)
+	return nil
+}
+
+// value writes t, under the elements in stack, at path, as JSON.
+func (s *jsonSink) value(b *strings.Builder, t *Tag, stack []*Tag, path string) {
+	opts := s.opts
+	if t.isNil {
+		b.WriteString("null")
+		return
+	}
+	var attrs []attr
+	for _, a := range t.attrs() {
+		if a.name == "xmlns" || strings.HasPrefix(a.name, "xmlns:") {
+			continue // how the names are spelled, not what they say.
+		}
+		attrs = append(attrs, a)
+	}
+	var kids []*Tag
+	if !t.isSimple {
+		stack = append(stack[:len(stack):len(stack)], t)
+		for c := t.firstChild; c != nil; c = c.nextSib {
+			if !skipTag(opts.skipTags(), stack, c) {
+				kids = append(kids, c)
+			}
+		}
+	}
+	content := t.content
+	if !t.preserve {
+		content = trimAllSpace(content)
+	}
+	if len(attrs) == 0 && len(kids) == 0 {
+		writeJSONString(b, content)
+		return
+	}
+
+	b.WriteByte('{')
+	n := 0
+	key := func(k string) {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+		n++
+		writeJSONString(b, k)
+		b.WriteByte(':')
+	}
+	for _, a := range attrs {
+		key("@" + opts.colName(a.name))
+		writeJSONString(b, unescapeEntities(a.value))
+	}
+	if len(kids) == 0 {
+		key("#text")
+		writeJSONString(b, content)
+	}
+	// the children by name, in the order first seen.
+	var names []string
+	byName := make(map[string][]*Tag)
+	for _, c := range kids {
+		if byName[c.base] == nil {
+			names = append(names, c.base)
+		}
+		byName[c.base] = append(byName[c.base], c)
+	}
+	for _, name := range names {
+		key(name)
+		same, cpath := byName[name], path+"/"+name
+		if len(same) == 1 && !s.arrays[cpath] {
+			s.value(b, same[0], stack, cpath)
+			continue
+		}
+		b.WriteByte('[')
+		for i, c := range same {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			s.value(b, c, stack, cpath)
+		}
+		b.WriteByte(']')
+	}
+	b.WriteByte('}')
+}
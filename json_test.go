@@ -0,0 +1,77 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const jsonXML = `<r xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <p id="1"><t>A &amp; &lt;B&gt;</t><s>x</s></p>
+  <p id="2"><t xsi:nil="true"/><s>y</s><s>z</s></p>
+  <p><t lang="en">T</t></p>
+</r>`
+
+func TestJSON(t *testing.T) {
+	var out, warnings bytes.Buffer
+	if _, err := Convert(strings.NewReader(jsonXML), &out, Options{Format: "json", Warnings: &warnings}); err != nil {
+		t.Fatal(err)
+	}
+	// s repeats in one record, so is an array in all of them.
+	want := `[{"@id":"1","t":"A & <B>","s":["x"]},
+{"@id":"2","t":null,"s":["y","z"]},
+{"t":{"@lang":"en","#text":"T"}}
+]
+`
+	if out.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", out.String(), want)
+	}
+	var v []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &v); err != nil {
+		t.Errorf("not JSON: %v", err)
+	}
+	if warnings.Len() > 0 {
+		t.Errorf("unexpected warnings: %v", warnings.String())
+	}
+}
+
+// Streamed, a name is an array only once it has been seen to repeat,
+// with a warning if that is after the sample.
+func TestJSONStream(t *testing.T) {
+	var out, warnings bytes.Buffer
+	if _, err := Convert(strings.NewReader(jsonXML), &out, Options{Format: "json", Stream: true, StreamSample: 1, Warnings: &warnings}); err != nil {
+		t.Fatal(err)
+	}
+	var v []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &v); err != nil {
+		t.Fatalf("not JSON: %v\n%v", err, out.String())
+	}
+	if len(v) != 3 {
+		t.Errorf("%v records, want 3", len(v))
+	}
+	if !strings.Contains(warnings.String(), "'p/s' first repeats after the first 1 records") {
+		t.Errorf("no warning of the late array: %q", warnings.String())
+	}
+
+	out.Reset()
+	if _, err := Convert(strings.NewReader(jsonXML), &out, Options{Format: "json", Stream: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"s":["x"]`) {
+		t.Errorf("s is not an array in every record, with all of them sampled:\n%v", out.String())
+	}
+}
+
+func TestJSONEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader("<r/>"), &out, Options{Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("got %q for no records, want []", out.String())
+	}
+}
@@ -0,0 +1,85 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// -json-schema writes, next to the -format jsonl output, as
+// out.schema.json for out.jsonl, a JSON Schema that its objects all
+// match, for checking what consumers of them are sent. Every value is
+// a string, or null for an xsi:nil element, so the types that
+// -types-row infers are given by the pattern a column's values match,
+// empty or not; the columns that
+// every record has are required, and no others are allowed.
+
+// The patterns of the values of each type.
+const (
+	integerPattern  = `^([-+]?[0-9]+)?$`
+	decimalPattern  = `^([-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?)?$`
+	datePattern     = `^([0-9]{4}-[0-9]{2}-[0-9]{2})?$`
+	dateTimePattern = `^([0-9]{4}-[0-9]{2}-[0-9]{2}(T[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?(Z|[-+][0-9]{2}:[0-9]{2})?)?)?$`
+)
+
+// jsonSchema returns the JSON Schema of the objects with the columns of s.
+func jsonSchema(s *schemaSink) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString(`{"$schema":"https://json-schema.org/draft/2020-12/schema","title":`)
+	title, _ := splitCsvExt(filepath.Base(s.path))
+	writeJSONString(&b, title)
+	b.WriteString(`,"type":"object","properties":{`)
+	var required []string
+	for i, name := range s.names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeJSONString(&b, name)
+		if s.shapes[i].null {
+			b.WriteString(`:{"type":["string","null"]`)
+		} else {
+			b.WriteString(`:{"type":"string"`)
+		}
+		if pattern := jsonPattern(s.types[i], s.shapes[i]); pattern != "" {
+			b.WriteString(`,"pattern":`)
+			writeJSONString(&b, pattern)
+		}
+		b.WriteByte('}')
+		if s.shapes[i].present == s.rows {
+			required = append(required, name)
+		}
+	}
+	b.WriteString(`},"required":[`)
+	for i, name := range required {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeJSONString(&b, name)
+	}
+	b.WriteString(`],"additionalProperties":false}`)
+
+	var out bytes.Buffer
+	err := json.Indent(&out, []byte(b.String()), "", "  ")
+	return out.Bytes(), err
+}
+
+// jsonPattern returns the pattern of the values of a column of type
+// typ, shaped as shape, or "" for any string.
+func jsonPattern(typ string, shape columnShape) string {
+	switch typ {
+	case typeInteger:
+		return integerPattern
+	case typeDecimal:
+		return decimalPattern
+	case typeDate:
+		if shape.time {
+			return dateTimePattern
+		}
+		return datePattern
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	in := `<r xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <p><n>1</n><d>1.5</d><day>2023-01-02</day><at>2023-01-02T03:04:05Z</at><s>x</s></p>
+  <p><n></n><d>-2e3</d><day>2023-02-03</day><at>2023-01-02</at><s xsi:nil="true"/></p>
+  <p><n>7</n><d>.5</d><at>2023-01-02T03:04:05.5+01:00</at><s>z</s></p>
+</r>`
+	dir := convertTo(t, in, "out.jsonl", Options{Format: "jsonl", JSONSchema: true, KeepAllColumns: true})
+	b, err := os.ReadFile(filepath.Join(dir, "out.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Schema     string `json:"$schema"`
+		Title      string
+		Type       string
+		Properties map[string]struct {
+			Type    any
+			Pattern string
+		}
+		Required             []string
+		AdditionalProperties *bool
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Title != "out" || schema.Type != "object" || schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+		t.Errorf("title %q, type %q, additionalProperties %v", schema.Title, schema.Type, schema.AdditionalProperties)
+	}
+	if want := []string{"at", "d", "n", "s"}; !reflect.DeepEqual(schema.Required, want) {
+		t.Errorf("required %v, want %v", schema.Required, want)
+	}
+	wantTypes := map[string]any{
+		"at":  "string",
+		"d":   "string",
+		"day": "string",
+		"n":   "string",
+		"s":   []any{"string", "null"},
+	}
+	wantPatterns := map[string]string{
+		"at":  dateTimePattern,
+		"d":   decimalPattern,
+		"day": datePattern,
+		"n":   integerPattern,
+		"s":   "",
+	}
+	if len(schema.Properties) != len(wantTypes) {
+		t.Errorf("properties %v, want those of %v", schema.Properties, wantTypes)
+	}
+	for name, p := range schema.Properties {
+		if !reflect.DeepEqual(p.Type, wantTypes[name]) || p.Pattern != wantPatterns[name] {
+			t.Errorf("%v of type %v and pattern %q, want %v and %q", name, p.Type, p.Pattern, wantTypes[name], wantPatterns[name])
+		}
+	}
+
+	// every object written matches the schema.
+	f, err := os.Open(filepath.Join(dir, "out.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var obj map[string]*string
+		if err := json.Unmarshal(sc.Bytes(), &obj); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				t.Errorf("%s lacks %v", sc.Bytes(), name)
+			}
+		}
+		for name, v := range obj {
+			p, ok := schema.Properties[name]
+			switch {
+			case !ok:
+				t.Errorf("%s has %v, which is not in the schema", sc.Bytes(), name)
+			case v == nil:
+				if _, ok := p.Type.([]any); !ok {
+					t.Errorf("%s has a null %v", sc.Bytes(), name)
+				}
+			case !regexp.MustCompile(p.Pattern).MatchString(*v):
+				t.Errorf("%v %q does not match %v", name, *v, p.Pattern)
+			}
+		}
+	}
+}
+
+func TestJSONPatterns(t *testing.T) {
+	for _, c := range []struct {
+		pattern string
+		good    []string
+		bad     []string
+	}{
+		{integerPattern, []string{"", "0", "-12", "+7"}, []string{"1.5", "x", "1 "}},
+		{decimalPattern, []string{"", "1", "1.", "1.5", ".5", "-2e3", "6.02E+23"}, []string{".", "e5", "1.2.3"}},
+		{datePattern, []string{"", "2023-01-02"}, []string{"2023-1-2", "2023-01-02T03:04:05"}},
+		{dateTimePattern, []string{"", "2023-01-02", "2023-01-02T03:04:05", "2023-01-02T03:04:05.25Z", "2023-01-02T03:04:05-07:00"}, []string{"2023-01-02T03:04", "2023-01-02 03:04:05"}},
+	} {
+		re := regexp.MustCompile(c.pattern)
+		for _, s := range c.good {
+			if !re.MatchString(s) {
+				t.Errorf("%q does not match %v", s, c.pattern)
+			}
+		}
+		for _, s := range c.bad {
+			if re.MatchString(s) {
+				t.Errorf("%q matches %v", s, c.pattern)
+			}
+		}
+	}
+}
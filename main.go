@@ -0,0 +1,601 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Use -i and -o to read from and write to named files instead of
+// stdin and stdout; these may also be s3://bucket/key or gs://bucket/key
+// object paths.
+//
+// To convert a whole directory of .xml files at once, instead of
+//
+// ls -1 *.xml > list
+// for i in `cat list`; do k=${i/xml}; ./xml2csv < $i > ${k}csv; done
+//
+// use: xml2csv -dir .
+//
+// or give the files (or glob patterns, where ** matches any number
+// of directories) on the command line: xml2csv 'data/**/*.xml'
+
+// subcommand is one of the things xml2csv can do, as in "xml2csv tree".
+// setup registers the subcommand's flags on fs, and returns the
+// function to run once they have been parsed.
+type subcommand struct {
+	name  string
+	args  string // what follows the flags, for the usage line
+	about string
+	setup func(fs *flag.FlagSet) func(args []string) error
+}
+
+func subcommands() []subcommand {
+	return []subcommand{
+		{"convert", "[files or globs...]", "convert XML to csv (the default, if no subcommand is given)", convertSetup},
+		{"schema", "[file]", "list the csv columns that the XML would be flattened into, or with -ddl, a CREATE TABLE for them, or with -proto, a protocol buffers message", schemaSetup},
+		{"inspect", "[file]", "summarize the structure of the XML", inputSetup(runInspect)},
+		{"validate", "[files or globs...]", "check that the XML is well-formed, listing any problems", validateSetup},
+		{"tree", "[file]", "print the parse tree of the XML", inputSetup(runTree)},
+		{"completion", "bash|zsh|fish", "print a shell completion script", completionSetup},
+		{"version", "", "print the version, commit, and build date", versionSetup},
+	}
+}
+
+// flagSet returns the subcommand's flags, along with the function to run.
+func (sub subcommand) flagSet() (*flag.FlagSet, func(args []string) error) {
+	fs := flag.NewFlagSet("xml2csv "+sub.name, flag.ExitOnError)
+	verbosityFlags(fs)
+	run := sub.setup(fs)
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "usage: xml2csv %v [flags]", sub.name)
+		if sub.args != "" {
+			fmt.Fprintf(w, " %v", sub.args)
+		}
+		fmt.Fprintf(w, "\n\n%v.\n", sub.about)
+		if hasFlags(fs) {
+			fmt.Fprintf(w, "\nflags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs, run
+}
+
+// verbose and quiet are the -v and -q of the command.
+var verbose, quiet bool
+
+// verbosityFlags registers -v, -vv and -q, which every subcommand takes.
+func verbosityFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verbose, "v", false, "report progress on stderr")
+	fs.BoolFunc("vv", "same as -v", func(string) error {
+		verbose = true
+		return nil
+	})
+	fs.BoolVar(&quiet, "q", false, "quiet: no warnings or summaries on stderr, only errors")
+}
+
+// verbosity gives opts the -v and -q of the command.
+func verbosity(opts *Options) {
+	opts.Verbose = verbose
+	if quiet {
+		opts.Warnings = io.Discard
+	}
+}
+
+func hasFlags(fs *flag.FlagSet) (r bool) {
+	fs.VisitAll(func(*flag.Flag) { r = true })
+	return
+}
+
+// Main runs the xml2csv command, on os.Args, for cmd/xml2csv. It
+// exits, with the status that exitCode gives, once the command is done.
+func Main() {
+	subs := subcommands()
+	args := os.Args[1:]
+	sub := subs[0] // plain "xml2csv -i in.xml" still converts, as it always has.
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			usage(subs, args[1:])
+			return
+		case "-version", "--version":
+			printVersion()
+			return
+		}
+		for _, s := range subs {
+			if args[0] == s.name {
+				sub = s
+				args = args[1:]
+				break
+			}
+		}
+	}
+	fs, run := sub.flagSet()
+	fs.Parse(args)
+	handleSignals()
+	exit(run(fs.Args()))
+}
+
+// usage describes the subcommand named in args, or else all of them.
+func usage(subs []subcommand, args []string) {
+	for _, sub := range subs {
+		if len(args) > 0 && args[0] == sub.name {
+			fs, _ := sub.flagSet()
+			fs.SetOutput(os.Stdout)
+			fs.Usage()
+			return
+		}
+	}
+	fmt.Printf("usage: xml2csv [subcommand] [flags] [files or globs...]\n\nsubcommands:\n")
+	for _, sub := range subs {
+		fmt.Printf("  %-11v %v\n", sub.name, sub.about)
+	}
+	fmt.Printf("\nuse 'xml2csv help <subcommand>' for the flags of each.\n")
+}
+
+func convertSetup(fs *flag.FlagSet) func(args []string) error {
+	var inPath, outPath, dir, outdir, watch, configPath, listFormat, manifestOut string
+	var combine, recursive, list bool
+	var workers int
+	opts := &Options{}
+	fs.StringVar(&inPath, "i", "", "input XML file or s3:// gs:// object (default stdin)")
+	fs.StringVar(&inPath, "input", "", "same as -i")
+	fs.StringVar(&outPath, "o", "", "output CSV file or s3:// gs:// object (default stdout)")
+	fs.StringVar(&outPath, "output", "", "same as -o")
+	fs.StringVar(&dir, "dir", "", "convert every *.xml file in this directory to a matching .csv")
+	fs.StringVar(&outdir, "outdir", "", "write the .csv files here instead of next to each .xml")
+	fs.BoolVar(&combine, "combine", false, "convert all the named input files into one csv, written to -o or stdout")
+	fs.BoolVar(&opts.SourceColumn, "source-column", false, "with -combine, add a _source_file column naming the input each row came from")
+	fs.BoolVar(&recursive, "r", false, "with -dir, also convert subdirectories, mirroring their layout under -outdir")
+	fs.IntVar(&workers, "j", 1, "number of files to convert in parallel")
+	fs.StringVar(&watch, "watch", "", "keep running, converting .xml files as they are created or modified in this directory")
+	fs.BoolVar(&list, "list-columns", false, "only print the columns that the csv would have, one per line, and exit")
+	fs.StringVar(&listFormat, "list-format", "text", "with -list-columns, print them as text or json")
+	fs.StringVar(&manifestOut, "manifest", "", "after the run, write a JSON manifest of it to this `file`: the inputs and outputs, with their bytes and SHA-256, and the records, columns, and discarded columns of each output")
+	fs.Func("columns", "comma separated column `names` to write, in this order; others are left out, and any the input lacks are written empty", func(s string) error {
+		opts.Columns = append(opts.Columns, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.Func("include", "keep only the columns matching these comma separated glob `patterns`, or the one regexp after re:", func(s string) error {
+		opts.Include = append(opts.Include, splitPatterns(s)...)
+		return nil
+	})
+	fs.Func("exclude", "leave out the columns matching these comma separated glob `patterns`, or the one regexp after re:", func(s string) error {
+		opts.Exclude = append(opts.Exclude, splitPatterns(s)...)
+		return nil
+	})
+	fs.Func("rename", "give a column a new name in the header, as `old=new`; may be repeated", func(s string) error {
+		old, new, ok := strings.Cut(s, "=")
+		if !ok || old == "" || new == "" {
+			return fmt.Errorf("want old=new, not '%v'", s)
+		}
+		if opts.Rename == nil {
+			opts.Rename = make(map[string]string)
+		}
+		opts.Rename[old] = new
+		return nil
+	})
+	fs.Func("rename-file", "YAML `file` mapping column names to the names to give them in the header, as -rename does", func(path string) error {
+		m, err := loadRenames(path)
+		if err != nil {
+			return err
+		}
+		if opts.Rename == nil {
+			opts.Rename = make(map[string]string)
+		}
+		for old, new := range m {
+			opts.Rename[old] = new
+		}
+		return nil
+	})
+	fs.StringVar(&opts.ColumnOrder, "column-order", "alpha", "order the columns by name (alpha), or as they first appear in the XML (document)")
+	fs.StringVar(&opts.Compress, "compress", "", "compress the csv output with gzip or zstd")
+	fs.StringVar(&opts.Format, "format", "wide", "wide, for a column per path, long, for a row of record_id,path,value per value, jsonl, for a JSON object per record, json, for the records nested as they were, in a JSON array, msgpack, for a MessagePack map per record, parquet, for a Parquet file of typed columns, arrow, for an Arrow IPC stream of them, avro, for an Avro file, orc, for an ORC file, protobuf, for length delimited protocol buffers messages, duckdb, for a table of a DuckDB database file (-o), pgcopy, for the text of a Postgres COPY, xlsx, for an Excel workbook, markdown, for a Markdown table, or html, for a table in a web page")
+	fs.BoolVar(&opts.HTMLStyle, "html-style", false, "with -format html, style the table, and sort its rows by a column when its header is clicked")
+	fs.StringVar(&opts.Table, "table", "records", "with -format duckdb, the `name` of the table to create, or append to; with -dsn, the table to COPY into")
+	fs.StringVar(&opts.DSN, "dsn", "", "with -format pgcopy, load the rows into the -table of this Postgres `database`, like postgres://user@host/db, by way of psql")
+	fs.BoolVar(&opts.NoHeader, "no-header", false, "leave out the header line, as when concatenating csv files")
+	fs.StringVar(&opts.Newlines, "newlines", "keep", "what to do with line breaks within values: keep them, escape them as \\n, or replace them with a space")
+	fs.StringVar(&opts.Dialect, "dialect", "", "write for this program: excel means -bom, -crlf, every value quoted, and a sep=, line first")
+	fs.BoolVar(&opts.BOM, "bom", false, "start the csv with a UTF-8 byte order mark, so Excel reads non-ASCII text correctly")
+	fs.BoolVar(&opts.BQSchema, "bq-schema", false, "also write a BigQuery schema for the csv, typed as -types-row infers, next to it, as out.schema.json for out.csv, for bq load --schema")
+	fs.BoolVar(&opts.JSONSchema, "json-schema", false, "with -format jsonl, also write a JSON Schema that its objects match, next to it, as out.schema.json for out.jsonl")
+	fs.BoolVar(&opts.DataPackage, "datapackage", false, "also write a Frictionless Data Package describing the csv, its columns, their types, and which are required, next to it, as out.datapackage.json for out.csv")
+	fs.BoolVar(&opts.TypesRow, "types-row", false, "add a second header line giving each column's type, inferred from its values: string, integer, decimal, or date")
+	fs.BoolVar(&opts.CRLF, "crlf", false, "end lines with \\r\\n, as RFC 4180 and Windows tools expect, instead of \\n")
+	fs.StringVar(&opts.NullString, "null-string", "", "write this, unquoted, for missing elements, like \\N or NULL (default: nothing)")
+	fs.StringVar(&opts.Quote, "quote", "always", "which values to put in quotes: always, minimal (only those that need it), or never")
+	fs.Func("delimiter", "separate the fields with this `char`, or tab, pipe, or semicolon, instead of a comma", func(s string) (err error) {
+		opts.Delimiter, err = parseDelimiter(s)
+		return
+	})
+	fs.Int64Var(&opts.MaxRows, "max-rows", 0, "split the output into parts (out-part-0001.csv, ...) of at most this many rows")
+	fs.Int64Var(&opts.MaxBytes, "max-bytes", 0, "split the output into parts of at most this many bytes")
+	fs.BoolVar(&opts.Stream, "stream", false, "write rows as the records are read, with the columns taken from the first -stream-sample records")
+	fs.BoolVar(&opts.StrictWidth, "strict-width", false, "with -stream, fail on a record with a column that is not in the header, instead of dropping it with a warning")
+	fs.IntVar(&opts.StreamSample, "stream-sample", 100, "with -stream, the number of records to take the columns from")
+	fs.BoolVar(&opts.SplitDocs, "split-docs", false, "when the input holds several XML documents back to back, write each to its own csv (out-doc-0001.csv, ...) instead of combining them")
+	fs.BoolVar(&opts.Relational, "relational", false, "write each structure that repeats in a record, like its Contributors, to a table of its own (out-Contributor.csv, ...), linked to the record by _id and _parent_id columns")
+	fs.BoolVar(&opts.SplitRecords, "split-records", false, "write each kind of record element to its own csv (out-Product.csv, ...) instead of combining them")
+	parseFlags(fs, opts)
+	fs.StringVar(&opts.XSD, "xsd", "", "leave out records that fail this XML Schema, writing them to out.rejects.xml beside the -o csv (or stderr); needs xmllint")
+	fs.StringVar(&configPath, "config", "", "read settings from this YAML file (default ./"+defaultConfig+", if present)")
+
+	return func(args []string) (err error) {
+		required := configPath != ""
+		if !required {
+			configPath = defaultConfig
+		}
+		inputs, err := loadConfig(fs, configPath, required)
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = inputs
+		}
+		verbosity(opts)
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		if opts.SourceColumn && !combine {
+			return usagef("-source-column only applies with -combine")
+		}
+		if opts.SplitRecords && combine {
+			return usagef("-split-records and -combine cannot be used together")
+		}
+		if opts.Relational && combine {
+			return usagef("-relational and -combine cannot be used together")
+		}
+		if manifestOut != "" {
+			if list || watch != "" {
+				return usagef("-manifest cannot be used with -list-columns or -watch")
+			}
+			opts.manifest = newManifest(os.Args[1:])
+			defer func() {
+				m := opts.manifest
+				opts.manifest = nil
+				err = m.write(manifestOut, err)
+			}()
+		}
+
+		if list {
+			if listFormat != "text" && listFormat != "json" {
+				return usagef("unknown -list-format '%v'; use text or json", listFormat)
+			}
+			if watch != "" || dir != "" || opts.SplitDocs || opts.SplitRecords {
+				return usagef("-list-columns cannot be used with -watch, -dir, -split-docs, or -split-records")
+			}
+			return listColumns(inPath, args, listFormat, opts)
+		}
+
+		if watch != "" {
+			return watchDir(watch, outdir, opts)
+		}
+
+		if dir != "" {
+			return convertDir(dir, outdir, recursive, workers, opts)
+		}
+
+		var paths []string
+		if len(args) > 0 {
+			paths, err = expandGlobs(args)
+			if err != nil {
+				return err
+			}
+			if !combine {
+				return convertFiles(paths, outdir, workers, opts)
+			}
+		}
+
+		if combine {
+			sink, err := openSink(outPath, opts)
+			if err != nil {
+				return err
+			}
+			opts, rejects := withRejects(outPath, opts)
+			defer rejects.Close()
+			if err := combineFiles(paths, sink, opts); err != nil {
+				abortSink(sink, err)
+				return err
+			}
+			if err := sink.close(); err != nil {
+				return err
+			}
+			return rejects.Close()
+		}
+		in, err := openInput(inPath, opts)
+		if err != nil {
+			return err
+		}
+		if err := convertToFile(in, outPath, opts); err != nil {
+			return inputError(inPath, err)
+		}
+		return in.Close()
+	}
+}
+
+// listColumns prints the columns that converting the input at inPath,
+// or else the files matching args, would give, without writing any
+// rows. Several files are listed as -combine would write them.
+func listColumns(inPath string, args []string, format string, opts *Options) error {
+	sink := &columnSink{w: os.Stdout, format: format}
+	var err error
+	if len(args) > 0 {
+		var paths []string
+		paths, err = expandGlobs(args)
+		if err != nil {
+			return err
+		}
+		err = combineFiles(paths, sink, opts)
+	} else {
+		in, err2 := openInput(inPath, opts)
+		if err2 != nil {
+			return err2
+		}
+		err = inputError(inPath, convert(context.Background(), in, sink, opts))
+		in.Close()
+	}
+	if err != nil && err != errListed {
+		return err
+	}
+	return sink.close()
+}
+
+// inputSetup is the setup for the subcommands that examine one
+// XML input without converting it. run is given the input's path:
+// the first argument, or -i, or "" for stdin.
+func inputSetup(run func(path string, opts *Options) error) func(fs *flag.FlagSet) func(args []string) error {
+	return func(fs *flag.FlagSet) func(args []string) error {
+		inPath, opts := inputFlags(fs)
+		return func(args []string) error {
+			if len(args) > 0 {
+				*inPath = args[0]
+			}
+			verbosity(opts)
+			if err := opts.validate(); err != nil {
+				return err
+			}
+			return run(*inPath, opts)
+		}
+	}
+}
+
+// inputFlags registers -i, and the flags for how to read the XML.
+func inputFlags(fs *flag.FlagSet) (inPath *string, opts *Options) {
+	inPath = new(string)
+	opts = &Options{}
+	fs.StringVar(inPath, "i", "", "input XML file or s3:// gs:// object (default stdin)")
+	fs.StringVar(inPath, "input", "", "same as -i")
+	parseFlags(fs, opts)
+	return
+}
+
+// parseFlags registers the flags for the Options that change how
+// the XML is read, which all the subcommands that read XML take.
+func parseFlags(fs *flag.FlagSet, opts *Options) {
+	fs.BoolVar(&opts.KeepNamespace, "keep-namespace", false, "keep namespace prefixes in the column names, so dc:title and onix:title stay different columns")
+	fs.StringVar(&opts.PathSep, "path-sep", "_", "what joins the names of nested elements into a column name, like . or / or __, as in Contributor.Name")
+	fs.StringVar(&opts.NamespaceSep, "namespace-sep", "_", "with -keep-namespace, what joins the prefix to the name, as in dc_title")
+	fs.Func("namespace-map", "YAML `file` mapping namespace URIs to the prefixes to name columns with; implies -keep-namespace", func(path string) (err error) {
+		opts.NamespaceMap, err = loadNamespaceMap(path)
+		opts.KeepNamespace = true
+		return
+	})
+	fs.StringVar(&opts.Encoding, "encoding", "", "character encoding of the input, like ISO-8859-1 or Shift_JIS (default: as the XML declares, or UTF-8)")
+	fs.BoolVar(&opts.Mixed, "mixed", false, "make an element with text between its child elements, like <p>Hello <b>world</b></p>, one cell of all its text")
+	fs.StringVar(&opts.NilString, "nil-string", "", "write this, unquoted, for elements marked xsi:nil=\"true\", like NULL or \\N (default: nothing, unquoted)")
+	fs.Func("discard-values", "comma separated `values`, like \"\",None,N/A,-, that don't count as content: a column holding only these is left out (default \"\",None)", func(s string) error {
+		for _, v := range strings.Split(s, ",") {
+			if v == `""` {
+				v = ""
+			}
+			opts.DiscardValues = append(opts.DiscardValues, v)
+		}
+		return nil
+	})
+	fs.Func("skip-tags", "comma separated element `names`, or paths from the record like Product/Contributor/Role, to leave out of the columns (default schema:created,schema:modified)", func(s string) error {
+		opts.SkipTags = append(opts.SkipTags, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.StringVar(&opts.Explode, "explode", "", "make a row for each of the repeated elements at this `path` in a record, like Contributor, repeating the rest of the record, instead of numbering their columns")
+	fs.Func("carry", "with -explode, copy only what is at these comma separated `paths` from the record, like Title,ProductIdentifier/IDValue, onto the rows of the later repeats, instead of all the rest of the record", func(s string) error {
+		opts.Carry = append(opts.Carry, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.StringVar(&opts.JoinRepeats, "join-repeats", "", "join the values of a repeated simple element into one cell, separated by this, like |, instead of numbering their columns")
+	fs.StringVar(&opts.DupSuffix, "dup-suffix", "%d", "how to number the columns of repeated elements, as a Printf `format` like [%d] or _%02d")
+	fs.IntVar(&opts.DupStart, "dup-start", 0, "what the first of the repeated elements counts as, so -dup-start 1 numbers its repeats from 2")
+	fs.BoolVar(&opts.KeepAllColumns, "keep-all-columns", false, "keep every column, even those holding only the -discard-values")
+	fs.StringVar(&opts.Lang, "lang", "", "keep only the elements in this xml:lang, like en, dropping their translations")
+	fs.BoolVar(&opts.LangColumns, "lang-columns", false, "name the columns of elements with an xml:lang for it, as in title_en, title_fr")
+	fs.Func("value-attr", "comma separated `attributes`, like rdf:resource,href, whose value is used as the content of a self-closed element like <url rdf:resource=\"...\"/>", func(s string) error {
+		opts.ValueAttrs = append(opts.ValueAttrs, strings.Split(s, ",")...)
+		return nil
+	})
+	fs.StringVar(&opts.Record, "record", "", "the path of the elements that each become one row, like ONIXMessage/Product (default: the children of the root)")
+	fs.StringVar(&opts.Checksum, "checksum", "", "add a _checksum column holding the sha256 (or the faster fnv64) of each record's canonical XML")
+	fs.StringVar(&opts.UUIDKey, "uuid-key", "", "add a _uuid column holding a UUID derived from the element at this `path` in each record, like RecordReference")
+	fs.StringVar(&opts.UUIDNamespace, "uuid-namespace", "", "with -uuid-key, the namespace `uuid` to derive the UUIDs in (default the RFC 4122 URL namespace)")
+	fs.StringVar(&opts.SourceOffset, "source-offset", "", "add a column giving where each record began in the input, as a `byte` offset (_offset) or line number (_line)")
+	fs.BoolVar(&opts.RowNumbers, "row-numbers", false, "add a _row column, first, numbering the records from 1 as they appear in the input")
+	fs.BoolVar(&opts.RecordTypeColumn, "record-type-column", false, "add a _record_type column naming the element each row came from")
+	fs.BoolVar(&opts.PreserveSpace, "preserve-space", false, "keep the content of elements that hold only whitespace, instead of writing them empty, as xml:space=\"preserve\" does")
+	fs.IntVar(&opts.MaxDepth, "max-depth", 1000, "fail on elements nested deeper than this (0 for no limit)")
+	fs.Int64Var(&opts.MaxTags, "max-tags", 0, "fail on input with more than this many elements (0 for no limit)")
+	fs.BoolVar(&opts.HTML, "html", false, "read the input as HTML, or SGML-ish XML: forgiving of unclosed tags, case, and unquoted attributes")
+	fs.BoolVar(&opts.Fragment, "fragment", false, "the input is a sequence of records with no enclosing root element")
+	fs.BoolVar(&opts.Lenient, "lenient", false, "on mismatched tags, warn and leave out the broken record, instead of failing")
+	fs.StringVar(&opts.Normalize, "normalize", "", "put the text into Unicode normalization form nfc or nfkc, so look-alike strings compare equal")
+	fs.BoolVar(&opts.RawEntities, "raw-entities", false, "leave references like &amp; and &#8212; as they are, instead of decoding them")
+}
+
+// readDoc parses all of the XML at path.
+func readDoc(path string, opts *Options) (*doc, error) {
+	in, err := openInput(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	d, err := parse(context.Background(), in, opts)
+	err2 := in.Close()
+	if err == nil {
+		err = err2
+	}
+	return d, inputError(path, err)
+}
+
+// inputError says which input err came from, when it has a name.
+func inputError(path string, err error) error {
+	if err == nil || path == "" || path == "-" {
+		return err
+	}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) && parseErr.File == "" {
+		parseErr.File = path
+	}
+	return err
+}
+
+// schemaSetup is the setup for the schema subcommand, which takes
+// -ddl, -table, -proto and -xsd besides the flags of inputSetup.
+func schemaSetup(fs *flag.FlagSet) func(args []string) error {
+	inPath, opts := inputFlags(fs)
+	var ddl string
+	var xsd, proto bool
+	fs.BoolVar(&xsd, "xsd", false, "instead of the columns, print an XML Schema inferred from the XML: its elements, where they appear, how many times, their attributes, and the types of their text")
+	fs.StringVar(&ddl, "ddl", "", "instead of the columns, print a CREATE TABLE statement for them, typed as -types-row infers, in this SQL `dialect`: postgres, mysql, or sqlite")
+	fs.StringVar(&opts.Table, "table", "records", "with -ddl, the `name` of the table to create")
+	fs.BoolVar(&proto, "proto", false, "instead of the columns, print a proto3 definition of a Record message with a field for each, typed as -types-row infers, that -format protobuf writes")
+	return func(args []string) error {
+		if len(args) > 0 {
+			*inPath = args[0]
+		}
+		switch ddl {
+		case "", "postgres", "mysql", "sqlite":
+		default:
+			return usagef("unknown -ddl '%v'; use postgres, mysql, or sqlite", ddl)
+		}
+		if xsd && ddl != "" || xsd && proto || ddl != "" && proto {
+			return usagef("only one of -xsd, -ddl, and -proto can be used")
+		}
+		verbosity(opts)
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		if xsd {
+			return runInferXSD(*inPath, opts)
+		}
+		return runSchema(*inPath, ddl, proto, opts)
+	}
+}
+
+// runSchema prints the csv columns, one per line, in header order,
+// or with a ddl dialect, the CREATE TABLE for them, or with proto,
+// the .proto of the Record message for them.
+func runSchema(path, ddl string, proto bool, opts *Options) error {
+	d, err := readDoc(path, opts)
+	if err != nil {
+		return err
+	}
+	if d.tree == nil {
+		return nil
+	}
+	cs := newColset(d, opts)
+	if ddl != "" {
+		fmt.Print(createTable(ddl, opts.table(), cs, ddlTypes(d.tree, cs)))
+		return nil
+	}
+	if proto {
+		fmt.Print(protoDefinition(cs.header, columnTypes(d.tree, cs)))
+		return nil
+	}
+	for _, name := range cs.final {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// runInferXSD prints an XML Schema inferred from the XML. It describes
+// the XML as it is, so leaves out the fields that the options add to
+// the records, and doesn't -explode or flatten -mixed content.
+func runInferXSD(path string, opts *Options) error {
+	o := *opts
+	o.Checksum, o.UUIDKey, o.SourceOffset, o.Explode = "", "", "", ""
+	o.RowNumbers, o.RecordTypeColumn, o.Mixed = false, false, false
+	d, err := readDoc(path, &o)
+	if err != nil {
+		return err
+	}
+	if d.tree == nil {
+		return nil
+	}
+	fmt.Print(inferXSD(d.tree))
+	return nil
+}
+
+// runInspect summarizes what is in the XML: the root and record
+// elements, how deep the nesting goes, and what the columns will be.
+func runInspect(path string, opts *Options) error {
+	d, err := readDoc(path, opts)
+	if err != nil {
+		return err
+	}
+	if d.tree == nil {
+		fmt.Println("no XML elements found.")
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for rec := d.tree.firstChild; rec != nil; rec = rec.nextSib {
+		counts[rec.name]++
+	}
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cs := newColset(d, opts)
+
+	fmt.Printf("root element:    %v\n", d.tree.name)
+	fmt.Printf("records:         %v\n", d.tree.numChild)
+	for _, name := range names {
+		fmt.Printf("    %-12v %v\n", name, counts[name])
+	}
+	fmt.Printf("max depth:       %v\n", maxDepth(d.tree))
+	fmt.Printf("columns:         %v\n", len(cs.final))
+	if len(cs.discarded) > 0 {
+		fmt.Printf("discarded:       %v (no content but %q)\n", strings.Join(cs.discarded, ", "), opts.discardValues())
+	}
+	return nil
+}
+
+// maxDepth returns how many levels of elements are nested under t, counting t.
+func maxDepth(t *Tag) (r int) {
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		if d := maxDepth(c); d > r {
+			r = d
+		}
+	}
+	return r + 1
+}
+
+// runTree re-displays the parsed XML, indented by depth.
+func runTree(path string, opts *Options) error {
+	d, err := readDoc(path, opts)
+	if err != nil {
+		return err
+	}
+	if d.tree != nil {
+		printXMLTree(d.tree, 0)
+	}
+	return nil
+}
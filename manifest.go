@@ -0,0 +1,225 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// -manifest writes, once the run is over, a JSON record of it, for
+// auditing what a pipeline did: each input, and each output, with
+// how many bytes it had and their SHA-256, as stored, compressed or
+// not; and for each csv (or other output) the records written to it,
+// its columns, and those left out for holding only -discard-values.
+// Outputs written in parts, or with schemas beside them, list each
+// file, and an output into a database has no bytes of its own. A run
+// that fails still writes its manifest, with the error.
+
+// The manifest of a run rides on its Options, if -manifest asks for
+// one; it is nil otherwise, and so are its notes.
+
+type manifest struct {
+	mu    sync.Mutex // workers convert files at once.
+	json  manifestJSON
+	outs  map[string]*manifestOutput // by path
+	sinks map[rowSink]*manifestOutput
+}
+
+type manifestJSON struct {
+	Version  string            `json:"xml2csv_version"`
+	Args     []string          `json:"args"`
+	Started  string            `json:"started"`
+	Finished string            `json:"finished"`
+	Error    string            `json:"error,omitempty"`
+	Inputs   []*manifestFile   `json:"inputs"`
+	Outputs  []*manifestOutput `json:"outputs"`
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+
+	h hash.Hash
+}
+
+type manifestOutput struct {
+	Path      string   `json:"path"`
+	Bytes     *int64   `json:"bytes,omitempty"`
+	SHA256    string   `json:"sha256,omitempty"`
+	Records   *int     `json:"records,omitempty"`
+	Columns   []string `json:"columns,omitempty"`
+	Discarded []string `json:"discarded_columns,omitempty"`
+}
+
+func newManifest(args []string) *manifest {
+	ver, _, _ := versionInfo()
+	return &manifest{
+		json: manifestJSON{
+			Version: ver,
+			Args:    args,
+			Started: time.Now().UTC().Format(time.RFC3339),
+			Inputs:  []*manifestFile{},
+			Outputs: []*manifestOutput{},
+		},
+		outs:  make(map[string]*manifestOutput),
+		sinks: make(map[rowSink]*manifestOutput),
+	}
+}
+
+// manifestPath is how the manifest names path, "-" for stdin or stdout.
+func manifestPath(path string) string {
+	if path == "" {
+		return "-"
+	}
+	return path
+}
+
+// output returns the entry for the output at path, adding it if new.
+func (m *manifest) output(path string) *manifestOutput {
+	path = manifestPath(path)
+	o, ok := m.outs[path]
+	if !ok {
+		o = &manifestOutput{Path: path}
+		m.outs[path] = o
+		m.json.Outputs = append(m.json.Outputs, o)
+	}
+	return o
+}
+
+// input notes path as an input, counting and hashing what is read of
+// it from r.
+func (m *manifest) input(path string, r io.ReadCloser) io.ReadCloser {
+	if m == nil {
+		return r
+	}
+	f := &manifestFile{Path: manifestPath(path), h: sha256.New()}
+	m.mu.Lock()
+	m.json.Inputs = append(m.json.Inputs, f)
+	m.mu.Unlock()
+	return &manifestReader{ReadCloser: r, m: m, f: f}
+}
+
+type manifestReader struct {
+	io.ReadCloser
+	m *manifest
+	f *manifestFile
+}
+
+func (r *manifestReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.m.mu.Lock()
+	r.f.Bytes += int64(n)
+	r.f.h.Write(p[:n])
+	r.m.mu.Unlock()
+	return n, err
+}
+
+// file notes path as an output, counting and hashing what is written
+// to it through w.
+func (m *manifest) file(path string, w io.WriteCloser) io.WriteCloser {
+	if m == nil {
+		return w
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o := m.output(path)
+	o.Bytes = new(int64)
+	return &manifestWriter{WriteCloser: w, m: m, o: o, h: sha256.New()}
+}
+
+type manifestWriter struct {
+	io.WriteCloser
+	m *manifest
+	o *manifestOutput
+	h hash.Hash
+}
+
+func (w *manifestWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.m.mu.Lock()
+	*w.o.Bytes += int64(n)
+	w.h.Write(p[:n])
+	w.m.mu.Unlock()
+	return n, err
+}
+
+func (w *manifestWriter) Close() error {
+	w.m.mu.Lock()
+	w.o.SHA256 = hex.EncodeToString(w.h.Sum(nil))
+	w.m.mu.Unlock()
+	return w.WriteCloser.Close()
+}
+
+// sink notes that the rows for the output at path go to sink.
+func (m *manifest) sink(sink rowSink, path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o := m.output(path)
+	o.Records = new(int)
+	m.sinks[sink] = o
+}
+
+// columns notes the columns of cs, written to sink.
+func (m *manifest) columns(sink rowSink, cs *colset) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if o, ok := m.sinks[sink]; ok {
+		o.Columns = cs.header
+		o.Discarded = cs.discarded
+	}
+}
+
+// records notes that n more records were written to sink.
+func (m *manifest) records(sink rowSink, n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if o, ok := m.sinks[sink]; ok {
+		*o.Records += n
+	}
+}
+
+// write writes the manifest to path, noting err, the outcome of the
+// run, which it returns, unless it fails to write the manifest.
+func (m *manifest) write(path string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.json.Finished = time.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		m.json.Error = err.Error()
+	}
+	for _, f := range m.json.Inputs {
+		f.SHA256 = hex.EncodeToString(f.h.Sum(nil))
+	}
+	sort.SliceStable(m.json.Inputs, func(i, j int) bool { return m.json.Inputs[i].Path < m.json.Inputs[j].Path })
+	sort.SliceStable(m.json.Outputs, func(i, j int) bool { return m.json.Outputs[i].Path < m.json.Outputs[j].Path })
+	js, err2 := json.MarshalIndent(&m.json, "", "  ")
+	if err2 == nil {
+		err2 = writeSchema(path, js, &Options{})
+	}
+	if err2 != nil {
+		if err == nil {
+			return fmt.Errorf("writing the manifest: %v", err2)
+		}
+		return fmt.Errorf("%w; and writing the manifest: %v", err, err2)
+	}
+	return err
+}
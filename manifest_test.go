@@ -0,0 +1,123 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readManifest reads the manifest at path.
+func readManifest(t *testing.T, path string) manifestJSON {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifestJSON
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// fileSum returns the size and SHA-256 of the file at path.
+func fileSum(t *testing.T, path string) (int64, string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(b)
+	return int64(len(b)), hex.EncodeToString(h[:])
+}
+
+func TestManifest(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	inputs := map[string]string{
+		"a.xml": "<r><p><x>1</x><y>None</y></p><p><x>2</x><y></y></p></r>",
+		"b.xml": "<r><p><z>3</z></p></r>",
+	}
+	var paths []string
+	for name, xml := range inputs {
+		path := filepath.Join(in, name)
+		if err := os.WriteFile(path, []byte(xml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	opts := Options{BQSchema: true}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	opts.manifest = newManifest([]string{"-bq-schema", "a.xml", "b.xml"})
+	err := convertFiles(paths, out, 2, &opts)
+	path := filepath.Join(out, "manifest.json")
+	if err := opts.manifest.write(path, err); err != nil {
+		t.Fatal(err)
+	}
+	m := readManifest(t, path)
+	if m.Version == "" || m.Started == "" || m.Finished == "" || m.Error != "" {
+		t.Errorf("version %q, started %q, finished %q, error %q", m.Version, m.Started, m.Finished, m.Error)
+	}
+	if want := []string{"-bq-schema", "a.xml", "b.xml"}; !reflect.DeepEqual(m.Args, want) {
+		t.Errorf("args %v, want %v", m.Args, want)
+	}
+
+	if len(m.Inputs) != 2 {
+		t.Fatalf("%v inputs, want 2", len(m.Inputs))
+	}
+	for i, f := range m.Inputs {
+		if want := filepath.Join(in, []string{"a.xml", "b.xml"}[i]); f.Path != want {
+			t.Errorf("input %v is %v, want %v", i, f.Path, want)
+		}
+		if n, sum := fileSum(t, f.Path); f.Bytes != n || f.SHA256 != sum {
+			t.Errorf("%v of %v bytes, sha256 %v; want %v, %v", f.Path, f.Bytes, f.SHA256, n, sum)
+		}
+	}
+
+	two, one := 2, 1
+	want := []*manifestOutput{
+		{Path: filepath.Join(out, "a.csv"), Records: &two, Columns: []string{"x"}, Discarded: []string{"y"}},
+		{Path: filepath.Join(out, "a.schema.json")},
+		{Path: filepath.Join(out, "b.csv"), Records: &one, Columns: []string{"z"}},
+		{Path: filepath.Join(out, "b.schema.json")},
+	}
+	for _, o := range want {
+		n, sum := fileSum(t, o.Path)
+		o.Bytes, o.SHA256 = &n, sum
+	}
+	if !reflect.DeepEqual(m.Outputs, want) {
+		got, _ := json.MarshalIndent(m.Outputs, "", "  ")
+		t.Errorf("outputs\n%s", got)
+	}
+}
+
+// A run that fails still has its manifest, with the error, which
+// write returns; and failing to write the manifest is an error too.
+func TestManifestError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	boom := errors.New("boom")
+	if err := newManifest(nil).write(path, boom); err != boom {
+		t.Errorf("got %v, want %v", err, boom)
+	}
+	if m := readManifest(t, path); m.Error != "boom" {
+		t.Errorf("error %q, want boom", m.Error)
+	}
+
+	bad := filepath.Join(path, "manifest.json")
+	if err := newManifest(nil).write(bad, nil); err == nil || !strings.HasPrefix(err.Error(), "writing the manifest: ") {
+		t.Errorf("got %v, want an error writing the manifest", err)
+	}
+	if err := newManifest(nil).write(bad, boom); !errors.Is(err, boom) || !strings.Contains(err.Error(), "; and writing the manifest: ") {
+		t.Errorf("got %v, want boom, and an error writing the manifest", err)
+	}
+}
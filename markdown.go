@@ -0,0 +1,88 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// markdownEscaper keeps a value within its cell of a Markdown table,
+// and its < and & from being taken for HTML, as the <br> is.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "&", "&amp;", "<", "&lt;", "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// markdownSink writes the rows as a Markdown table, for -format
+// markdown, to paste into issues and wikis. The rows are held until
+// close, so the columns can be lined up; it is meant for samples.
+type markdownSink struct {
+	bw *bufio.Writer
+	c  io.Closer
+
+	names []string
+	rows  [][]string
+}
+
+func (s *markdownSink) header(names, types []string) error {
+	s.names = make([]string, len(names))
+	for i, name := range names {
+		s.names[i] = markdownEscaper.Replace(name)
+	}
+	return nil
+}
+
+func (s *markdownSink) row(cells []cell) error {
+	row := make([]string, len(cells))
+	for i, c := range cells {
+		row[i] = markdownEscaper.Replace(c.value)
+	}
+	s.rows = append(s.rows, row)
+	return nil
+}
+
+func (s *markdownSink) flush() error { return nil }
+
+func (s *markdownSink) close() error {
+	if len(s.names) > 0 {
+		s.writeTable()
+	}
+	err := s.bw.Flush()
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (s *markdownSink) writeTable() {
+	// three dashes at least under each name, for it to be a table.
+	widths := make([]int, len(s.names))
+	for i := range widths {
+		widths[i] = 3
+	}
+	for _, row := range append([][]string{s.names}, s.rows...) {
+		for i, v := range row {
+			if n := utf8.RuneCountInString(v); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(row []string) {
+		s.bw.WriteString("|")
+		for i, v := range row {
+			s.bw.WriteString(" " + v + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)) + " |")
+		}
+		s.bw.WriteString("\n")
+	}
+	line(s.names)
+	rule := make([]string, len(widths))
+	for i, n := range widths {
+		rule[i] = strings.Repeat("-", n)
+	}
+	line(rule)
+	for _, row := range s.rows {
+		line(row)
+	}
+}
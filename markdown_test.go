@@ -0,0 +1,32 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	cases := []struct {
+		what, in, want string
+	}{
+		{"table", "<r><p><a>x | y</a><b>two\nlines</b><c>é</c></p><p><a>&lt;z&gt; &amp;amp;</a></p></r>", `| a                | b            | c   |
+| ---------------- | ------------ | --- |
+| x \| y           | two<br>lines | é   |
+| &lt;z> &amp;amp; |              |     |
+`},
+		{"no records", "<r/>", ""},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		if _, err := Convert(strings.NewReader(c.in), &out, Options{Format: "markdown"}); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.what, out.String(), c.want)
+		}
+	}
+}
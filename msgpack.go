@@ -0,0 +1,88 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// -format msgpack writes each row as a MessagePack map, one after
+// another, keyed by the column names, as -format jsonl does in JSON:
+// the values are strings, or nil for the xsi:nil elements, and a
+// record that lacks a column gets no key for it.
+
+// msgpackSink writes the rows as a stream of MessagePack maps, for -format msgpack.
+type msgpackSink struct {
+	bw    *bufio.Writer
+	c     io.Closer
+	names []string
+	b     []byte
+}
+
+func (s *msgpackSink) header(names, types []string) error {
+	s.names = names
+	return nil
+}
+
+func (s *msgpackSink) row(cells []cell) error {
+	n := 0
+	for _, c := range cells {
+		if c != (cell{}) {
+			n++
+		}
+	}
+	b := s.b[:0]
+	switch {
+	case n < 16:
+		b = append(b, 0x80|byte(n))
+	case n < 1<<16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+	for i, c := range cells {
+		if c == (cell{}) {
+			continue // the record lacks it.
+		}
+		b = msgpackString(b, s.names[i])
+		if !c.quoted {
+			b = append(b, 0xc0)
+		} else {
+			b = msgpackString(b, c.value)
+		}
+	}
+	s.b = b
+	_, err := s.bw.Write(b)
+	return err
+}
+
+// msgpackString appends v as a MessagePack str.
+func msgpackString(b []byte, v string) []byte {
+	switch n := len(v); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n < 1<<8:
+		b = append(b, 0xd9, byte(n))
+	case n < 1<<16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, v...)
+}
+
+func (s *msgpackSink) flush() error {
+	return s.bw.Flush()
+}
+
+func (s *msgpackSink) close() error {
+	err := s.bw.Flush()
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
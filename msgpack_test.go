@@ -0,0 +1,115 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readMsgpack decodes the stream of MessagePack maps of strings, or
+// nil, that b holds.
+func readMsgpack(t *testing.T, b []byte) []map[string]any {
+	t.Helper()
+	// size reads the length that follows a type byte, in n bytes.
+	size := func(n int) int {
+		var v int
+		for _, c := range b[:n] {
+			v = v<<8 | int(c)
+		}
+		b = b[n:]
+		return v
+	}
+	str := func() string {
+		h := b[0]
+		b = b[1:]
+		var n int
+		switch {
+		case h&0xe0 == 0xa0:
+			n = int(h & 0x1f)
+		case h == 0xd9:
+			n = size(1)
+		case h == 0xda:
+			n = size(2)
+		case h == 0xdb:
+			n = size(4)
+		default:
+			t.Fatalf("%#x where a str should be", h)
+		}
+		s := string(b[:n])
+		b = b[n:]
+		return s
+	}
+	var maps []map[string]any
+	for len(b) > 0 {
+		h := b[0]
+		b = b[1:]
+		var n int
+		switch {
+		case h&0xf0 == 0x80:
+			n = int(h & 0x0f)
+		case h == 0xde:
+			n = size(2)
+		case h == 0xdf:
+			n = size(4)
+		default:
+			t.Fatalf("%#x where a map should be", h)
+		}
+		m := map[string]any{}
+		for ; n > 0; n-- {
+			k := str()
+			if b[0] == 0xc0 {
+				b = b[1:]
+				m[k] = nil
+				continue
+			}
+			m[k] = str()
+		}
+		maps = append(maps, m)
+	}
+	return maps
+}
+
+func TestMsgpack(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	in := `<r xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <p><a>x &amp; y</a><b>1</b><c></c></p>
+  <p><a xsi:nil="true"/><b>` + long + `</b></p>
+</r>`
+	want := []map[string]any{
+		{"a": "x & y", "b": "1", "c": ""},
+		{"a": nil, "b": long},
+	}
+	for _, opts := range []Options{{Format: "msgpack", KeepAllColumns: true}, {Format: "msgpack", KeepAllColumns: true, NilString: "NULL"}} {
+		var out bytes.Buffer
+		if _, err := Convert(strings.NewReader(in), &out, opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := readMsgpack(t, out.Bytes()); !reflect.DeepEqual(got, want) {
+			t.Errorf("nil string %q: got %v, want %v", opts.NilString, got, want)
+		}
+	}
+}
+
+// The map and str headers are the smallest that fit.
+func TestMsgpackString(t *testing.T) {
+	for _, c := range []struct {
+		n    int
+		head []byte
+	}{
+		{0, []byte{0xa0}},
+		{31, []byte{0xbf}},
+		{32, []byte{0xd9, 32}},
+		{255, []byte{0xd9, 255}},
+		{256, []byte{0xda, 1, 0}},
+		{1 << 16, []byte{0xdb, 0, 1, 0, 0}},
+	} {
+		b := msgpackString(nil, strings.Repeat("x", c.n))
+		if !bytes.HasPrefix(b, c.head) || len(b) != len(c.head)+c.n {
+			t.Errorf("a str of %v starts % x, and is %v long; want it to start % x", c.n, b[:len(c.head)], len(b), c.head)
+		}
+	}
+}
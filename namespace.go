@@ -0,0 +1,90 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A prefix like "onix:" is only a local nickname for a namespace URI,
+// and different files pick different nicknames for the same URI. A
+// namespace map file gives each URI its canonical prefix, so the
+// column names come out the same whatever the file chose. For example:
+//
+//	http://ns.editeur.org/onix/3.0/reference: onix
+//	http://purl.org/dc/elements/1.1/: dc
+//
+// Elements in a namespace that is not listed keep their own prefix.
+
+// loadNamespaceMap reads the namespace map file at path.
+func loadNamespaceMap(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, usagef("%v: %v", path, err)
+	}
+	return m, nil
+}
+
+// xmlns returns the namespaces that t declares, by prefix;
+// the default namespace, from xmlns="...", is under "".
+func xmlns(t *Tag) (r map[string]string) {
+	for _, a := range t.attrs() {
+		prefix, ok := "", a.name == "xmlns"
+		if !ok {
+			prefix, ok = strings.CutPrefix(a.name, "xmlns:")
+		}
+		if ok {
+			if r == nil {
+				r = make(map[string]string)
+			}
+			r[prefix] = a.value
+		}
+	}
+	return
+}
+
+// namespaceURI returns the URI that prefix stands for at t,
+// whose open ancestors are on p.stack.
+func (p *parser) namespaceURI(t *Tag, prefix string) (string, bool) {
+	if uri, ok := t.xmlns[prefix]; ok {
+		return uri, true
+	}
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		if uri, ok := p.stack[i].xmlns[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+// canonicalName renames t's column after the canonical prefix
+// for its namespace, if the namespace map has one.
+func (p *parser) canonicalName(t *Tag) {
+	t.xmlns = xmlns(t)
+	prefix, local, ok := strings.Cut(t.name, ":")
+	if !ok {
+		prefix, local = "", t.name
+	}
+	uri, ok := p.namespaceURI(t, prefix)
+	if !ok {
+		return
+	}
+	alias, ok := p.opts.NamespaceMap[uri]
+	if !ok {
+		return
+	}
+	if alias != "" {
+		local = fmt.Sprintf("%v:%v", alias, local)
+	}
+	t.colname = p.opts.colName(local)
+	t.base = t.colname
+}
@@ -0,0 +1,677 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Options control how the XML is converted, and how the csv is written.
+// The zero value gives the original, default, behavior.
+type Options struct {
+
+	// Compress is "gzip" or "zstd" to compress the csv as
+	// it is written, or "" for plain text.
+	Compress string
+
+	// Delimiter separates the fields of the csv, like '\t' or '|',
+	// instead of a comma.
+	Delimiter rune
+
+	// Quote is how the fields are quoted: "always" (or "") puts every
+	// value in quotes, "minimal" only those holding the delimiter, a
+	// quote, or a line break, and "never" none of them, leaving it to
+	// the reader to cope.
+	Quote string
+
+	// CRLF ends each line of csv with "\r\n", as RFC 4180 has it,
+	// rather than "\n".
+	CRLF bool
+
+	// BOM starts the csv with a UTF-8 byte order mark, without which
+	// Excel takes it for the local code page, and mangles anything
+	// beyond ASCII.
+	BOM bool
+
+	// Dialect "excel" bundles what Excel wants to double-click cleanly
+	// into a sheet: a BOM, CRLF line ends, every value quoted, and a
+	// "sep=," line ahead of the header naming the delimiter.
+	Dialect string
+
+	// Newlines is what becomes of the line breaks within a value:
+	// "keep" (or "") keeps them, in a quoted field; "escape" writes
+	// them as \n; and "space" replaces each by a space, so that every
+	// record is one line.
+	Newlines string
+
+	// NoHeader leaves out the header line, for output that is
+	// appended to other csv, or loaded under a header of its own.
+	NoHeader bool
+
+	// Format is what the records are written as, one of:
+	//
+	//	"wide" (or "")  csv, a column per path and a row per record
+	//	"long"          csv, a row per value: record, path, value
+	//	"jsonl"         a JSON object per record, a line each
+	//	"json"          one JSON array of the records, nested as they were
+	//	"msgpack"       the objects of "jsonl", as MessagePack maps
+	//	"parquet"       a Parquet file, typed as for TypesRow
+	//	"arrow"         an Arrow IPC stream, typed the same
+	//	"avro"          an Avro Object Container File
+	//	"orc"           an ORC file
+	//	"protobuf"      length delimited protocol buffers, with a .proto
+	//	"duckdb"        the Table of a DuckDB database, by the duckdb tool
+	//	"pgcopy"        Postgres COPY text, or loaded into DSN's Table
+	//	"xlsx"          an Excel workbook of one sheet
+	//	"markdown"      a Markdown table
+	//	"html"          a table in a web page, styled if HTMLStyle
+	//
+	// The sink for each says more.
+	Format    string
+	HTMLStyle bool
+
+	// DSN, with -format pgcopy, is the Postgres connection string,
+	// like postgres://user@host/db, that psql loads the rows with.
+	DSN string
+
+	// Table is the table that -format duckdb creates or appends to,
+	// or that -format pgcopy loads into; if "", it is "records".
+	Table string
+
+	// BQSchema writes a BigQuery schema for the csv next to it, as
+	// out.schema.json for out.csv, for bq load to take.
+	BQSchema bool
+
+	// JSONSchema writes a JSON Schema for the objects of -format
+	// jsonl next to them, as out.schema.json for out.jsonl.
+	JSONSchema bool
+
+	// DataPackage writes a Frictionless Data Package describing the
+	// csv next to it, as out.datapackage.json for out.csv.
+	DataPackage bool
+
+	// TypesRow adds a second line to the header, giving the type of
+	// each column, as its values show it: string, integer, decimal,
+	// or date. With Stream, only the sample records are looked at.
+	TypesRow bool
+
+	// Columns, when set, are exactly the columns written, in this
+	// order: any others are left out, and any that the input lacks
+	// are written empty, so the output is the same shape whatever
+	// the input.
+	Columns []string
+
+	// StrictWidth fails, instead of dropping it with a warning, on a
+	// value that no column of the header takes, as when a -stream
+	// record has an element that the sample records did not.
+	StrictWidth bool
+
+	// ColumnOrder is "alpha" (or "") to sort the columns by name, or
+	// "document" to keep them in the order they first appear in the
+	// XML, so the header follows the structure of the record.
+	ColumnOrder string
+
+	// Include, when set, keeps only the columns whose names match one
+	// of its patterns, and Exclude drops those matching one of its own.
+	// A pattern is a glob, or a regular expression after "re:".
+	Include []string
+	Exclude []string
+
+	// Rename gives friendlier names for the header to use in place
+	// of the flattened ones, like "title" for
+	// "DescriptiveDetail_TitleDetail_TitleElement_TitleText". Columns,
+	// Include and Exclude go by the flattened names.
+	Rename map[string]string
+
+	// MaxRows and MaxBytes, when > 0, split the csv output into
+	// parts of at most this many rows, or bytes, each. Every part
+	// starts with the header.
+	MaxRows  int64
+	MaxBytes int64
+
+	// Stream writes rows as soon as their records have been read,
+	// keeping memory bounded, instead of reading the whole input
+	// first. The columns then come from the first StreamSample records,
+	// or 100 if it is 0.
+	Stream       bool
+	StreamSample int
+
+	// SplitDocs writes each of several XML documents found back to
+	// back in one input to its own csv. Otherwise, their records
+	// are all written to the same csv.
+	SplitDocs bool
+
+	// SplitRecords writes each kind of record, like <Product> and
+	// <DeletedProduct>, to its own csv, instead of all to the same one.
+	// RecordTypeColumn instead adds a _record_type column telling
+	// which kind each row is.
+	SplitRecords     bool
+	RecordTypeColumn bool
+
+	// RowNumbers adds a _row column, first, numbering the records
+	// from 1 in the order they appear in the input, so a row can be
+	// traced back to its record, even when others were left out.
+	RowNumbers bool
+
+	// SourceOffset, "byte" or "line", adds a column giving where each
+	// record began in the input: _offset, its byte offset from 0, or
+	// _line, its line number from 1. Input in another -encoding is
+	// counted after it is decoded to UTF-8.
+	SourceOffset string
+
+	// Checksum, "sha256" or "fnv64", adds a _checksum column holding
+	// that hash of each record's canonical XML, so a record that has
+	// changed between deliveries can be told from one that has not.
+	Checksum string
+
+	// UUIDKey, the path from the record to an element like
+	// RecordReference, adds a _uuid column holding the version 5 UUID
+	// of that element's content, in UUIDNamespace, which is the RFC
+	// 4122 URL namespace if empty: a stable surrogate key for loading
+	// into a database.
+	UUIDKey       string
+	UUIDNamespace string
+
+	// SourceColumn adds a _source_file column to combined output,
+	// telling which input file each row came from.
+	SourceColumn bool
+
+	// PreserveSpace keeps the content of elements that hold only
+	// whitespace, as xml:space="preserve" does for its element,
+	// instead of writing them as empty. Whitespace around other
+	// content is always kept.
+	PreserveSpace bool
+
+	// Normalize is "nfc" or "nfkc" (or "nfd" or "nfkd") to put the
+	// text into that Unicode normalization form, so that strings that
+	// look the same compare equal, or "" to leave it as it is.
+	Normalize string
+
+	// RawEntities leaves entity and character references, like
+	// &amp; and &#8212;, as they are in the XML, instead of
+	// decoding them into the text they stand for.
+	RawEntities bool
+
+	// Mixed treats an element with text alongside its child elements,
+	// like <p>Hello <b>world</b> again</p>, as one cell holding all
+	// of its text, instead of as separate columns for the children.
+	Mixed bool
+
+	// Encoding is the character encoding of the input, like
+	// "ISO-8859-1" or "Shift_JIS", overriding what the XML declares.
+	Encoding string
+
+	// KeepNamespace keeps the namespace prefixes of the elements in the
+	// column names, so dc:title and onix:title stay different columns.
+	// The prefix is joined to the name with NamespaceSep, "_" if empty.
+	KeepNamespace bool
+	NamespaceSep  string
+
+	// PathSep joins the names of nested elements into a column name,
+	// as in Contributor_Name; "_" if empty. Since tag names may hold
+	// underscores of their own, "." or "/" can be clearer.
+	PathSep string
+
+	// NamespaceMap gives the canonical prefix for each namespace URI,
+	// to name the columns with, whatever prefix the XML itself uses.
+	NamespaceMap map[string]string
+
+	// NilString is written, without quotes, for an element marked
+	// xsi:nil="true". Every other value is quoted, so even the
+	// default "" is distinct from a genuinely empty string.
+	NilString string
+
+	// NullString is written, without quotes, for a column the record
+	// has no element for, like \N or NULL for Postgres COPY or Hive,
+	// instead of nothing. It stands in for an xsi:nil element, too,
+	// unless NilString gives that a value of its own.
+	NullString string
+
+	// DiscardValues are the values that don't count as content: a
+	// column that holds nothing else is left out of the csv. If
+	// nil, they are "" and "None".
+	DiscardValues []string
+
+	// KeepAllColumns turns that off, keeping every column, however
+	// empty, for a faithful flattening.
+	KeepAllColumns bool
+
+	// SkipTags are the elements left out of the columns, by name, like
+	// "schema:created", or by path from the record, like
+	// "Product/Contributor/Role". If nil, they are schema:created and
+	// schema:modified, the bookkeeping that schema.org feeds carry.
+	SkipTags []string
+
+	// JoinRepeats, when set, joins the values of a simple element
+	// that repeats among its siblings into one cell, separated by
+	// this, like "|", instead of giving each repeat a column of its
+	// own, as in Subject, Subject1, Subject2.
+	JoinRepeats string
+
+	// Explode, the path from the record to an element that repeats,
+	// like Contributor or DescriptiveDetail/Contributor, makes a row
+	// for each of them, with the rest of the record repeated in
+	// each, instead of a numbered set of columns for each.
+	Explode string
+
+	// Carry, with Explode, names the paths from the record, like Title
+	// or ProductIdentifier/IDValue, of what is copied onto each of the
+	// rows made for the second and later of the repeated elements. The
+	// first row keeps the whole record. If nil, all of it is copied.
+	Carry []string
+
+	// Relational writes each structure that repeats within a record
+	// to a csv table of its own, linked to the record's row by a
+	// _parent_id column, instead of a numbered set of columns for each.
+	Relational bool
+
+	// DupSuffix formats the number that tells the columns of repeated
+	// siblings apart, as in title, title1, title2: "%d" if empty, or
+	// the likes of "[%d]" or "_%02d". The first element counts as
+	// DupStart, so its repeats are numbered from DupStart+1.
+	DupSuffix string
+	DupStart  int
+
+	// Lang keeps only the elements in this xml:lang, like "en",
+	// dropping their translations. Elements without a language
+	// are always kept.
+	Lang string
+
+	// LangColumns names the column of each element that has an
+	// xml:lang for its language, as in title_en and title_fr,
+	// instead of numbering the repeats title and title1.
+	LangColumns bool
+
+	// ValueAttrs lists attributes, like rdf:resource and href, whose
+	// value becomes the content of a self-closed element that has
+	// one, as in <schema:url rdf:resource="http://..."/>. The first
+	// one listed that the element has is used.
+	ValueAttrs []string
+
+	// Lenient recovers from close tags that don't match, and from
+	// input that ends with elements still open, instead of failing:
+	// the records they break are left out, with a warning, and the
+	// rest are converted.
+	Lenient bool
+
+	// HTML reads the input forgivingly, as HTML: names are case
+	// insensitive, void elements like <br> need no close tag, close
+	// tags that HTML lets you leave out are implied, and any other
+	// close tag that doesn't match is worked around.
+	HTML bool
+
+	// Fragment reads input that is a sequence of records with no
+	// enclosing root element, like <rec>...</rec><rec>...</rec>,
+	// by wrapping all of it in a synthetic root.
+	Fragment bool
+
+	// Record is the path, from the root, of the elements that each
+	// become one row, like "ONIXMessage/Product"; a "*" step matches
+	// any element, and "Product|DeletedProduct" either one. Everything
+	// outside those elements is left out.
+	// By default, the records are the children of the root, unless,
+	// as with the Products of an ONIX file, they are plainly held in
+	// an element deeper down, which a note on Warnings tells of; with
+	// Stream, they are always the children of the root. With
+	// Fragment, the path starts at the top level elements instead.
+	Record string
+
+	// MaxDepth and MaxTags, when > 0, fail the parse of input whose
+	// elements nest more than MaxDepth deep, or that holds more than
+	// MaxTags elements, so that hostile or corrupt input fails fast,
+	// instead of using up all the memory.
+	MaxDepth int
+	MaxTags  int64
+
+	// XSD is an XML Schema to validate the input against. Records
+	// that fail it are left out of the csv, and written instead,
+	// with their violations, to Rejects, or to stderr if it is nil.
+	XSD     string
+	Rejects io.Writer
+
+	// Warnings is where the warnings and notes of the conversion go,
+	// like the bad XML it worked around, or the columns it left out:
+	// os.Stderr if nil, or io.Discard for none. Verbose adds notes
+	// of its progress, like how many records and columns it found.
+	Warnings io.Writer
+	Verbose  bool
+
+	// manifest notes the files that the command reads and writes,
+	// for -manifest; it is nil otherwise, as it is for Convert.
+	manifest *manifest
+
+	// rootRecords, for Parse, leaves the records the children of the
+	// root, without detecting them deeper down.
+	rootRecords bool
+}
+
+// validate checks the Options for values we don't understand.
+func (o *Options) validate() error {
+	switch o.Compress {
+	case "", "gzip", "zstd":
+	default:
+		return usagef("unknown -compress '%v'; use gzip or zstd", o.Compress)
+	}
+	switch o.Quote {
+	case "", "always", "minimal", "never":
+	default:
+		return usagef("unknown -quote '%v'; use always, minimal, or never", o.Quote)
+	}
+	switch o.Dialect {
+	case "":
+	case "excel":
+		if o.Quote != "" && o.Quote != "always" {
+			return usagef("-dialect excel quotes every value, so it cannot be used with -quote %v", o.Quote)
+		}
+	default:
+		return usagef("unknown -dialect '%v'; the only one is excel", o.Dialect)
+	}
+	switch o.Format {
+	case "", "wide", "long":
+	case "jsonl", "json", "msgpack", "pgcopy", "markdown", "html":
+		if o.MaxRows > 0 || o.MaxBytes > 0 {
+			return usagef("-max-rows and -max-bytes split csv output, not -format %v", o.Format)
+		}
+	case "parquet", "arrow", "avro", "orc", "protobuf", "duckdb", "xlsx":
+		if o.MaxRows > 0 || o.MaxBytes > 0 {
+			return usagef("-max-rows and -max-bytes split csv output, not -format %v", o.Format)
+		}
+		if o.Compress != "" {
+			return usagef("-format %v cannot be used with -compress", o.Format)
+		}
+	default:
+		return usagef("unknown -format '%v'; use wide, long, jsonl, json, msgpack, parquet, arrow, avro, orc, protobuf, duckdb, pgcopy, xlsx, markdown, or html", o.Format)
+	}
+	if o.DSN != "" && o.Format != "pgcopy" {
+		return usagef("-dsn is for loading -format pgcopy into Postgres")
+	}
+	if o.BQSchema && o.Format != "" && o.Format != "wide" {
+		return usagef("-bq-schema is for csv output, not -format %v", o.Format)
+	}
+	if o.DataPackage {
+		switch {
+		case o.Format != "" && o.Format != "wide":
+			return usagef("-datapackage is for csv output, not -format %v", o.Format)
+		case o.TypesRow || o.excel():
+			return usagef("-datapackage describes a csv with one header line, so cannot be used with -types-row or -dialect excel")
+		case o.MaxRows > 0 || o.MaxBytes > 0:
+			return usagef("-datapackage describes one csv, so cannot be used with -max-rows or -max-bytes")
+		}
+	}
+	if o.JSONSchema && o.Format != "jsonl" {
+		return usagef("-json-schema is for -format jsonl")
+	}
+	if o.HTMLStyle && o.Format != "html" {
+		return usagef("-html-style only applies with -format html")
+	}
+	switch o.SourceOffset {
+	case "", "byte", "line":
+	default:
+		return usagef("unknown -source-offset '%v'; use byte or line", o.SourceOffset)
+	}
+	switch o.Checksum {
+	case "", "sha256", "fnv64":
+	default:
+		return usagef("unknown -checksum '%v'; use sha256 or fnv64", o.Checksum)
+	}
+	if _, err := parseUUID(o.uuidNamespace()); err != nil {
+		return usagef("bad -uuid-namespace: %v", err)
+	}
+	switch o.Newlines {
+	case "", "keep", "escape", "space":
+	default:
+		return usagef("unknown -newlines '%v'; use keep, escape, or space", o.Newlines)
+	}
+	switch o.ColumnOrder {
+	case "", "alpha", "document":
+	default:
+		return usagef("unknown -column-order '%v'; use alpha or document", o.ColumnOrder)
+	}
+	if _, err := compilePatterns(o.Include); err != nil {
+		return err
+	}
+	if _, err := compilePatterns(o.Exclude); err != nil {
+		return err
+	}
+	if s := fmt.Sprintf(o.dupSuffix(), 1); strings.Contains(s, "%!") || !strings.ContainsAny(s, "0123456789") {
+		return usagef("-dup-suffix '%v' needs one number verb, like %%d or %%02d", o.DupSuffix)
+	}
+	if o.DupStart < 0 {
+		return usagef("-dup-start cannot be negative")
+	}
+	if len(o.Carry) > 0 && o.Explode == "" {
+		return usagef("-carry says what -explode copies onto its rows, so it needs -explode")
+	}
+	if o.Relational && (o.Stream || o.SplitDocs || o.SplitRecords || o.Explode != "") {
+		return usagef("-relational cannot be used with -stream, -split-docs, -split-records, or -explode")
+	}
+	if len(o.Columns) > 0 && (len(o.Include) > 0 || len(o.Exclude) > 0) {
+		return usagef("-columns already picks the columns, so -include and -exclude cannot be used with it")
+	}
+	seen := make(map[string]bool)
+	for _, name := range o.Columns {
+		if name == "" {
+			return usagef("-columns has an empty column name")
+		}
+		if seen[name] {
+			return usagef("-columns names '%v' twice", name)
+		}
+		seen[name] = true
+	}
+	if o.MaxRows < 0 || o.MaxBytes < 0 {
+		return usagef("-max-rows and -max-bytes cannot be negative")
+	}
+	if o.Normalize != "" && o.normForm() == nil {
+		return usagef("unknown -normalize '%v'; use nfc or nfkc", o.Normalize)
+	}
+	if o.MaxDepth < 0 || o.MaxTags < 0 {
+		return usagef("-max-depth and -max-tags cannot be negative")
+	}
+	if o.StreamSample < 0 {
+		return usagef("-stream-sample cannot be negative")
+	}
+	if o.Stream && o.SplitDocs {
+		return usagef("-stream and -split-docs cannot be used together")
+	}
+	if o.SplitRecords && (o.Stream || o.SplitDocs) {
+		return usagef("-split-records cannot be used with -stream or -split-docs")
+	}
+	if o.Record != "" {
+		steps := o.recordPath()
+		for _, step := range steps {
+			if step == "" {
+				return usagef("-record '%v' has an empty step", o.Record)
+			}
+		}
+		if len(steps) < 2 {
+			return usagef("-record '%v' must name the root, and then the record element within it", o.Record)
+		}
+	}
+	return nil
+}
+
+// colName is the column name for the element name, like "dc:title":
+// "title", or "dc_title" if we keep namespaces.
+func (o *Options) colName(name string) string {
+	if !o.KeepNamespace {
+		return stripNamespace(name)
+	}
+	sep := o.NamespaceSep
+	if sep == "" {
+		sep = "_"
+	}
+	return strings.Replace(name, ":", sep, 1)
+}
+
+// discardValues is DiscardValues, or else "" and "None".
+func (o *Options) discardValues() []string {
+	if o.DiscardValues == nil {
+		return []string{"", "None"}
+	}
+	return o.DiscardValues
+}
+
+// skipTags is SkipTags, or else schema:created and schema:modified.
+func (o *Options) skipTags() []string {
+	if o.SkipTags == nil {
+		return []string{"schema:created", "schema:modified"}
+	}
+	return o.SkipTags
+}
+
+// dupSuffix is DupSuffix, or "%d" if none is set.
+func (o *Options) dupSuffix() string {
+	if o.DupSuffix == "" {
+		return "%d"
+	}
+	return o.DupSuffix
+}
+
+// uuidNamespace is UUIDNamespace, or else the URL namespace.
+func (o *Options) uuidNamespace() string {
+	if o.UUIDNamespace == "" {
+		return urlNamespace
+	}
+	return o.UUIDNamespace
+}
+
+// pathSep is the PathSep, or "_" if none is set.
+func (o *Options) pathSep() string {
+	if o.PathSep == "" {
+		return "_"
+	}
+	return o.PathSep
+}
+
+// recordPath splits Record into its steps. With Fragment, a step
+// for the synthetic root comes first.
+func (o *Options) recordPath() []string {
+	if o.Record == "" {
+		return nil
+	}
+	steps := strings.Split(strings.TrimPrefix(o.Record, "/"), "/")
+	if o.Fragment {
+		steps = append([]string{"*"}, steps...)
+	}
+	return steps
+}
+
+// normForm is the Unicode normalization form that Normalize names,
+// or nil if it names none.
+func (o *Options) normForm() *norm.Form {
+	var f norm.Form
+	switch strings.ToLower(o.Normalize) {
+	case "nfc":
+		f = norm.NFC
+	case "nfkc":
+		f = norm.NFKC
+	case "nfd":
+		f = norm.NFD
+	case "nfkd":
+		f = norm.NFKD
+	default:
+		return nil
+	}
+	return &f
+}
+
+// delimiter is the Delimiter, or a comma if none is set.
+func (o *Options) delimiter() rune {
+	if o.Delimiter == 0 {
+		return ','
+	}
+	return o.Delimiter
+}
+
+// excel reports whether we are writing for Excel.
+func (o *Options) excel() bool {
+	return o.Dialect == "excel"
+}
+
+// newline is what ends each line of csv.
+func (o *Options) newline() []byte {
+	if o.CRLF || o.excel() {
+		return crlf
+	}
+	return newline
+}
+
+// typed reports whether the Format stores typed values, rather than
+// lines of text: parquet, arrow, avro, orc, protobuf, duckdb, and xlsx.
+func (o *Options) typed() bool {
+	switch o.Format {
+	case "parquet", "arrow", "avro", "orc", "protobuf", "duckdb", "xlsx":
+		return true
+	}
+	return false
+}
+
+// database reports whether the rows go into a database, rather than
+// a file of their own.
+func (o *Options) database() bool {
+	return o.Format == "duckdb" || o.DSN != ""
+}
+
+// table is Table, or else "records".
+func (o *Options) table() string {
+	if o.Table == "" {
+		return "records"
+	}
+	return o.Table
+}
+
+// streamSample is StreamSample, or else 100.
+func (o *Options) streamSample() int {
+	if o.StreamSample == 0 {
+		return 100
+	}
+	return o.StreamSample
+}
+
+// csvExt is the file extension for the csv files we write:
+// ".csv", or ".csv.gz" or ".csv.zst" when compressing; or for
+// -format jsonl, json, pgcopy or markdown, ".jsonl" and so on, and for
+// -format parquet, arrow, avro, duckdb, or xlsx, ".parquet" and so on.
+func (o *Options) csvExt() string {
+	ext := ".csv"
+	switch o.Format {
+	case "jsonl":
+		ext = ".jsonl"
+	case "json":
+		ext = ".json"
+	case "msgpack":
+		ext = ".msgpack"
+	case "pgcopy":
+		ext = ".copy"
+	case "markdown":
+		ext = ".md"
+	case "html":
+		ext = ".html"
+	case "parquet":
+		return ".parquet"
+	case "arrow":
+		return ".arrows"
+	case "avro":
+		return ".avro"
+	case "orc":
+		return ".orc"
+	case "protobuf":
+		return ".pb"
+	case "duckdb":
+		return ".duckdb"
+	case "xlsx":
+		return ".xlsx"
+	}
+	switch o.Compress {
+	case "gzip":
+		return ext + ".gz"
+	case "zstd":
+		return ext + ".zst"
+	}
+	return ext
+}
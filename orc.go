@@ -0,0 +1,404 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// -format orc writes the rows as an ORC file, the columnar format of
+// Hive and Presto. Its columns are typed as for -format parquet, as
+// LONG, DOUBLE, or STRING, and any may be null, for the records that
+// lack it. The rows go in stripes of orcStripeRows, each of its
+// columns DIRECT encoded, in run length encoding version 1, and the
+// streams ZLIB compressed. There is no row index, which is optional.
+
+const (
+	orcStripeRows = 1 << 17
+	orcBlockSize  = 1 << 18 // most bytes compressed as one chunk
+)
+
+// The ORC enums we use, from orc_proto.proto.
+const (
+	orcLong   = 4
+	orcDouble = 6
+	orcString = 7
+	orcStruct = 12
+
+	orcPresent = 0
+	orcData    = 1
+	orcLength  = 2
+
+	orcZlib = 1
+)
+
+// orcSink writes the rows as an ORC file, for -format orc.
+type orcSink struct {
+	bw *bufio.Writer
+	c  io.Closer
+
+	cols    []*typedColumn
+	rows    int // in the stripe being filled
+	total   int
+	offset  int64
+	stripes [][]byte // the StripeInformation of each written stripe
+	values  []int    // each column's count of values, not nulls
+	nulls   []bool   // ... and whether it has any nulls
+}
+
+func newOrcSink(wc io.WriteCloser) *orcSink {
+	s := &orcSink{bw: bufio.NewWriter(wc), c: wc}
+	s.write([]byte("ORC"))
+	return s
+}
+
+func (s *orcSink) write(b []byte) {
+	n, _ := s.bw.Write(b) // an error sticks, for close to report.
+	s.offset += int64(n)
+}
+
+func (s *orcSink) header(names, types []string) error {
+	s.cols = newTypedColumns(names, types)
+	s.values = make([]int, len(names))
+	s.nulls = make([]bool, len(names))
+	return nil
+}
+
+func (s *orcSink) row(cells []cell) error {
+	for i, c := range cells {
+		if err := s.cols[i].add(c, s.total+s.rows+1); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	if s.rows >= orcStripeRows {
+		return s.writeStripe()
+	}
+	return nil
+}
+
+// flush leaves the rows of a stripe that is not yet full, for close,
+// rather than writing a stripe for each row that -stream flushes.
+func (s *orcSink) flush() error { return nil }
+
+// close writes the last stripe and the file's footer, and closes the
+// output, whether or not they could be written.
+func (s *orcSink) close() error {
+	err := s.finish()
+	if err == nil {
+		err = s.bw.Flush()
+	}
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// finish writes the rows of the last stripe, and the footer and
+// postscript that end the file.
+func (s *orcSink) finish() error {
+	if s.rows > 0 {
+		if err := s.writeStripe(); err != nil {
+			return err
+		}
+	}
+	footer, err := orcCompress(s.footer())
+	if err != nil {
+		return err
+	}
+	s.write(footer)
+
+	var ps pbWriter
+	ps.uint(1, uint64(len(footer)))
+	ps.uint(2, orcZlib)
+	ps.uint(3, orcBlockSize)
+	ps.packed(4, 0, 12) // version 0.12
+	ps.uint(5, 0)       // no stripe statistics
+	ps.uint(6, 6)       // writer version ORC-135
+	ps.bytes(8000, []byte("ORC"))
+	s.write(ps.b)
+	s.write([]byte{byte(len(ps.b))})
+	return nil
+}
+
+// writeStripe writes the rows held as a stripe: the streams of each
+// column, and the stripe's footer, listing them.
+func (s *orcSink) writeStripe() error {
+	at := s.offset
+	var footer pbWriter
+	var encodings [][]byte
+	var data int64
+	stream := func(kind, column int, p []byte) error {
+		z, err := orcCompress(p)
+		if err != nil {
+			return err
+		}
+		s.write(z)
+		data += int64(len(z))
+		var m pbWriter
+		m.uint(1, uint64(kind))
+		m.uint(2, uint64(column))
+		m.uint(3, uint64(len(z)))
+		footer.bytes(1, m.b)
+		return nil
+	}
+	// every column is DIRECT encoded, the root struct first.
+	var direct pbWriter
+	direct.uint(1, 0)
+	encodings = append(encodings, direct.b)
+
+	for i, col := range s.cols {
+		id := i + 1
+		present := 0
+		for _, ok := range col.valid {
+			if ok {
+				present++
+			}
+		}
+		s.values[i] += present
+		if present < len(col.valid) {
+			s.nulls[i] = true
+			if err := stream(orcPresent, id, orcBits(col.valid)); err != nil {
+				return err
+			}
+		}
+		var err error
+		switch col.typ {
+		case typeInteger:
+			err = stream(orcData, id, orcInts(col.ints, true))
+		case typeDecimal:
+			b := make([]byte, 0, 8*len(col.floats))
+			for _, v := range col.floats {
+				b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+			}
+			err = stream(orcData, id, b)
+		default:
+			var b []byte
+			lengths := make([]int64, len(col.strs))
+			for j, v := range col.strs {
+				b = append(b, v...)
+				lengths[j] = int64(len(v))
+			}
+			if err = stream(orcData, id, b); err == nil {
+				err = stream(orcLength, id, orcInts(lengths, false))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		encodings = append(encodings, direct.b)
+		col.reset()
+	}
+	for _, e := range encodings {
+		footer.bytes(2, e)
+	}
+	z, err := orcCompress(footer.b)
+	if err != nil {
+		return err
+	}
+	s.write(z)
+
+	var info pbWriter
+	info.uint(1, uint64(at))
+	info.uint(2, 0) // no index
+	info.uint(3, uint64(data))
+	info.uint(4, uint64(len(z)))
+	info.uint(5, uint64(s.rows))
+	s.stripes = append(s.stripes, info.b)
+	s.total += s.rows
+	s.rows = 0
+	return s.bw.Flush()
+}
+
+// footer returns the file's footer: the stripes, the types, and the
+// count of values in each column.
+func (s *orcSink) footer() []byte {
+	var f pbWriter
+	f.uint(1, 3) // the "ORC" header
+	f.uint(2, uint64(s.offset))
+	for _, info := range s.stripes {
+		f.bytes(3, info)
+	}
+
+	var root pbWriter
+	root.uint(1, orcStruct)
+	ids := make([]uint64, len(s.cols))
+	for i := range s.cols {
+		ids[i] = uint64(i + 1)
+	}
+	root.packed(2, ids...)
+	for _, col := range s.cols {
+		root.bytes(3, []byte(col.name))
+	}
+	f.bytes(4, root.b)
+	for _, col := range s.cols {
+		var t pbWriter
+		t.uint(1, orcType(col.typ))
+		f.bytes(4, t.b)
+	}
+
+	f.uint(6, uint64(s.total))
+	var stats pbWriter
+	stats.uint(1, uint64(s.total))
+	f.bytes(7, stats.b)
+	for i := range s.cols {
+		var stats pbWriter
+		stats.uint(1, uint64(s.values[i]))
+		if s.nulls[i] {
+			stats.uint(10, 1)
+		}
+		f.bytes(7, stats.b)
+	}
+	f.uint(8, 0) // no row index
+	return f.b
+}
+
+func orcType(typ string) uint64 {
+	switch typ {
+	case typeInteger:
+		return orcLong
+	case typeDecimal:
+		return orcDouble
+	}
+	return orcString
+}
+
+// orcInts encodes vs in ORC's integer run length encoding, version 1:
+// a run of three or more that step by the same small delta as a run,
+// and the rest as literals, each zigzag encoded if signed.
+func orcInts(vs []int64, signed bool) []byte {
+	var b []byte
+	value := func(v int64) {
+		if signed {
+			b = binary.AppendVarint(b, v)
+		} else {
+			b = binary.AppendUvarint(b, uint64(v))
+		}
+	}
+	for i := 0; i < len(vs); {
+		// how long a run starts at i.
+		n := 1
+		if i+1 < len(vs) {
+			delta := vs[i+1] - vs[i]
+			if delta >= -128 && delta <= 127 {
+				n = 2
+				for i+n < len(vs) && n < 130 && vs[i+n]-vs[i+n-1] == delta {
+					n++
+				}
+			}
+		}
+		if n >= 3 {
+			b = append(b, byte(n-3), byte(int8(vs[i+1]-vs[i])))
+			value(vs[i])
+			i += n
+			continue
+		}
+		// literals, up to the next run.
+		j := i + 1
+		for j < len(vs) && j-i < 128 && !(j+2 < len(vs) && vs[j+1]-vs[j] == vs[j+2]-vs[j+1] && vs[j+1]-vs[j] >= -128 && vs[j+1]-vs[j] <= 127) {
+			j++
+		}
+		b = append(b, byte(-(j - i)))
+		for _, v := range vs[i:j] {
+			value(v)
+		}
+		i = j
+	}
+	return b
+}
+
+// orcBits encodes bits, most significant first in each byte, in ORC's
+// byte run length encoding.
+func orcBits(bits []bool) []byte {
+	p := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			p[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	var b []byte
+	for i := 0; i < len(p); {
+		n := 1
+		for i+n < len(p) && n < 130 && p[i+n] == p[i] {
+			n++
+		}
+		if n >= 3 {
+			b = append(b, byte(n-3), p[i])
+			i += n
+			continue
+		}
+		j := i + 1
+		for j < len(p) && j-i < 128 && !(j+2 < len(p) && p[j] == p[j+1] && p[j] == p[j+2]) {
+			j++
+		}
+		b = append(b, byte(-(j - i)))
+		b = append(b, p[i:j]...)
+		i = j
+	}
+	return b
+}
+
+// orcCompress compresses p in chunks of at most orcBlockSize, each
+// deflated, or kept as it was if that is no bigger, after a three byte
+// header of its length, times two, plus one if kept as it was.
+func orcCompress(p []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for len(p) > 0 {
+		chunk := p[:intMin(len(p), orcBlockSize)]
+		p = p[len(chunk):]
+		var z bytes.Buffer
+		zw, _ := flate.NewWriter(&z, flate.DefaultCompression) // the level is valid.
+		if _, err := zw.Write(chunk); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		header := uint32(z.Len()) << 1
+		if z.Len() >= len(chunk) {
+			header = uint32(len(chunk))<<1 | 1
+			z.Reset()
+			z.Write(chunk)
+		}
+		out.Write([]byte{byte(header), byte(header >> 8), byte(header >> 16)})
+		out.Write(z.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+// pbWriter encodes a protocol buffers message, as ORC's metadata is.
+type pbWriter struct {
+	b []byte
+}
+
+func (w *pbWriter) key(id, wire int) {
+	w.b = binary.AppendUvarint(w.b, uint64(id<<3|wire))
+}
+
+func (w *pbWriter) uint(id int, v uint64) {
+	w.key(id, 0)
+	w.b = binary.AppendUvarint(w.b, v)
+}
+
+// bytes writes p, a string or an encoded message.
+func (w *pbWriter) bytes(id int, p []byte) {
+	w.key(id, 2)
+	w.b = binary.AppendUvarint(w.b, uint64(len(p)))
+	w.b = append(w.b, p...)
+}
+
+// packed writes a repeated unsigned field, packed.
+func (w *pbWriter) packed(id int, vs ...uint64) {
+	var p []byte
+	for _, v := range vs {
+		p = binary.AppendUvarint(p, v)
+	}
+	w.bytes(id, p)
+}
@@ -0,0 +1,299 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pbMessage is a decoded protocol buffers message: the values of each
+// field by number, a varint or a fixed64 as a uint64, and anything
+// length delimited, a string, packed values, or a message, as []byte.
+type pbMessage map[int][]any
+
+func readPB(t *testing.T, b []byte) pbMessage {
+	t.Helper()
+	m := pbMessage{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad key")
+		}
+		b = b[n:]
+		id := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatalf("bad varint in field %v", id)
+			}
+			b = b[n:]
+			m[id] = append(m[id], v)
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 in field %v", id)
+			}
+			m[id] = append(m[id], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || int(size) > len(b)-n {
+				t.Fatalf("bad length in field %v", id)
+			}
+			m[id] = append(m[id], b[n:n+int(size)])
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("field %v of wire type %v", id, key&7)
+		}
+	}
+	return m
+}
+
+// uint returns the varint field id, or 0.
+func (m pbMessage) uint(id int) uint64 {
+	if len(m[id]) == 0 {
+		return 0
+	}
+	return m[id][0].(uint64)
+}
+
+func (m pbMessage) string(id int) string {
+	if len(m[id]) == 0 {
+		return ""
+	}
+	return string(m[id][0].([]byte))
+}
+
+// orcDecompress undoes orcCompress.
+func orcDecompress(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var out []byte
+	for len(b) > 0 {
+		header := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+		chunk := b[3 : 3+header>>1]
+		b = b[3+header>>1:]
+		if header&1 == 1 {
+			out = append(out, chunk...)
+			continue
+		}
+		p, err := io.ReadAll(flate.NewReader(bytes.NewReader(chunk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
+// orcUnints decodes ORC's integer run length encoding, version 1.
+func orcUnints(b []byte, signed bool) []int64 {
+	var vs []int64
+	value := func() int64 {
+		if signed {
+			v, n := binary.Varint(b)
+			b = b[n:]
+			return v
+		}
+		v, n := binary.Uvarint(b)
+		b = b[n:]
+		return int64(v)
+	}
+	for len(b) > 0 {
+		c := int8(b[0])
+		b = b[1:]
+		if c >= 0 {
+			delta := int64(int8(b[0]))
+			b = b[1:]
+			v := value()
+			for i := 0; i < int(c)+3; i++ {
+				vs = append(vs, v+int64(i)*delta)
+			}
+			continue
+		}
+		for i := 0; i < -int(c); i++ {
+			vs = append(vs, value())
+		}
+	}
+	return vs
+}
+
+// orcUnbits decodes the first n bits of ORC's byte run length encoding.
+func orcUnbits(b []byte, n int) []bool {
+	var p []byte
+	for len(b) > 0 {
+		c := int8(b[0])
+		if c >= 0 {
+			p = append(p, bytes.Repeat(b[1:2], int(c)+3)...)
+			b = b[2:]
+			continue
+		}
+		p = append(p, b[1:1-int(c)]...)
+		b = b[1-int(c):]
+	}
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = p[i/8]&(0x80>>(i%8)) != 0
+	}
+	return bits
+}
+
+// readORC returns the footer of the ORC file b, the names and kinds of
+// its columns, and their values, with nil for a null.
+func readORC(t *testing.T, b []byte) (pbMessage, []string, []uint64, [][]any) {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("ORC")) {
+		t.Fatalf("no ORC at the start")
+	}
+	psLen := int(b[len(b)-1])
+	ps := readPB(t, b[len(b)-1-psLen:len(b)-1])
+	if ps.string(8000) != "ORC" || ps.uint(2) != orcZlib {
+		t.Fatalf("postscript of magic %q and compression %v", ps.string(8000), ps.uint(2))
+	}
+	end := len(b) - 1 - psLen
+	footer := readPB(t, orcDecompress(t, b[end-int(ps.uint(1)):end]))
+
+	var names []string
+	var kinds []uint64
+	for i, typ := range footer[4] {
+		typ := readPB(t, typ.([]byte))
+		if i == 0 {
+			if typ.uint(1) != orcStruct {
+				t.Fatalf("root of kind %v, want a struct", typ.uint(1))
+			}
+			for _, name := range typ[3] {
+				names = append(names, string(name.([]byte)))
+			}
+			continue
+		}
+		kinds = append(kinds, typ.uint(1))
+	}
+
+	columns := make([][]any, len(kinds))
+	for _, info := range footer[3] {
+		info := readPB(t, info.([]byte))
+		at := int(info.uint(1) + info.uint(2))
+		rows := int(info.uint(5))
+		sf := readPB(t, orcDecompress(t, b[at+int(info.uint(3)):at+int(info.uint(3))+int(info.uint(4))]))
+
+		// each column's streams, by kind.
+		streams := make([]map[uint64][]byte, len(kinds)+1)
+		for _, s := range sf[1] {
+			s := readPB(t, s.([]byte))
+			n := int(s.uint(3))
+			col := s.uint(2)
+			if streams[col] == nil {
+				streams[col] = map[uint64][]byte{}
+			}
+			streams[col][s.uint(1)] = orcDecompress(t, b[at:at+n])
+			at += n
+		}
+		for i, kind := range kinds {
+			st := streams[i+1]
+			valid := make([]bool, rows)
+			if p, ok := st[orcPresent]; ok {
+				valid = orcUnbits(p, rows)
+			} else {
+				for r := range valid {
+					valid[r] = true
+				}
+			}
+			var ints, lengths []int64
+			data := st[orcData]
+			switch kind {
+			case orcLong:
+				ints = orcUnints(data, true)
+			case orcString:
+				lengths = orcUnints(st[orcLength], false)
+			}
+			for r := 0; r < rows; r++ {
+				var v any
+				switch {
+				case !valid[r]:
+				case kind == orcLong:
+					v, ints = ints[0], ints[1:]
+				case kind == orcDouble:
+					v = math.Float64frombits(binary.LittleEndian.Uint64(data))
+					data = data[8:]
+				default:
+					v = string(data[:lengths[0]])
+					data, lengths = data[lengths[0]:], lengths[1:]
+				}
+				columns[i] = append(columns[i], v)
+			}
+		}
+	}
+	return footer, names, kinds, columns
+}
+
+func TestORC(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(shopXML), &out, Options{Format: "orc"}); err != nil {
+		t.Fatal(err)
+	}
+	footer, names, kinds, columns := readORC(t, out.Bytes())
+	if footer.uint(6) != 3 {
+		t.Errorf("%v rows, want 3", footer.uint(6))
+	}
+	if len(footer[3]) != 1 {
+		t.Errorf("%v stripes, want 1", len(footer[3]))
+	}
+	wantKinds := []uint64{orcString, orcDouble, orcLong, orcString}
+	if !reflect.DeepEqual(kinds, wantKinds) {
+		t.Errorf("kinds %v, want %v", kinds, wantKinds)
+	}
+	// the statistics of each column, after the root's: its count of
+	// values, and whether it has nulls.
+	stats := footer[7][1:]
+	for i, c := range shopColumns {
+		if names[i] != c.name {
+			t.Errorf("column %v is %v, want %v", i, names[i], c.name)
+		}
+		if !reflect.DeepEqual(columns[i], c.values) {
+			t.Errorf("%v holds %v, want %v", c.name, columns[i], c.values)
+		}
+		s := readPB(t, stats[i].([]byte))
+		values := 0
+		for _, v := range c.values {
+			if v != nil {
+				values++
+			}
+		}
+		if s.uint(1) != uint64(values) || (s.uint(10) == 1) != (values < len(c.values)) {
+			t.Errorf("%v has statistics of %v values and nulls %v", c.name, s.uint(1), s.uint(10))
+		}
+	}
+}
+
+// The run length encodings decode to what was encoded, across runs,
+// literals, and the limits of each.
+func TestORCRunLengths(t *testing.T) {
+	var long, steps, mixed []int64
+	var bits []bool
+	for i := 0; i < 300; i++ {
+		long = append(long, 7)
+		steps = append(steps, int64(i*3))
+		mixed = append(mixed, int64(i*i%17)-8, int64(i)<<40)
+		bits = append(bits, i%3 == 0 || i > 200)
+	}
+	for _, vs := range [][]int64{{1}, {1, 2}, {5, 5, 5}, {1, 300, 600, 900}, long, steps, mixed} {
+		for _, signed := range []bool{true, false} {
+			if !signed && vs[0] < 0 {
+				continue
+			}
+			if got := orcUnints(orcInts(vs, signed), signed); !reflect.DeepEqual(got, vs) {
+				t.Errorf("%v (signed %v) decodes to %v", vs, signed, got)
+			}
+		}
+	}
+	if got := orcUnbits(orcBits(bits), len(bits)); !reflect.DeepEqual(got, bits) {
+		t.Errorf("bits decode to %v, want %v", got, bits)
+	}
+}
@@ -0,0 +1,362 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// -format parquet writes the rows as a Parquet file, for Spark,
+// DuckDB, Athena and the like to read directly. Each column is
+// optional, so a record that lacks it gets a null, and typed as
+// -types-row would infer: integer columns are INT64, decimal ones
+// DOUBLE, and the rest, dates included, UTF-8 strings. The pages are
+// compressed with GZIP, the one Parquet codec in the standard library.
+// The rows are written in row groups of parquetGroupRows, so that
+// with -stream, only one group is ever held in memory.
+
+const parquetGroupRows = 1 << 17
+
+// The Parquet enums we use, from parquet.thrift.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip = 2
+
+	parquetOptional = 1
+	parquetUTF8     = 0 // ConvertedType
+)
+
+// parquetSink writes the rows as a Parquet file, for -format parquet.
+type parquetSink struct {
+	bw *bufio.Writer
+	c  io.Closer
+
+	cols   []*typedColumn
+	rows   int // in the row group being filled
+	total  int // rows written in all
+	offset int64
+	groups [][]byte // the RowGroup of each written group, thrift encoded
+}
+
+func newParquetSink(wc io.WriteCloser) *parquetSink {
+	s := &parquetSink{bw: bufio.NewWriter(wc), c: wc}
+	s.write([]byte("PAR1"))
+	return s
+}
+
+func (s *parquetSink) write(b []byte) {
+	n, _ := s.bw.Write(b) // an error sticks, for close to report.
+	s.offset += int64(n)
+}
+
+func (s *parquetSink) header(names, types []string) error {
+	s.cols = newTypedColumns(names, types)
+	return nil
+}
+
+func (s *parquetSink) row(cells []cell) error {
+	for i, c := range cells {
+		if err := s.cols[i].add(c, s.total+s.rows+1); err != nil {
+			return err
+		}
+	}
+	s.rows++
+	if s.rows >= parquetGroupRows {
+		return s.writeGroup()
+	}
+	return nil
+}
+
+// flush leaves the rows of a row group that is not yet full, for
+// close, rather than writing a group for each row that -stream flushes.
+func (s *parquetSink) flush() error { return nil }
+
+// close writes the last row group and the file's footer, and closes
+// the output, whether or not they could be written.
+func (s *parquetSink) close() error {
+	var err error
+	if s.rows > 0 {
+		err = s.writeGroup()
+	}
+	if err == nil {
+		meta := s.fileMetaData()
+		s.write(meta)
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(meta)))
+		s.write(n[:])
+		s.write([]byte("PAR1"))
+		err = s.bw.Flush()
+	}
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeGroup writes the rows held as a row group, a column chunk of
+// one data page for each column.
+func (s *parquetSink) writeGroup() error {
+	var chunks [][]byte
+	var size int64
+	for _, col := range s.cols {
+		page := parquetPage(col)
+		compressed, err := gzipBytes(page)
+		if err != nil {
+			return err
+		}
+		var ph thriftWriter
+		ph.i32(1, 0) // DATA_PAGE
+		ph.i32(2, int32(len(page)))
+		ph.i32(3, int32(len(compressed)))
+		ph.structBegin(5) // DataPageHeader
+		ph.i32(1, int32(len(col.valid)))
+		ph.i32(2, parquetPlain)
+		ph.i32(3, parquetRLE)
+		ph.i32(4, parquetRLE)
+		ph.structEnd()
+		ph.stop()
+
+		at := s.offset
+		s.write(ph.b)
+		s.write(compressed)
+		size += int64(len(ph.b) + len(page))
+
+		var cc thriftWriter
+		cc.i64(2, at)
+		cc.structBegin(3) // ColumnMetaData
+		cc.i32(1, parquetType(col.typ))
+		cc.listBegin(2, thriftI32, 2)
+		cc.varint(zigzag(parquetPlain))
+		cc.varint(zigzag(parquetRLE))
+		cc.listEnd()
+		cc.listBegin(3, thriftBinary, 1)
+		cc.bytes([]byte(col.name))
+		cc.listEnd()
+		cc.i32(4, parquetGzip)
+		cc.i64(5, int64(len(col.valid)))
+		cc.i64(6, int64(len(ph.b)+len(page)))
+		cc.i64(7, int64(len(ph.b)+len(compressed)))
+		cc.i64(9, at)
+		cc.structEnd()
+		cc.stop()
+		chunks = append(chunks, cc.b)
+		col.reset()
+	}
+	var rg thriftWriter
+	rg.listBegin(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		rg.b = append(rg.b, c...)
+	}
+	rg.listEnd()
+	rg.i64(2, size)
+	rg.i64(3, int64(s.rows))
+	rg.stop()
+	s.groups = append(s.groups, rg.b)
+	s.total += s.rows
+	s.rows = 0
+	return s.bw.Flush()
+}
+
+// fileMetaData returns the footer: the schema, and the row groups.
+func (s *parquetSink) fileMetaData() []byte {
+	var m thriftWriter
+	m.i32(1, 1)
+	m.listBegin(2, thriftStruct, len(s.cols)+1)
+	m.binary(4, []byte("schema"))
+	m.i32(5, int32(len(s.cols)))
+	m.stop()
+	for _, col := range s.cols {
+		m.i32(1, parquetType(col.typ))
+		m.i32(3, parquetOptional)
+		m.binary(4, []byte(col.name))
+		if parquetType(col.typ) == parquetByteArray {
+			m.i32(6, parquetUTF8)
+		}
+		m.stop()
+	}
+	m.listEnd()
+	m.i64(3, int64(s.total))
+	m.listBegin(4, thriftStruct, len(s.groups))
+	for _, g := range s.groups {
+		m.b = append(m.b, g...)
+	}
+	m.listEnd()
+	m.binary(6, []byte("xml2csv"))
+	m.stop()
+	return m.b
+}
+
+func parquetType(typ string) int32 {
+	switch typ {
+	case typeInteger:
+		return parquetInt64
+	case typeDecimal:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// parquetPage returns the data of a page holding all of col: its
+// definition levels, then its values, PLAIN encoded.
+func parquetPage(col *typedColumn) []byte {
+	levels := rleBits(col.valid)
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(len(levels)))
+	b.Write(levels)
+	var n [8]byte
+	switch col.typ {
+	case typeInteger:
+		for _, v := range col.ints {
+			binary.LittleEndian.PutUint64(n[:], uint64(v))
+			b.Write(n[:])
+		}
+	case typeDecimal:
+		for _, v := range col.floats {
+			binary.LittleEndian.PutUint64(n[:], math.Float64bits(v))
+			b.Write(n[:])
+		}
+	default:
+		for _, v := range col.strs {
+			binary.LittleEndian.PutUint32(n[:4], uint32(len(v)))
+			b.Write(n[:4])
+			b.WriteString(v)
+		}
+	}
+	return b.Bytes()
+}
+
+// rleBits encodes the bits in Parquet's RLE/bit-packed hybrid, at bit
+// width 1, as runs only.
+func rleBits(bits []bool) []byte {
+	var b []byte
+	for i := 0; i < len(bits); {
+		j := i + 1
+		for j < len(bits) && bits[j] == bits[i] {
+			j++
+		}
+		b = binary.AppendUvarint(b, uint64(j-i)<<1)
+		if bits[i] {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+		i = j
+	}
+	return b
+}
+
+func gzipBytes(p []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// The thrift compact protocol types that Parquet's metadata uses.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes a thrift struct in the compact protocol, as
+// Parquet's metadata is. Each field's id is written as the difference
+// from the last one in its struct, so structBegin and structEnd keep
+// track of the nesting.
+type thriftWriter struct {
+	b     []byte
+	last  int16
+	outer []int16
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if d := id - w.last; d > 0 && d <= 15 {
+		w.b = append(w.b, byte(d)<<4|typ)
+	} else {
+		w.b = append(w.b, typ)
+		w.varint(zigzag(int64(id)))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) varint(v uint64) { w.b = binary.AppendUvarint(w.b, v) }
+
+func zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) }
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) bytes(p []byte) {
+	w.varint(uint64(len(p)))
+	w.b = append(w.b, p...)
+}
+
+func (w *thriftWriter) binary(id int16, p []byte) {
+	w.field(id, thriftBinary)
+	w.bytes(p)
+}
+
+// listBegin starts a list field of n elements of type typ, which
+// follow: the values, or the structs, each ended by stop. listEnd
+// then goes back to the fields of the struct holding the list.
+func (w *thriftWriter) listBegin(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.b = append(w.b, byte(n)<<4|typ)
+	} else {
+		w.b = append(w.b, 0xf0|typ)
+		w.varint(uint64(n))
+	}
+	w.outer = append(w.outer, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) listEnd() {
+	w.last = w.outer[len(w.outer)-1]
+	w.outer = w.outer[:len(w.outer)-1]
+}
+
+func (w *thriftWriter) structBegin(id int16) {
+	w.field(id, thriftStruct)
+	w.outer = append(w.outer, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) structEnd() {
+	w.stop()
+	w.last = w.outer[len(w.outer)-1]
+	w.outer = w.outer[:len(w.outer)-1]
+}
+
+// stop ends a struct, and starts the field ids over for the next.
+func (w *thriftWriter) stop() {
+	w.b = append(w.b, 0)
+	w.last = 0
+}
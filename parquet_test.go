@@ -0,0 +1,236 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// shopXML has a string, an integer, a decimal, and a date column,
+// with a value missing from each but the first, for the tests of the
+// typed formats.
+const shopXML = `<shop>
+  <item><sku>a-1</sku><qty>3</qty><price>1.25</price><added>2023-01-02</added></item>
+  <item><sku>b-2</sku><price>10</price></item>
+  <item><sku>c&amp;3</sku><qty>-7</qty><added>2023-12-31</added></item>
+</shop>`
+
+// shopColumns are the columns of shopXML, as the typed formats should
+// hold them, with nil for a missing value.
+var shopColumns = []struct {
+	name   string
+	values []any
+}{
+	{"added", []any{"2023-01-02", nil, "2023-12-31"}},
+	{"price", []any{1.25, 10.0, nil}},
+	{"qty", []any{int64(3), nil, int64(-7)}},
+	{"sku", []any{"a-1", "b-2", "c&3"}},
+}
+
+// thriftReader decodes a struct of the thrift compact protocol into
+// a map of its fields by id: a struct is a map[int16]any, a list an
+// []any, an integer an int64, and a binary a string.
+type thriftReader struct {
+	b []byte
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		panic("bad varint")
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) int() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		v := r.b[0]
+		r.b = r.b[1:]
+		return int64(int8(v))
+	case 4, thriftI32, thriftI64:
+		return r.int()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.b))
+		r.b = r.b[8:]
+		return v
+	case thriftBinary:
+		n := int(r.uvarint())
+		v := string(r.b[:n])
+		r.b = r.b[n:]
+		return v
+	case thriftList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		l := make([]any, n)
+		for i := range l {
+			l[i] = r.value(h & 0xf)
+		}
+		return l
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("thrift type %v", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	m := map[int16]any{}
+	var id int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return m
+		}
+		if d := int16(h >> 4); d != 0 {
+			id += d
+		} else {
+			id = int16(r.int())
+		}
+		m[id] = r.value(h & 0xf)
+	}
+}
+
+// readParquet returns the footer of the Parquet file b, and the values
+// of each of its columns, by name, with nil for a null.
+func readParquet(t *testing.T, b []byte) (map[int16]any, map[string][]any) {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("PAR1")) || !bytes.HasSuffix(b, []byte("PAR1")) {
+		t.Fatalf("no PAR1 at the start and the end")
+	}
+	n := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	footer := &thriftReader{b: b[len(b)-8-n : len(b)-8]}
+	meta := footer.structure()
+
+	schema := meta[2].([]any)
+	types := map[string]int64{}
+	for _, el := range schema[1:] {
+		el := el.(map[int16]any)
+		types[el[4].(string)] = el[1].(int64)
+	}
+	columns := map[string][]any{}
+	for _, rg := range meta[4].([]any) {
+		for _, cc := range rg.(map[int16]any)[1].([]any) {
+			cm := cc.(map[int16]any)[3].(map[int16]any)
+			name := cm[3].([]any)[0].(string)
+			pages := &thriftReader{b: b[cm[9].(int64):]}
+			ph := pages.structure()
+			zr, err := gzip.NewReader(bytes.NewReader(pages.b[:ph[3].(int64)]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns[name] = append(columns[name], parquetValues(page, types[name], int(ph[5].(map[int16]any)[1].(int64)))...)
+		}
+	}
+	return meta, columns
+}
+
+// parquetValues decodes a page of n values of type typ, after their
+// definition levels, each a run.
+func parquetValues(page []byte, typ int64, n int) []any {
+	levels := &thriftReader{b: page[4 : 4+binary.LittleEndian.Uint32(page)]}
+	page = page[4+binary.LittleEndian.Uint32(page):]
+	var valid []bool
+	for len(levels.b) > 0 {
+		run := int(levels.uvarint() >> 1)
+		v := levels.b[0] == 1
+		levels.b = levels.b[1:]
+		for i := 0; i < run; i++ {
+			valid = append(valid, v)
+		}
+	}
+	values := make([]any, n)
+	for i := range values {
+		if !valid[i] {
+			continue
+		}
+		switch typ {
+		case parquetInt64:
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case parquetDouble:
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		default:
+			k := binary.LittleEndian.Uint32(page)
+			values[i] = string(page[4 : 4+k])
+			page = page[4+k:]
+		}
+	}
+	return values
+}
+
+func TestParquet(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(shopXML), &out, Options{Format: "parquet"}); err != nil {
+		t.Fatal(err)
+	}
+	meta, columns := readParquet(t, out.Bytes())
+	if meta[3] != int64(3) {
+		t.Errorf("num_rows %v, want 3", meta[3])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(shopColumns)+1 {
+		t.Fatalf("%v schema elements, want the root and %v columns", len(schema), len(shopColumns))
+	}
+	wantTypes := []int64{parquetByteArray, parquetDouble, parquetInt64, parquetByteArray}
+	for i, c := range shopColumns {
+		el := schema[i+1].(map[int16]any)
+		if el[4] != c.name || el[1] != wantTypes[i] || el[3] != int64(parquetOptional) {
+			t.Errorf("column %v is %v, of type %v and repetition %v; want %v, %v, optional", i, el[4], el[1], el[3], c.name, wantTypes[i])
+		}
+		if !reflect.DeepEqual(columns[c.name], c.values) {
+			t.Errorf("%v holds %v, want %v", c.name, columns[c.name], c.values)
+		}
+	}
+}
+
+// Each row group holds parquetGroupRows rows, and the rest are in the
+// last.
+func TestParquetGroups(t *testing.T) {
+	var in strings.Builder
+	in.WriteString("<r>")
+	n := parquetGroupRows + 5
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&in, "<p><n>%v</n></p>", i)
+	}
+	in.WriteString("</r>")
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(in.String()), &out, Options{Format: "parquet", Stream: true}); err != nil {
+		t.Fatal(err)
+	}
+	meta, columns := readParquet(t, out.Bytes())
+	groups := meta[4].([]any)
+	if len(groups) != 2 || groups[0].(map[int16]any)[3] != int64(parquetGroupRows) || groups[1].(map[int16]any)[3] != int64(5) {
+		t.Fatalf("row groups %v, want of %v rows and of 5", len(groups), parquetGroupRows)
+	}
+	got := columns["n"]
+	if len(got) != n || got[0] != int64(0) || got[n-1] != int64(n-1) {
+		t.Errorf("%v values of n, from %v to %v; want %v, from 0 to %v", len(got), got[0], got[len(got)-1], n, n-1)
+	}
+}
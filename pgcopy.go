@@ -0,0 +1,115 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// -format pgcopy writes the rows in the text format of Postgres's
+// COPY: tab separated, without a header, with \N for a null, and
+// backslash escapes for a backslash, tab, newline or carriage return
+// in a value. With a -dsn, the rows are loaded straight into the
+// -table of that database instead, by piping them to
+// psql -c 'COPY table (columns) FROM STDIN', so the table must exist.
+
+var pgcopyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// pgcopySink writes the rows as COPY text, for -format pgcopy.
+type pgcopySink struct {
+	bw   *bufio.Writer
+	c    io.Closer
+	opts *Options
+
+	// with a -dsn, psql, started once the header names the columns.
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+}
+
+func (s *pgcopySink) header(names, types []string) error {
+	if s.opts.DSN == "" {
+		return nil
+	}
+	cols := make([]string, len(names))
+	for i, name := range names {
+		cols[i] = sqlIdent(name)
+	}
+	stmt := fmt.Sprintf("COPY %v (%v) FROM STDIN", sqlIdent(s.opts.table()), strings.Join(cols, ", "))
+	cmd := exec.Command("psql", "-q", "-v", "ON_ERROR_STOP=1", "-d", s.opts.DSN, "-c", stmt)
+	cmd.Stderr = &s.stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("-dsn needs the psql tool on the PATH")
+		}
+		return err
+	}
+	// only a psql that started has a COPY for abort to stop.
+	s.cmd, s.bw, s.c = cmd, bufio.NewWriter(in), in
+	return nil
+}
+
+func (s *pgcopySink) row(cells []cell) error {
+	var b strings.Builder
+	for i, c := range cells {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		if !c.quoted {
+			b.WriteString(`\N`)
+			continue
+		}
+		b.WriteString(pgcopyEscaper.Replace(c.value))
+	}
+	b.WriteByte('\n')
+	_, err := s.bw.WriteString(b.String())
+	return err
+}
+
+func (s *pgcopySink) flush() error {
+	if s.bw == nil {
+		return nil
+	}
+	return s.bw.Flush()
+}
+
+// abort ends a COPY without committing any of the rows, by stopping psql.
+func (s *pgcopySink) abort() {
+	if s.cmd == nil {
+		s.close()
+		return
+	}
+	s.cmd.Process.Kill()
+	s.c.Close()
+	s.cmd.Wait()
+}
+
+// close ends the output, or with a -dsn, the COPY, which only then
+// commits the rows, all or none.
+func (s *pgcopySink) close() error {
+	if s.bw == nil {
+		return nil // a -dsn, and no records to load.
+	}
+	err := s.bw.Flush()
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	if s.cmd != nil {
+		if err2 := s.cmd.Wait(); err2 != nil {
+			msg, _, _ := strings.Cut(strings.TrimSpace(s.stderr.String()), "\n")
+			err = fmt.Errorf("could not COPY the rows into '%v': %v", s.opts.table(), msg)
+		}
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const pgcopyXML = `<r xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <p><a>tab	and \ slash</a><b>two
+lines</b></p>
+  <p><a xsi:nil="true"/><b></b></p>
+  <p><b>x</b></p>
+</r>`
+
+func TestPgcopy(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(pgcopyXML), &out, Options{Format: "pgcopy"}); err != nil {
+		t.Fatal(err)
+	}
+	// no header; missing and nil are both \N, and empty is empty.
+	want := "tab\\tand \\\\ slash\ttwo\\nlines\n\\N\t\n\\N\tx\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+// fakeTool puts a command, name, first on the PATH, that runs
+// script, a shell script, and returns the directory it is in.
+func fakeTool(t *testing.T, name, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake " + name + " is a shell script")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestPgcopyDSN(t *testing.T) {
+	dir := fakeTool(t, "psql", `echo "$@" > "$(dirname "$0")/args"; cat > "$(dirname "$0")/stdin"`)
+	convertTo(t, pgcopyXML, "out.csv", Options{Format: "pgcopy", DSN: "postgres://u@h/db", Table: "my table"})
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-q -v ON_ERROR_STOP=1 -d postgres://u@h/db -c COPY "my table" ("a", "b") FROM STDIN` + "\n"
+	if string(args) != want {
+		t.Errorf("psql ran with %q, want %q", args, want)
+	}
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(stdin), "tab\\tand") || strings.Count(string(stdin), "\n") != 3 {
+		t.Errorf("psql was given %q, not the three rows", stdin)
+	}
+}
+
+func TestPgcopyDSNFails(t *testing.T) {
+	fakeTool(t, "psql", `cat > /dev/null; echo 'ERROR:  relation "records" does not exist' >&2; echo more >&2; exit 1`)
+	err := convertToFile(strings.NewReader(pgcopyXML), filepath.Join(t.TempDir(), "out.csv"), &Options{Format: "pgcopy", DSN: "db"})
+	want := `could not COPY the rows into 'records': ERROR:  relation "records" does not exist`
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	err = convertToFile(strings.NewReader(pgcopyXML), filepath.Join(t.TempDir(), "out.csv"), &Options{Format: "pgcopy", DSN: "db"})
+	if err == nil || !strings.Contains(err.Error(), "needs the psql tool") {
+		t.Errorf("got %v without psql, want that it is needed", err)
+	}
+}
@@ -0,0 +1,137 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// xml2csv schema -proto prints a proto3 definition of a message, Record,
+// with a field for each column, numbered in order from 1, and typed as
+// -types-row infers: int64, double, or string. Each field is optional,
+// for the records that lack it. A column's name is made a legal field
+// name as for -format avro, so Contributor.Name becomes
+// Contributor_Name. -format protobuf writes the records as Record
+// messages, each after its length as a varint, as Java's
+// writeDelimitedTo and Go's protodelim do, with the .proto next to
+// them, as out.proto for out.pb.
+
+// protoDefinition returns the .proto of Record, with the columns names,
+// typed as types says.
+func protoDefinition(names, types []string) string {
+	var b strings.Builder
+	b.WriteString("syntax = \"proto3\";\n\n")
+	b.WriteString("// Record is a record of the XML, flattened by xml2csv.\n")
+	b.WriteString("message Record {\n")
+	for i, name := range protoNames(names) {
+		fmt.Fprintf(&b, "  optional %v %v = %d;", protoType(types[i]), name, i+1)
+		if name != names[i] {
+			fmt.Fprintf(&b, " // %v", names[i])
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// protoNames makes each of names a legal, and different, field name.
+func protoNames(names []string) []string {
+	r := make([]string, len(names))
+	used := make(map[string]bool)
+	for i, name := range names {
+		r[i] = avroName(name)
+		for n := 1; used[r[i]]; n++ {
+			r[i] = avroName(name) + "_" + strconv.Itoa(n)
+		}
+		used[r[i]] = true
+	}
+	return r
+}
+
+func protoType(typ string) string {
+	switch typ {
+	case typeInteger:
+		return "int64"
+	case typeDecimal:
+		return "double"
+	}
+	return "string"
+}
+
+// protoSchema returns the .proto of the columns of s, for -format protobuf.
+func protoSchema(s *schemaSink) ([]byte, error) {
+	return []byte(strings.TrimSuffix(protoDefinition(s.names, s.types), "\n")), nil
+}
+
+// protobufSink writes the rows as length delimited Record messages,
+// for -format protobuf.
+type protobufSink struct {
+	bw *bufio.Writer
+	c  io.Closer
+
+	cols []*typedColumn
+	rows int
+	m    pbWriter // the message of a row
+	n    []byte   // ... and its length
+}
+
+func newProtobufSink(wc io.WriteCloser) *protobufSink {
+	return &protobufSink{bw: bufio.NewWriter(wc), c: wc}
+}
+
+func (s *protobufSink) header(names, types []string) error {
+	s.cols = newTypedColumns(names, types)
+	return nil
+}
+
+// row encodes the row through the columns, which check and parse its
+// values, holding just the one row at a time.
+func (s *protobufSink) row(cells []cell) error {
+	s.rows++
+	m := pbWriter{b: s.m.b[:0]}
+	for i, c := range cells {
+		col := s.cols[i]
+		if err := col.add(c, s.rows); err != nil {
+			return err
+		}
+		if col.valid[0] {
+			switch col.typ {
+			case typeInteger:
+				m.uint(i+1, uint64(col.ints[0]))
+			case typeDecimal:
+				m.key(i+1, 1)
+				m.b = binary.LittleEndian.AppendUint64(m.b, math.Float64bits(col.floats[0]))
+			default:
+				m.key(i+1, 2)
+				m.b = binary.AppendUvarint(m.b, uint64(len(col.strs[0])))
+				m.b = append(m.b, col.strs[0]...)
+			}
+		}
+		col.reset()
+	}
+	s.m = m
+	s.n = binary.AppendUvarint(s.n[:0], uint64(len(m.b)))
+	s.bw.Write(s.n)
+	_, err := s.bw.Write(m.b)
+	return err
+}
+
+func (s *protobufSink) flush() error {
+	return s.bw.Flush()
+}
+
+func (s *protobufSink) close() error {
+	err := s.bw.Flush()
+	err2 := s.c.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
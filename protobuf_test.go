@@ -0,0 +1,89 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProtobuf(t *testing.T) {
+	dir := convertTo(t, shopXML, "out.pb", Options{Format: "protobuf"})
+	proto, err := os.ReadFile(filepath.Join(dir, "out.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `syntax = "proto3";
+
+// Record is a record of the XML, flattened by xml2csv.
+message Record {
+  optional string added = 1;
+  optional double price = 2;
+  optional int64 qty = 3;
+  optional string sku = 4;
+}
+`
+	if string(proto) != want {
+		t.Errorf("got the .proto\n%v\nwant\n%v", string(proto), want)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "out.pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []pbMessage
+	for len(b) > 0 {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || int(n) > len(b)-k {
+			t.Fatalf("bad length before message %v", len(records))
+		}
+		records = append(records, readPB(t, b[k:k+int(n)]))
+		b = b[k+int(n):]
+	}
+	if len(records) != 3 {
+		t.Fatalf("%v messages, want 3", len(records))
+	}
+	for i, c := range shopColumns {
+		for r, m := range records {
+			var got any
+			if len(m[i+1]) == 1 {
+				switch v := m[i+1][0].(type) {
+				case []byte:
+					got = string(v)
+				case uint64:
+					if c.name == "price" {
+						got = math.Float64frombits(v)
+					} else {
+						got = int64(v)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, c.values[r]) {
+				t.Errorf("%v of record %v is %v, want %v", c.name, r, got, c.values[r])
+			}
+		}
+	}
+}
+
+// Names are made legal and kept apart, and the .proto notes the
+// columns they were.
+func TestProtoDefinition(t *testing.T) {
+	got := protoDefinition([]string{"a-b", "a_b", "9"}, []string{typeString, typeInteger, typeDecimal})
+	want := `syntax = "proto3";
+
+// Record is a record of the XML, flattened by xml2csv.
+message Record {
+  optional string a_b = 1; // a-b
+  optional int64 a_b_1 = 2; // a_b
+  optional double _ = 3; // 9
+}
+`
+	if got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
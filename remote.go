@@ -0,0 +1,140 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Object store paths like s3://bucket/key.xml and gs://bucket/key.xml
+// are streamed through the aws and gsutil command line tools, so that
+// we pick up whatever credentials the user has already configured
+// for them, and don't have to carry the cloud SDKs around.
+
+// isRemote reports whether path names an object in S3 or GCS.
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// copyCmd returns the command that copies src to dst, either of
+// which may be "-" for stdin/stdout.
+func copyCmd(remote, src, dst string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if strings.HasPrefix(remote, "s3://") {
+		cmd = exec.Command("aws", "s3", "cp", "--only-show-errors", src, dst)
+	} else {
+		cmd = exec.Command("gsutil", "-q", "cp", src, dst)
+	}
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// openInput opens path for reading; "" and "-" mean stdin.
+// Compressed input is decompressed on the fly.
+func openInput(path string, opts *Options) (rc io.ReadCloser, err error) {
+	switch {
+	case path == "" || path == "-":
+		rc = io.NopCloser(os.Stdin)
+	case isRemote(path):
+		rc, err = openRemote(path)
+	default:
+		rc, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decompress(opts.manifest.input(path, rc))
+}
+
+// createOutput creates path for writing; "" and "-" mean stdout.
+// The output is compressed if opts.Compress asks for it.
+func createOutput(path string, opts *Options) (wc io.WriteCloser, err error) {
+	switch {
+	case path == "" || path == "-":
+		wc = nopWriteCloser{os.Stdout}
+	case isRemote(path):
+		wc, err = createRemote(path)
+	default:
+		wc, err = os.Create(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return compressWriter(opts.manifest.file(path, wc), opts.Compress)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// remoteReader streams an object down from the store.
+type remoteReader struct {
+	io.ReadCloser
+	cmd  *exec.Cmd
+	path string
+}
+
+func openRemote(path string) (io.ReadCloser, error) {
+	cmd := copyCmd(path, path, "-")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not read '%v': %w", path, err)
+	}
+	return &remoteReader{ReadCloser: out, cmd: cmd, path: path}, nil
+}
+
+func (r *remoteReader) Close() error {
+	r.ReadCloser.Close()
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("could not read '%v': %w", r.path, err)
+	}
+	return nil
+}
+
+// remoteWriter streams an object up to the store. The object
+// is only complete once Close has returned without error.
+type remoteWriter struct {
+	io.WriteCloser
+	cmd  *exec.Cmd
+	path string
+}
+
+func createRemote(path string) (io.WriteCloser, error) {
+	cmd := copyCmd(path, "-", path)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not write '%v': %w", path, err)
+	}
+	return &remoteWriter{WriteCloser: in, cmd: cmd, path: path}, nil
+}
+
+func (w *remoteWriter) Close() error {
+	w.WriteCloser.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("could not write '%v': %w", w.path, err)
+	}
+	return nil
+}
+
+// joinPath is filepath.Join, except that it leaves the
+// "s3://" or "gs://" of an object store dir intact.
+func joinPath(dir, name string) string {
+	if isRemote(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + filepath.ToSlash(name)
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,129 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"strings"
+)
+
+// schemaSink passes the header and rows on to its rowSink, noting
+// what the values of the columns are like, and once the rowSink has
+// closed, writes the schemas that opts asks for next to the output,
+// named after it: out.schema.json for out.csv, for -bq-schema, say.
+type schemaSink struct {
+	rowSink
+	path string // of the output
+	opts *Options
+
+	names  []string
+	types  []string
+	shapes []columnShape
+	rows   int
+}
+
+// columnShape is what the values of a column are like, beyond its type.
+type columnShape struct {
+	present int  // rows that have the column
+	null    bool // ... xsi:nil in some, which jsonl writes as null
+	filled  int  // ... with a value that is not empty
+	time    bool // a date column has a time of day
+	zone    bool // ... and a time zone
+}
+
+// schemaFile is a schema to write, with the suffix that replaces the
+// output's extension to name it, and the function that makes it.
+type schemaFile struct {
+	suffix string
+	schema func(s *schemaSink) ([]byte, error)
+}
+
+// schemaFiles returns the schemas that opts asks for.
+func schemaFiles(opts *Options) (r []schemaFile) {
+	if opts.BQSchema {
+		r = append(r, schemaFile{".schema.json", bqSchema})
+	}
+	if opts.JSONSchema {
+		r = append(r, schemaFile{".schema.json", jsonSchema})
+	}
+	if opts.DataPackage {
+		r = append(r, schemaFile{".datapackage.json", dataPackage})
+	}
+	if opts.Format == "protobuf" {
+		r = append(r, schemaFile{".proto", protoSchema})
+	}
+	return
+}
+
+// withSchemas wraps sink in a schemaSink, if opts asks for any schemas,
+// and path, not stdout, has them to be named after.
+func withSchemas(sink rowSink, path string, opts *Options) rowSink {
+	if len(schemaFiles(opts)) == 0 || path == "" || path == "-" {
+		return sink
+	}
+	return &schemaSink{rowSink: sink, path: path, opts: opts}
+}
+
+func (s *schemaSink) header(names, types []string) error {
+	s.names, s.types = names, types
+	s.shapes = make([]columnShape, len(names))
+	if !s.opts.TypesRow && !s.opts.typed() {
+		types = nil
+	}
+	return s.rowSink.header(names, types)
+}
+
+func (s *schemaSink) row(cells []cell) error {
+	s.rows++
+	for i, c := range cells {
+		if c != (cell{}) {
+			s.shapes[i].present++
+		}
+		if c.null && !c.quoted {
+			s.shapes[i].null = true
+		}
+		if c.value == "" || !c.quoted {
+			continue
+		}
+		s.shapes[i].filled++
+		if s.types[i] == typeDate && len(c.value) > len("2006-01-02") {
+			s.shapes[i].time = true
+			if clock := len("2006-01-02T15:04:05"); strings.HasSuffix(c.value, "Z") || len(c.value) > clock && strings.ContainsAny(c.value[clock:], "+-") {
+				s.shapes[i].zone = true
+			}
+		}
+	}
+	return s.rowSink.row(cells)
+}
+
+// close closes the rowSink, and then writes the schemas, if there
+// were any records to have them.
+func (s *schemaSink) close() error {
+	if err := s.rowSink.close(); err != nil || s.names == nil {
+		return err
+	}
+	base, _ := splitCsvExt(s.path)
+	for _, f := range schemaFiles(s.opts) {
+		js, err := f.schema(s)
+		if err != nil {
+			return err
+		}
+		if err := writeSchema(base+f.suffix, js, s.opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSchema(path string, js []byte, opts *Options) error {
+	wc, err := createOutput(path, &Options{manifest: opts.manifest})
+	if err != nil {
+		return err
+	}
+	_, err = wc.Write(append(js, '\n'))
+	err2 := wc.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// On the first Ctrl-C (or SIGTERM) we stop reading at the end of the
+// current record, write out the records read so far, and close the
+// output cleanly, so it never ends in a truncated line. A second
+// signal exits at once.
+//
+// The context of ConvertContext stops the conversion sooner, and
+// without writing out what was read: between any two reads of the
+// input, every thousand or so elements, once the columns and their
+// types are worked out, and every thousand or so rows written,
+// returning the context's error.
+
+// errInterrupted is returned by a conversion that was stopped early.
+var errInterrupted = errors.New("interrupted")
+
+// stopping is closed once a signal has asked us to stop.
+var stopping = make(chan struct{})
+
+// interrupted reports whether a signal has asked us to stop.
+func interrupted() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "xml2csv: interrupted; finishing the current record and closing the output. Interrupt again to quit now.\n")
+		}
+		close(stopping)
+		<-sigs
+		os.Exit(exitInterrupted)
+	}()
+}
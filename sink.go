@@ -0,0 +1,421 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rowSink is where writeCsv sends the csv header, naming the
+// columns, and then each row. If types is not nil, it is the
+// type of each column, for a second line of the header.
+type rowSink interface {
+	header(names, types []string) error
+	row(cells []cell) error
+
+	// flush pushes out any buffered rows.
+	flush() error
+
+	// close flushes everything out, and closes the
+	// underlying output if the sink opened it.
+	close() error
+}
+
+// openSink opens path ("" or "-" for stdout) as a rowSink. If opts asks
+// for the output to be split, the rows go to a series of part files
+// named after path instead of to path itself.
+func openSink(path string, opts *Options) (sink rowSink, err error) {
+	defer func() {
+		if err == nil {
+			opts.manifest.sink(sink, path)
+		}
+	}()
+	if (opts.BQSchema || opts.JSONSchema || opts.DataPackage) && (path == "" || path == "-") {
+		return nil, usagef("-bq-schema, -json-schema, and -datapackage need an output file (-o) to name the schema after")
+	}
+	if opts.Format == "duckdb" {
+		return newDuckDBSink(path, opts)
+	}
+	if opts.DSN != "" {
+		return &pgcopySink{opts: opts}, nil
+	}
+	if opts.MaxRows > 0 || opts.MaxBytes > 0 {
+		if path == "" || path == "-" {
+			return nil, usagef("-max-rows and -max-bytes need an output file (-o) to name the parts after")
+		}
+		base, ext := splitCsvExt(path)
+		sink = &partSink{base: base, ext: ext, opts: opts}
+		if opts.Format == "long" {
+			sink = &longSink{rowSink: sink}
+		}
+		return withSchemas(sink, path, opts), nil
+	}
+	wc, err := createOutput(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newSink(wc, path, opts)
+}
+
+// newSink returns the rowSink for opts.Format that writes to wc, the
+// output at path, which names the schemas written beside it, if any,
+// and titles an html page; path is "" for one that has no name.
+func newSink(wc io.WriteCloser, path string, opts *Options) (rowSink, error) {
+	switch opts.Format {
+	case "parquet":
+		return newParquetSink(wc), nil
+	case "arrow":
+		return newArrowSink(wc), nil
+	case "avro":
+		return newAvroSink(wc), nil
+	case "xlsx":
+		return newXlsxSink(wc, opts)
+	case "orc":
+		return newOrcSink(wc), nil
+	case "protobuf":
+		return withSchemas(newProtobufSink(wc), path, opts), nil
+	case "pgcopy":
+		return &pgcopySink{bw: bufio.NewWriter(wc), c: wc, opts: opts}, nil
+	}
+	if opts.Format == "jsonl" || opts.Format == "json" || opts.Format == "markdown" || opts.Format == "html" || opts.Format == "msgpack" {
+		ls := &lineSink{bw: bufio.NewWriter(wc), c: wc, opts: opts}
+		switch opts.Format {
+		case "json":
+			return &jsonSink{lineSink: ls}, nil
+		case "markdown":
+			return &markdownSink{bw: ls.bw, c: wc}, nil
+		case "html":
+			return newHTMLSink(path, wc, opts), nil
+		case "msgpack":
+			return &msgpackSink{bw: ls.bw, c: wc}, nil
+		}
+		return withSchemas(&jsonlSink{lineSink: ls}, path, opts), nil
+	}
+	var sink rowSink = newLineSink(wc, opts)
+	if opts.Format == "long" {
+		sink = &longSink{rowSink: sink}
+	}
+	return withSchemas(sink, path, opts), nil
+}
+
+// utf8BOM is the byte order mark that tells Excel the csv is UTF-8.
+const utf8BOM = "\ufeff"
+
+// newLineSink starts a lineSink writing to wc, with a BOM first
+// if opts asks for one, and for Excel, the line naming the delimiter.
+func newLineSink(wc io.WriteCloser, opts *Options) *lineSink {
+	s := &lineSink{bw: bufio.NewWriter(wc), c: wc, opts: opts}
+	if opts.BOM || opts.excel() {
+		s.bw.WriteString(utf8BOM)
+	}
+	if opts.excel() {
+		s.line("sep=" + string(opts.delimiter()))
+	}
+	return s
+}
+
+// lineSink writes the header and rows to one output.
+type lineSink struct {
+	bw   *bufio.Writer
+	c    io.Closer
+	opts *Options
+}
+
+func (s *lineSink) header(names, types []string) error {
+	if s.opts.NoHeader {
+		return nil
+	}
+	if err := s.line(csvHeader(names, s.opts)); err != nil {
+		return err
+	}
+	if types == nil {
+		return nil
+	}
+	return s.line(csvHeader(types, s.opts))
+}
+
+func (s *lineSink) row(cells []cell) error {
+	return s.line(csvRow(cells, s.opts))
+}
+
+// line writes one line of csv, adding the newline.
+func (s *lineSink) line(line string) error {
+	_, err := s.bw.WriteString(line)
+	if err == nil {
+		_, err = s.bw.Write(s.opts.newline())
+	}
+	return err
+}
+
+func (s *lineSink) flush() error {
+	return s.bw.Flush()
+}
+
+func (s *lineSink) close() error {
+	err := s.bw.Flush()
+	if s.c != nil {
+		err2 := s.c.Close()
+		if err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// columnSink prints just the column names, for -list-columns: one
+// per line, or as a JSON array, and stops the conversion there.
+type columnSink struct {
+	w      io.Writer
+	format string // "text" or "json"
+	listed bool
+}
+
+// errListed stops the conversion once columnSink has the header.
+var errListed = errors.New("columns listed")
+
+func (s *columnSink) header(names, types []string) error {
+	s.listed = true
+	if err := s.list(names); err != nil {
+		return err
+	}
+	return errListed
+}
+
+func (s *columnSink) list(names []string) error {
+	if s.format == "json" {
+		if names == nil {
+			names = []string{}
+		}
+		b, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(s.w, "%s\n", b)
+		return err
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintln(s.w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *columnSink) row(cells []cell) error { return nil }
+
+func (s *columnSink) flush() error { return nil }
+
+// close lists no columns at all, if the input had no records.
+func (s *columnSink) close() error {
+	if s.listed {
+		return nil
+	}
+	s.listed = true
+	return s.list(nil)
+}
+
+// longSink turns each row into a row per value, of the record's
+// number, the column, and the value, for -format long. It copes with
+// XML so varied that a wide table would have thousands of columns.
+type longSink struct {
+	rowSink
+	names   []string // the columns of the wide rows
+	records int
+}
+
+// longHeader and longTypes are the header of -format long.
+var (
+	longHeader = []string{"record_id", "path", "value"}
+	longTypes  = []string{typeInteger, typeString, typeString}
+)
+
+func (s *longSink) header(names, types []string) error {
+	s.names = names
+	if types != nil {
+		types = longTypes
+	}
+	return s.rowSink.header(longHeader, types)
+}
+
+func (s *longSink) row(cells []cell) error {
+	s.records++
+	id := cell{value: strconv.Itoa(s.records), quoted: true}
+	for i, c := range cells {
+		if c.empty() {
+			continue // the record lacks it.
+		}
+		if err := s.rowSink.row([]cell{id, {value: s.names[i], quoted: true}, c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonlSink writes each row as a JSON object on a line of its own,
+// for -format jsonl, keyed by the column names, in order. A record
+// that lacks a column gets no key for it, and an xsi:nil element is
+// null, as in -format json.
+type jsonlSink struct {
+	*lineSink
+	names []string
+}
+
+func (s *jsonlSink) header(names, types []string) error {
+	s.names = names
+	return nil
+}
+
+func (s *jsonlSink) row(cells []cell) error {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, c := range cells {
+		if c == (cell{}) {
+			continue // the record lacks it.
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		writeJSONString(&b, s.names[i])
+		b.WriteByte(':')
+		if !c.quoted {
+			b.WriteString("null")
+			continue
+		}
+		writeJSONString(&b, c.value)
+	}
+	b.WriteByte('}')
+	return s.line(b.String())
+}
+
+// writeJSONString writes s to b as a JSON string. Unlike json.Marshal,
+// it leaves <, > and & as they are, since the JSON is not for HTML.
+func writeJSONString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\u2028', '\u2029':
+			// valid JSON, but not JavaScript.
+			fmt.Fprintf(b, `\u%04x`, r)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// partSink rolls over to a new part file, each starting with the header,
+// whenever the current part would exceed opts.MaxRows rows or
+// opts.MaxBytes bytes (before any compression). For base "out" and
+// ext ".csv", the parts are out-part-0001.csv, out-part-0002.csv, ...
+type partSink struct {
+	base string
+	ext  string
+	opts *Options
+
+	cur    *lineSink
+	part   int
+	hdr    string // the header line, or lines
+	rows   int64
+	nbytes int64
+}
+
+func (s *partSink) header(names, types []string) error {
+	s.hdr = csvHeader(names, s.opts)
+	if types != nil {
+		s.hdr += string(s.opts.newline()) + csvHeader(types, s.opts)
+	}
+	// start the first part now, so that even a
+	// document without records gets a file.
+	return s.roll()
+}
+
+func (s *partSink) row(cells []cell) error {
+	line := csvRow(cells, s.opts)
+	n := int64(len(line) + len(s.opts.newline()))
+	if s.rows > 0 {
+		full := s.opts.MaxRows > 0 && s.rows >= s.opts.MaxRows
+		if s.opts.MaxBytes > 0 && s.nbytes+n > s.opts.MaxBytes {
+			full = true
+		}
+		if full {
+			if err := s.roll(); err != nil {
+				return err
+			}
+		}
+	}
+	s.rows++
+	s.nbytes += n
+	return s.cur.line(line)
+}
+
+// roll closes the current part, and starts the next one,
+// with the header unless opts.NoHeader.
+func (s *partSink) roll() error {
+	if err := s.close(); err != nil {
+		return err
+	}
+	s.part++
+	path := fmt.Sprintf("%v-part-%04d%v", s.base, s.part, s.ext)
+	wc, err := createOutput(path, s.opts)
+	if err != nil {
+		return err
+	}
+	s.cur = newLineSink(wc, s.opts)
+	s.rows = 0
+	s.nbytes = int64(s.cur.bw.Buffered())
+	s.opts.progressf("starting part '%v'", path)
+	if s.opts.NoHeader {
+		return nil
+	}
+	s.nbytes += int64(len(s.hdr) + len(s.opts.newline()))
+	return s.cur.line(s.hdr)
+}
+
+func (s *partSink) flush() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.flush()
+}
+
+func (s *partSink) close() error {
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.close()
+	s.cur = nil
+	return err
+}
+
+// splitCsvExt splits "dir/out.csv.gz" into "dir/out" and ".csv.gz".
+func splitCsvExt(path string) (base, ext string) {
+	lower := strings.ToLower(path)
+	for _, e := range []string{".csv.gz", ".csv.zst", ".jsonl.gz", ".jsonl.zst", ".json.gz", ".json.zst", ".parquet", ".arrows", ".avro", ".xlsx", ".copy", ".copy.gz", ".copy.zst", ".md", ".html", ".orc", ".msgpack", ".msgpack.gz", ".msgpack.zst", ".pb"} {
+		if strings.HasSuffix(lower, e) {
+			return path[:len(path)-len(e)], path[len(path)-len(e):]
+		}
+	}
+	ext = filepath.Ext(path)
+	return path[:len(path)-len(ext)], ext
+}
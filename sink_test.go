@@ -0,0 +1,69 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONString(t *testing.T) {
+	for _, s := range []string{"", "plain", `a "quoted" \ back`, "Go & <XML>", "tab\tnew\nline\r", "\x00\x1f", "é, 中文, 🙂", "  ", "bad \xff utf-8"} {
+		var b strings.Builder
+		writeJSONString(&b, s)
+		var got string
+		if err := json.Unmarshal([]byte(b.String()), &got); err != nil {
+			t.Errorf("%q: %v is not a JSON string: %v", s, b.String(), err)
+			continue
+		}
+		if want := strings.ToValidUTF8(s, "�"); got != want {
+			t.Errorf("%q: %v reads back as %q", s, b.String(), got)
+		}
+	}
+	var b strings.Builder
+	writeJSONString(&b, "Go & <XML>")
+	if b.String() != `"Go & <XML>"` {
+		t.Errorf("got %v, with HTML escapes", b.String())
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	in := `<r xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <p><a>x &amp; &lt;y&gt;</a><b>1</b><c>3</c></p>
+  <p><a xsi:nil="true"/><b>2</b></p>
+</r>`
+	cases := []struct {
+		what string
+		opts Options
+		want string
+	}{
+		{"nil", Options{Format: "jsonl"}, `{"a":"x & <y>","b":"1","c":"3"}
+{"a":null,"b":"2"}
+`},
+		{"nil string", Options{Format: "jsonl", NilString: "NULL"}, `{"a":"x & <y>","b":"1","c":"3"}
+{"a":null,"b":"2"}
+`},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		if _, err := Convert(strings.NewReader(in), &out, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.what, out.String(), c.want)
+		}
+	}
+
+	// the csv still gives -null-string for both.
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(in), &out, Options{NullString: `\N`}); err != nil {
+		t.Fatal(err)
+	}
+	want := "a,b,c\n\"x & <y>\",\"1\",\"3\"\n\\N,\"2\",\\N\n"
+	if out.String() != want {
+		t.Errorf("csv: got\n%v\nwant\n%v", out.String(), want)
+	}
+}
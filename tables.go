@@ -0,0 +1,181 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// idColumn numbers the rows of each table that -relational writes,
+// and parentIDColumn gives the row of the parent table they belong to.
+const (
+	idColumn       = "_id"
+	parentIDColumn = "_parent_id"
+)
+
+// convertTables is convert for -relational: it writes the records to
+// outPath, but any structure that repeats within a record, like its
+// <Contributor> blocks, goes to a table of its own, one row per
+// block, linked to its record by a _parent_id column. For outPath
+// "out.csv", that is out-Contributor.csv; a structure nested deeper,
+// like DescriptiveDetail/Contributor, is out-DescriptiveDetail_Contributor.csv.
+// The child tables are split up in turn, so nothing is lost however
+// deep the repeats go.
+func convertTables(r io.Reader, outPath string, opts *Options) error {
+	if outPath == "" || outPath == "-" {
+		return usagef("-relational needs an output file (-o) to name the tables after")
+	}
+	d, err := parse(context.Background(), r, opts)
+	if err != nil {
+		return err
+	}
+	if d.tree == nil {
+		return nil
+	}
+	base, ext := splitCsvExt(outPath)
+	return writeTables(d, outPath, base, "", ext, opts)
+}
+
+// writeTables writes the records of d to path, numbered, and the
+// structures that repeat in them to the tables named after base and
+// prefix.
+func writeTables(d *doc, path, base, prefix, ext string, opts *Options) error {
+	tables := repeatedPaths(d.tree)
+
+	children := make([]*doc, len(tables))
+	for i := range tables {
+		children[i] = &doc{tree: &Tag{btwn: d.tree.btwn, name: d.tree.name}, simpleMap: d.simpleMap}
+	}
+	id := 0
+	for rec := d.tree.firstChild; rec != nil; rec = rec.nextSib {
+		id++
+		for i, steps := range tables {
+			for _, parent := range findAll(rec, steps[:len(steps)-1]) {
+				for _, c := range removeChildren(parent, steps[len(steps)-1]) {
+					c.addField(parentIDColumn, strconv.Itoa(id))
+					children[i].tree.addChild(c)
+				}
+				if parent != rec && parent.numChild == 0 {
+					// not a column, now that it holds nothing.
+					parent.skipped = true
+				}
+			}
+		}
+		rec.addField(idColumn, strconv.Itoa(id))
+	}
+
+	sink, err := openSink(path, opts)
+	if err != nil {
+		return err
+	}
+	err = writeCsv(context.Background(), sink, d, opts)
+	err2 := sink.close()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	opts.progressf("wrote table '%v'", path)
+
+	for i, steps := range tables {
+		name := prefix + strings.Join(stripAll(steps), "_")
+		child := fmt.Sprintf("%v-%v%v", base, name, ext)
+		if err := writeTables(children[i], child, base, name+"_", ext, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repeatedPaths returns the paths, from the record, of the elements
+// with children of their own that repeat in any of the records of
+// tree, in the order first seen. The paths inside those are left to
+// their own tables.
+func repeatedPaths(tree *Tag) (r [][]string) {
+	seen := make(map[string]bool)
+	var walk func(t *Tag, path []string)
+	walk = func(t *Tag, path []string) {
+		count := make(map[string]int)
+		for c := t.firstChild; c != nil; c = c.nextSib {
+			count[c.name]++
+		}
+		for c := t.firstChild; c != nil; c = c.nextSib {
+			if c.numChild == 0 {
+				continue
+			}
+			p := append(path[:len(path):len(path)], c.name)
+			if count[c.name] > 1 {
+				if key := strings.Join(p, "/"); !seen[key] {
+					seen[key] = true
+					r = append(r, p)
+				}
+				continue
+			}
+			walk(c, p)
+		}
+	}
+	for rec := tree.firstChild; rec != nil; rec = rec.nextSib {
+		walk(rec, nil)
+	}
+
+	// a path found inside a table, in a record where what holds
+	// the table didn't repeat, is that table's to split up.
+	var outer [][]string
+	for _, p := range r {
+		inside := false
+		for _, q := range r {
+			if len(q) < len(p) && strings.Join(p[:len(q)], "/") == strings.Join(q, "/") {
+				inside = true
+			}
+		}
+		if !inside {
+			outer = append(outer, p)
+		}
+	}
+	return outer
+}
+
+// findAll returns every element under t at the path of steps.
+func findAll(t *Tag, steps []string) []*Tag {
+	if len(steps) == 0 {
+		return []*Tag{t}
+	}
+	var r []*Tag
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		if c.name == steps[0] {
+			r = append(r, findAll(c, steps[1:])...)
+		}
+	}
+	return r
+}
+
+// removeChildren removes the children of t named name, returning them.
+func removeChildren(t *Tag, name string) (removed []*Tag) {
+	c := t.firstChild
+	t.firstChild, t.lastChild, t.numChild = nil, nil, 0
+	for c != nil {
+		next := c.nextSib
+		c.nextSib = nil
+		if c.name == name {
+			removed = append(removed, c)
+		} else {
+			t.addChild(c)
+		}
+		c = next
+	}
+	return
+}
+
+// stripAll strips the namespace prefixes from the names.
+func stripAll(names []string) (r []string) {
+	for _, name := range names {
+		r = append(r, stripNamespace(name))
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRelational(t *testing.T) {
+	in := `<ONIXMessage>
+  <Product>
+    <Title>One</Title>
+    <Contributor><Name>Ann</Name><Address><City>Oslo</City></Address><Address><City>Rome</City></Address></Contributor>
+    <Contributor><Name>Bob</Name></Contributor>
+  </Product>
+  <Product>
+    <Title>Two</Title>
+    <Contributor><Name>Cy</Name><Address><City>Lima</City></Address></Contributor>
+  </Product>
+</ONIXMessage>`
+	dir := convertTo(t, in, "out.csv", Options{Relational: true, Quote: "minimal"})
+	want := map[string]string{
+		"out.csv": `_id,Title
+1,One
+2,Two
+`,
+		"out-Contributor.csv": `_id,_parent_id,Name
+1,1,Ann
+2,1,Bob
+3,2,Cy
+`,
+		// Lima's parent is Cy, the third Contributor.
+		"out-Contributor_Address.csv": `_id,_parent_id,City
+1,1,Oslo
+2,1,Rome
+3,3,Lima
+`,
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Errorf("wrote %v, want %v files", files, len(want))
+	}
+	for name, w := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != w {
+			t.Errorf("%v: got\n%s\nwant\n%v", name, got, w)
+		}
+	}
+}
+
+func TestRelationalNeedsFile(t *testing.T) {
+	err := convertTables(strings.NewReader("<r><p/></r>"), "", &Options{Relational: true})
+	if err == nil || !strings.Contains(err.Error(), "needs an output file") {
+		t.Errorf("got %v, want an error that -relational needs an output file", err)
+	}
+}
@@ -0,0 +1,100 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Parse reads the XML from r into a tree of Tags, as the convert
+// command does before flattening it, for extraction of one's own:
+// the root element, whose children are the records, as Options.Record
+// says, or else all of its children; or nil, for input with no
+// elements. Unlike Convert, it never detects records deeper down.
+// Input holding several documents gives the records of all of them,
+// under the first one's root. As with Convert, compressed XML is
+// decompressed, the zero Options give the command's defaults, and
+// any warnings, as of bad XML under Options.Lenient, go to
+// Options.Warnings.
+func Parse(r io.Reader, opts Options) (*Tag, error) {
+	o := &opts
+	o.rootRecords = true
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	in, err := decompress(io.NopCloser(r))
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	d, err := parse(context.Background(), in, o)
+	if err != nil {
+		return nil, err
+	}
+	return d.tree, nil
+}
+
+// Name returns the element's name, with its prefix, if it has one and
+// Options.KeepNamespace keeps it.
+func (t *Tag) Name() string {
+	return t.name
+}
+
+// Text returns the element's text, as its csv cell would have it:
+// with its entities decoded, and empty if it is only whitespace,
+// unless xml:space="preserve" or Options.PreserveSpace keeps that.
+// An element marked xsi:nil has the Options.NilString, and one with
+// children has none, unless Options.Mixed makes it all text.
+func (t *Tag) Text() string {
+	if t.isNil || t.preserve {
+		return t.content
+	}
+	return trimAllSpace(t.content)
+}
+
+// Attr returns the value of the element's attribute name, decoded,
+// and whether it has one.
+func (t *Tag) Attr(name string) (string, bool) {
+	for _, a := range t.attrs() {
+		if a.name == name {
+			return unescapeEntities(a.value), true
+		}
+	}
+	return "", false
+}
+
+// Children returns the element's child elements, in order. Those of
+// a record include the fields that the Options add to it, like the
+// _checksum of Options.Checksum.
+func (t *Tag) Children() (r []*Tag) {
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		r = append(r, c)
+	}
+	return
+}
+
+// Find returns the elements at path under t, like
+// "Contributor/PersonName", each step naming children of the one
+// before, in document order.
+func (t *Tag) Find(path string) []*Tag {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []*Tag{t}
+	}
+	return findAll(t, strings.Split(path, "/"))
+}
+
+// Walk calls fn for t and then each element under it, depth first, in
+// document order, skipping the children of any for which fn returns
+// false.
+func (t *Tag) Walk(fn func(t *Tag) bool) {
+	if !fn(t) {
+		return
+	}
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		c.Walk(fn)
+	}
+}
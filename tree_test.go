@@ -0,0 +1,135 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const onixXML = `<ONIXMessage>
+  <Header><Sender>Acme</Sender></Header>
+  <Products>
+    <Product id="1">
+      <Title>One</Title>
+      <Contributor><PersonName>Ann</PersonName></Contributor>
+      <Contributor><PersonName>Bob</PersonName></Contributor>
+    </Product>
+    <Product id="2" note="a > b">
+      <Title>Two &amp; more</Title>
+      <Contributor><PersonName>Cy</PersonName></Contributor>
+    </Product>
+    <Product id="3"><Title>Three</Title></Product>
+  </Products>
+</ONIXMessage>`
+
+func names(ts []*Tag) (r []string) {
+	for _, t := range ts {
+		r = append(r, t.Name())
+	}
+	return
+}
+
+func texts(ts []*Tag) (r []string) {
+	for _, t := range ts {
+		r = append(r, t.Text())
+	}
+	return
+}
+
+func TestParse(t *testing.T) {
+	root, err := Parse(strings.NewReader(onixXML), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the records are the root's children, without detection.
+	if root.Name() != "ONIXMessage" {
+		t.Errorf("root %v, want ONIXMessage", root.Name())
+	}
+	if got, want := names(root.Children()), []string{"Header", "Products"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("children %v, want %v", got, want)
+	}
+
+	products := root.Find("/Products/Product/")
+	if len(products) != 3 {
+		t.Fatalf("found %v products, want 3", len(products))
+	}
+	if got, want := texts(root.Find("Products/Product/Contributor/PersonName")), []string{"Ann", "Bob", "Cy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("names %v, want %v", got, want)
+	}
+	if got, want := texts(products[1].Find("Title")), []string{"Two & more"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("title %v, want %v", got, want)
+	}
+	if got := products[2].Find("Contributor"); len(got) != 0 {
+		t.Errorf("found %v contributors in a product with none", len(got))
+	}
+	if got := products[0].Find(""); len(got) != 1 || got[0] != products[0] {
+		t.Errorf("Find of the empty path gives %v, not the tag itself", got)
+	}
+
+	if v, ok := products[1].Attr("note"); !ok || v != "a > b" {
+		t.Errorf("note is %q, %v; want %q", v, ok, "a > b")
+	}
+	if _, ok := products[1].Attr("missing"); ok {
+		t.Errorf("found an attribute that is not there")
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	root, err := Parse(strings.NewReader(onixXML), Options{Record: "ONIXMessage/Products/Product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := texts(root.Find("Product/Title")), []string{"One", "Two & more", "Three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("titles %v, want %v", got, want)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`<a>text</a>`, "text"},
+		{`<a>  spaced out  </a>`, "  spaced out  "},
+		{`<a>  </a>`, ""},
+		{`<a xml:space="preserve">  </a>`, "  "},
+		{`<a>&lt;&#65;&gt;</a>`, "<A>"},
+		{`<a>x<b>1</b>y</a>`, ""},
+		{`<a/>`, ""},
+	}
+	for _, c := range cases {
+		root, err := Parse(strings.NewReader(c.in), Options{})
+		if err != nil {
+			t.Errorf("%v: %v", c.in, err)
+			continue
+		}
+		if root.Text() != c.want {
+			t.Errorf("%v: text %q, want %q", c.in, root.Text(), c.want)
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	root, err := Parse(strings.NewReader("  "), Options{})
+	if err != nil || root != nil {
+		t.Errorf("got %v, %v for no elements; want nil, nil", root, err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root, err := Parse(strings.NewReader(onixXML), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	root.Walk(func(t *Tag) bool {
+		seen = append(seen, t.Name())
+		return t.Name() != "Product"
+	})
+	want := []string{"ONIXMessage", "Header", "Sender", "Products", "Product", "Product", "Product"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("walked %v, want %v", seen, want)
+	}
+}
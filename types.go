@@ -0,0 +1,169 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// The types that -types-row infers for a column, from the values in
+// it: integer if every value is a whole number, decimal if every value
+// is a number, date if every value is an ISO 8601 date or time, and
+// otherwise, or if it holds no values at all, string.
+const (
+	typeString  = "string"
+	typeInteger = "integer"
+	typeDecimal = "decimal"
+	typeDate    = "date"
+)
+
+var (
+	integerRe = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	decimalRe = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+)
+
+// valueType returns the type of the value s. A number with leading
+// zeros, like the 0123 of a zip code or an ISBN, is a string, as is a
+// whole number too big for an int64, or a decimal for a float64, since
+// none of them would come back as written.
+func valueType(s string) string {
+	switch {
+	case integerRe.MatchString(s):
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil || leadingZero(s) {
+			return typeString
+		}
+		return typeInteger
+	case decimalRe.MatchString(s):
+		if _, err := strconv.ParseFloat(s, 64); err != nil || leadingZero(s) {
+			return typeString
+		}
+		return typeDecimal
+	case isDate(s):
+		return typeDate
+	}
+	return typeString
+}
+
+// leadingZero reports whether the number s starts with a 0 that is
+// not all of its whole part, as in 0123 or 00.5, but not 0 or 0.5.
+func leadingZero(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	return len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9'
+}
+
+func isDate(s string) bool {
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05"} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// widen returns the type that holds values of both types a and b,
+// where "" is the type of a column with no values yet.
+func widen(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case a == typeInteger && b == typeDecimal, a == typeDecimal && b == typeInteger:
+		return typeDecimal
+	}
+	return typeString
+}
+
+// columnTypes infers the type of each column of cs from the records of tree.
+func columnTypes(tree *Tag, cs *colset) []string {
+	types := make([]string, len(cs.final))
+	for rec := tree.firstChild; rec != nil; rec = rec.nextSib {
+		for i, c := range csvCells(rec.firstChild, cs) {
+			if c.value != "" && c.quoted {
+				types[i] = widen(types[i], valueType(c.value))
+			}
+		}
+	}
+	for i := range types {
+		if types[i] == "" {
+			types[i] = typeString
+		}
+	}
+	return types
+}
+
+// typedColumn holds the values of one column, as its type says, for
+// the formats that store columns rather than rows.
+type typedColumn struct {
+	name   string
+	typ    string // typeInteger, typeDecimal, or else a string
+	valid  []bool // false for a null
+	ints   []int64
+	floats []float64
+	strs   []string
+}
+
+// add appends the value of c, or a null for a missing, nil, or empty
+// one in a column that is not a string. A value that is not of the
+// column's type, in row (from 1), is an error, which can only happen
+// with -stream, since the types then come from just the sample.
+func (col *typedColumn) add(c cell, row int) error {
+	if !c.quoted || (c.value == "" && col.typ != typeString && col.typ != typeDate) {
+		col.valid = append(col.valid, false)
+		return nil
+	}
+	switch col.typ {
+	case typeInteger:
+		n, err := strconv.ParseInt(c.value, 10, 64)
+		if err != nil {
+			return col.mismatch(c, row)
+		}
+		col.ints = append(col.ints, n)
+	case typeDecimal:
+		f, err := strconv.ParseFloat(c.value, 64)
+		if err != nil {
+			return col.mismatch(c, row)
+		}
+		col.floats = append(col.floats, f)
+	default:
+		col.strs = append(col.strs, c.value)
+	}
+	col.valid = append(col.valid, true)
+	return nil
+}
+
+func (col *typedColumn) mismatch(c cell, row int) error {
+	return &typeMismatch{column: col.name, value: c.value, row: row, typ: col.typ}
+}
+
+// typeMismatch reports a value that is not of its column's type.
+type typeMismatch struct {
+	column, value string
+	row           int
+	typ           string
+}
+
+func (e *typeMismatch) Error() string {
+	return fmt.Sprintf("column '%v' holds '%v' in row %v, which is not the %v that its type was inferred as", e.column, e.value, e.row, e.typ)
+}
+
+func (col *typedColumn) reset() {
+	col.valid, col.ints, col.floats, col.strs = col.valid[:0], col.ints[:0], col.floats[:0], col.strs[:0]
+}
+
+// newTypedColumns makes a typedColumn for each of names, typed as
+// types says, or as strings if types is nil.
+func newTypedColumns(names, types []string) []*typedColumn {
+	cols := make([]*typedColumn, len(names))
+	for i, name := range names {
+		cols[i] = &typedColumn{name: name, typ: typeString}
+		if types != nil {
+			cols[i].typ = types[i]
+		}
+	}
+	return cols
+}
@@ -0,0 +1,69 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// uuidColumn holds the UUID of each record, for -uuid-key.
+const uuidColumn = "_uuid"
+
+// urlNamespace is the RFC 4122 namespace for URLs, which we name
+// record UUIDs in unless told otherwise.
+const urlNamespace = "6ba7b811-9dad-11d1-80b4-00c04fd430c8"
+
+// parseUUID parses a UUID like 6ba7b811-9dad-11d1-80b4-00c04fd430c8.
+func parseUUID(s string) (u [16]byte, err error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return u, fmt.Errorf("'%v' is not a UUID", s)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+// uuidV5 returns the version 5 UUID for name in namespace ns: the
+// same name always gets the same UUID.
+func uuidV5(ns [16]byte, name string) string {
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = u[6]&0x0f | 0x50 // version 5
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// recordUUID returns the UUID for rec, from the content of the element
+// at opts.UUIDKey, a path from the record like
+// ProductIdentifier/IDValue; or "" if rec has no such simple element.
+func recordUUID(rec *Tag, opts *Options) string {
+	key := findPath(rec, strings.Split(opts.UUIDKey, "/"))
+	if key == nil || !key.isSimple {
+		return ""
+	}
+	// the namespace was checked by opts.validate.
+	ns, _ := parseUUID(opts.uuidNamespace())
+	return uuidV5(ns, strings.TrimSpace(key.content))
+}
+
+// findPath returns the first element under t at the path of steps,
+// each matched as stepMatches does, or nil if there is none.
+func findPath(t *Tag, steps []string) *Tag {
+	if len(steps) == 0 {
+		return t
+	}
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		if stepMatches(steps[0], c.name) {
+			if found := findPath(c, steps[1:]); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// problem is one thing wrong with an XML file, as found by validate.
+// The File of stdin is "-".
+type problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"column"`
+	Pos     int    `json:"offset"`
+	Message string `json:"message"`
+}
+
+func (pr problem) String() string {
+	return fmt.Sprintf("%v:%v:%v: %v", pr.File, pr.Line, pr.Col, pr.Message)
+}
+
+// problemFile is the File of the problems in the input at path.
+func problemFile(path string) string {
+	if path == "" {
+		return "-"
+	}
+	return path
+}
+
+func validateSetup(fs *flag.FlagSet) func(args []string) error {
+	inPath, opts := inputFlags(fs)
+	var format string
+	fs.StringVar(&format, "format", "text", "list the problems as text, one per line as file:line:column: message, or as json")
+	fs.StringVar(&opts.XSD, "xsd", "", "also check the XML against this XML Schema; needs xmllint")
+	return func(args []string) error {
+		verbosity(opts)
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		if format != "text" && format != "json" {
+			return usagef("unknown -format '%v'; use text or json", format)
+		}
+		paths := []string{*inPath}
+		if len(args) > 0 {
+			var err error
+			paths, err = expandGlobs(args)
+			if err != nil {
+				return err
+			}
+		}
+
+		var problems []problem
+		bad := 0
+		for _, path := range paths {
+			found, err := validateFile(path, opts)
+			if err != nil {
+				// a file we can't read is a problem for the batch too.
+				found = append(found, problem{File: problemFile(path), Message: err.Error()})
+			}
+			if len(found) > 0 {
+				bad++
+			}
+			problems = append(problems, found...)
+		}
+
+		if format == "json" {
+			if problems == nil {
+				problems = []problem{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(problems); err != nil {
+				return err
+			}
+		} else {
+			for _, pr := range problems {
+				fmt.Println(pr)
+			}
+			if len(problems) == 0 {
+				fmt.Println("ok")
+			}
+		}
+		if len(problems) > 0 {
+			return &invalidError{problems: len(problems), files: bad}
+		}
+		return nil
+	}
+}
+
+// validateFile checks the well-formedness of the XML at path,
+// returning the problems it finds. It only fails if the file
+// cannot be read to the end.
+func validateFile(path string, opts *Options) ([]problem, error) {
+	in, err := openInput(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return validateXML(in, path, opts)
+}
+
+// validateXML lists the problems in the XML read from r. Tags that
+// don't balance are repaired as --lenient would, so that the checking
+// can go on to the end, unless the tokens themselves are broken.
+func validateXML(r io.Reader, file string, opts *Options) (problems []problem, err error) {
+	file = problemFile(file)
+	p := newParser(context.Background(), r, opts)
+	p.onProblem = func(m mark, msg string) {
+		problems = append(problems, problem{File: file, Line: m.line, Col: m.col, Pos: m.pos, Message: msg})
+	}
+	// we don't need the records, so don't keep them.
+	p.onRecord = func(rec *Tag) error { return nil }
+	p.simpleMap = nil
+
+	docs := 0
+	for {
+		err := p.run()
+		if parseErr, ok := err.(*ParseError); ok {
+			p.onProblem(mark{pos: parseErr.Pos, line: parseErr.Line, col: parseErr.Col}, parseErr.Msg)
+			return problems, nil
+		}
+		if err != nil {
+			return problems, err
+		}
+		if p.tree == nil {
+			break
+		}
+		docs++
+		p.reset()
+	}
+	if docs == 0 {
+		p.onProblem(mark{line: 1, col: 1}, "no XML elements found")
+	}
+	return problems, nil
+}
+
+// checkTag notes any problems with the encoding of tag t and the
+// text before it, and with the attributes of an open tag.
+func (p *parser) checkTag(t *Tag) {
+	if !utf8.ValidString(t.pre) {
+		p.problem(t.mark(), "the text before '%v' is not valid UTF-8", t.btwn)
+	}
+	if t.isClose {
+		return
+	}
+	if !utf8.ValidString(t.btwn) {
+		p.problem(t.mark(), "'<%v>' is not valid UTF-8", t.name)
+	}
+	if t.name == "" || strings.ContainsAny(t.name[:1], "0123456789-.") {
+		p.problem(t.mark(), "'%v' does not start with a valid element name", t.btwn)
+	}
+	for _, msg := range checkAttrs(t.btwn) {
+		p.problem(t.mark(), "in '<%v>': %v", t.name, msg)
+	}
+}
+
+// checkAttrs checks that each attribute in the open tag btwn is
+// written name="value" or name='value', and appears only once.
+func checkAttrs(btwn string) (r []string) {
+	s := strings.TrimSuffix(strings.TrimSuffix(btwn, ">"), "/")
+	s = strings.TrimPrefix(s, "<")
+	i := strings.IndexAny(s, " \t\r\n")
+	if i < 0 {
+		return nil
+	}
+	s = s[i:]
+	seen := make(map[string]bool)
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return
+		}
+		end := strings.IndexAny(s, "= \t\r\n")
+		if end < 0 {
+			return append(r, fmt.Sprintf("attribute '%v' has no value", s))
+		}
+		name := s[:end]
+		if name == "" {
+			return append(r, fmt.Sprintf("'%v' is not an attribute", s))
+		}
+		if seen[name] {
+			r = append(r, fmt.Sprintf("attribute '%v' is given twice", name))
+		}
+		seen[name] = true
+		s = strings.TrimLeft(s[end:], " \t\r\n")
+		if !strings.HasPrefix(s, "=") {
+			r = append(r, fmt.Sprintf("attribute '%v' has no value", name))
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+		if s == "" || (s[0] != '"' && s[0] != '\'') {
+			r = append(r, fmt.Sprintf("the value of attribute '%v' is not quoted", name))
+			end := strings.IndexAny(s, " \t\r\n")
+			if end < 0 {
+				return
+			}
+			s = s[end:]
+			continue
+		}
+		close := strings.IndexByte(s[1:], s[0])
+		if close < 0 {
+			return append(r, fmt.Sprintf("the value of attribute '%v' has no closing quote", name))
+		}
+		if strings.Contains(s[1:1+close], "<") {
+			r = append(r, fmt.Sprintf("the value of attribute '%v' contains a '<'", name))
+		}
+		s = s[2+close:]
+	}
+}
@@ -0,0 +1,52 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateXML(t *testing.T) {
+	cases := []struct {
+		what, in string
+		want     []string
+	}{
+		{"ok", `<r><p a="1">x</p></r>`, nil},
+		{"mismatch", "<r>\n<p>x</q>\n</r>", []string{"-:2:5: '</q>' has no open tag, so ignoring it", "-:3:1: '<p>' is not closed before '</r>', so closing it"}},
+		{"unclosed", "<r><p>x</p>", []string{"-:1:1: '<r>' is never closed"}},
+		{"no elements", "just text", []string{"-:1:1: no XML elements found"}},
+		{"bad utf-8", "<r>\xff</r>", []string{"-:1:5: the text before '</r>' is not valid UTF-8"}},
+	}
+	for _, c := range cases {
+		problems, err := validateXML(strings.NewReader(c.in), "", &Options{})
+		if err != nil {
+			t.Errorf("%v: %v", c.what, err)
+			continue
+		}
+		var got []string
+		for _, pr := range problems {
+			got = append(got, pr.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.what, strings.Join(got, "\n"), strings.Join(c.want, "\n"))
+		}
+	}
+}
+
+func TestInvalidError(t *testing.T) {
+	cases := []struct {
+		problems, files int
+		want            string
+	}{
+		{1, 1, "found 1 problem in 1 file"},
+		{2, 1, "found 2 problems in 1 file"},
+		{5, 3, "found 5 problems in 3 files"},
+	}
+	for _, c := range cases {
+		if got := (&invalidError{problems: c.problems, files: c.files}).Error(); got != c.want {
+			t.Errorf("got %q, want %q", got, c.want)
+		}
+	}
+}
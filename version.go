@@ -0,0 +1,74 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// These are set at build time, as in
+//
+// go build -ldflags "-X github.com/glycerine/xml2csv.version=v1.2.0 -X github.com/glycerine/xml2csv.commit=$(git rev-parse HEAD) -X github.com/glycerine/xml2csv.buildDate=$(date -u +%FT%TZ)" ./cmd/xml2csv
+//
+// When they are not, versionInfo fills them in from what the go
+// tool recorded in the binary, if it can.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// versionInfo returns the version, commit, and build date of this binary.
+// Anything unknown is returned as "unknown".
+func versionInfo() (ver, com, date string) {
+	ver, com, date = version, commit, buildDate
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if ver == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			ver = bi.Main.Version
+		}
+		modified := false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if com == "" {
+					com = s.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && com != "" {
+			com += "-dirty"
+		}
+	}
+	if ver == "" {
+		ver = "unknown"
+	}
+	if com == "" {
+		com = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return
+}
+
+func versionSetup(fs *flag.FlagSet) func(args []string) error {
+	return func(args []string) error {
+		printVersion()
+		return nil
+	}
+}
+
+func printVersion() {
+	ver, com, date := versionInfo()
+	fmt.Printf("xml2csv %v\ncommit: %v\nbuilt: %v\ngo: %v %v/%v\n", ver, com, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,97 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settle is how long an .xml file must go without further writes
+// before we convert it, so we don't pick up a half-written feed.
+var settle = 500 * time.Millisecond
+
+// watchDir converts each .xml file that is created or modified in dir,
+// writing the .csv next to it, or into outdir when given. It runs
+// until the watcher fails, or we are interrupted; then it waits for
+// any conversion under way to finish.
+func watchDir(dir, outdir string, opts *Options) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := w.Add(dir); err != nil {
+		return err
+	}
+	if outdir != "" {
+		if err := os.MkdirAll(outdir, 0755); err != nil {
+			return err
+		}
+	}
+	opts.progressf("watching '%v' for .xml files", dir)
+
+	var mut sync.Mutex
+	pending := make(map[string]*time.Timer)
+	var busy sync.WaitGroup
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+			if !isXMLName(ev.Name) {
+				continue
+			}
+			path := ev.Name
+
+			// restart the clock on every write; convert once quiet.
+			mut.Lock()
+			if t, ok := pending[path]; ok && t.Stop() {
+				busy.Done()
+			}
+			busy.Add(1)
+			pending[path] = time.AfterFunc(settle, func() {
+				defer busy.Done()
+				mut.Lock()
+				delete(pending, path)
+				mut.Unlock()
+
+				target := csvPathFor(path, outdir, opts)
+				if err := safeConvertFile(path, target, opts); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", withFile(path, err))
+					return
+				}
+				opts.progressf("converted '%v' -> '%v'", path, target)
+			})
+			mut.Unlock()
+
+		case <-stopping:
+			mut.Lock()
+			for _, t := range pending {
+				if t.Stop() {
+					busy.Done()
+				}
+			}
+			mut.Unlock()
+			busy.Wait()
+			return nil
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		}
+	}
+}
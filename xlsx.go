@@ -0,0 +1,239 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// -format xlsx writes the rows as an Excel workbook of one sheet, with
+// the header row frozen, and in bold, and each column as wide as its
+// values, within reason. The values of integer and decimal columns, as
+// -types-row would infer them, are numbers in the sheet, but for any
+// Excel would change, like 0123, or show in another way, like an ISBN
+// as 9.78E+12; those, like everything else, are text.
+//
+// The columns' widths come before the rows in the sheet, so the rows
+// are spooled to a temporary file until they are all in.
+
+// xlsxMaxRows is the most rows a sheet can have.
+const xlsxMaxRows = 1 << 20
+
+// xlsxSink writes the rows as an Excel workbook, for -format xlsx.
+type xlsxSink struct {
+	w    io.WriteCloser
+	opts *Options
+
+	spool  *os.File
+	bw     *bufio.Writer
+	types  []string
+	widths []int // in characters
+	rows   int
+}
+
+func newXlsxSink(wc io.WriteCloser, opts *Options) (*xlsxSink, error) {
+	spool, err := os.CreateTemp("", "xml2csv-*.xml")
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxSink{w: wc, opts: opts, spool: spool, bw: bufio.NewWriter(spool)}, nil
+}
+
+func (s *xlsxSink) header(names, types []string) error {
+	s.types = types
+	s.widths = make([]int, len(names))
+	if s.opts.NoHeader {
+		return nil
+	}
+	cells := make([]cell, len(names))
+	for i, name := range names {
+		cells[i] = cell{value: name, quoted: true}
+	}
+	return s.writeRow(cells, true)
+}
+
+func (s *xlsxSink) row(cells []cell) error {
+	return s.writeRow(cells, false)
+}
+
+// writeRow spools a row, the header in bold, and widens the columns to fit it.
+func (s *xlsxSink) writeRow(cells []cell, header bool) error {
+	s.rows++
+	if s.rows > xlsxMaxRows {
+		return fmt.Errorf("a sheet holds at most %v rows, so the rest won't fit", xlsxMaxRows)
+	}
+	fmt.Fprintf(s.bw, `<row r="%d">`, s.rows)
+	for i, c := range cells {
+		if !c.quoted || c.value == "" {
+			continue
+		}
+		if n := utf8.RuneCountInString(c.value); n > s.widths[i] {
+			s.widths[i] = n
+		}
+		ref := xlsxColumn(i) + strconv.Itoa(s.rows)
+		switch {
+		case header:
+			fmt.Fprintf(s.bw, `<c r="%v" t="inlineStr" s="1"><is><t xml:space="preserve">`, ref)
+		case s.types != nil && (s.types[i] == typeInteger || s.types[i] == typeDecimal) && xlsxNumber(c.value):
+			fmt.Fprintf(s.bw, `<c r="%v"><v>%v</v></c>`, ref, c.value)
+			continue
+		default:
+			fmt.Fprintf(s.bw, `<c r="%v" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		}
+		xml.EscapeText(s.bw, []byte(c.value))
+		s.bw.WriteString(`</t></is></c>`)
+	}
+	_, err := s.bw.WriteString("</row>")
+	return err
+}
+
+// xlsxNumber reports whether Excel shows s as it is, as a number: no
+// leading zeros, nor more than the 11 digits before the point that it
+// shows without switching to 9.78E+12, nor the 15 in all that it keeps.
+func xlsxNumber(s string) bool {
+	if strings.HasPrefix(s, "+") || strings.HasSuffix(s, ".") {
+		return false
+	}
+	digits := strings.TrimPrefix(s, "-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return false
+	}
+	whole, all, point := 0, 0, false
+	for _, c := range digits {
+		switch {
+		case c == 'e' || c == 'E':
+			return false // Excel shows it written out.
+		case c == '.':
+			point = true
+		case !point:
+			whole++
+			all++
+		default:
+			all++
+		}
+	}
+	return whole <= 11 && all <= 15
+}
+
+// xlsxColumn returns the letters naming column i, from 0: A, ..., Z, AA, ...
+func xlsxColumn(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+func (s *xlsxSink) flush() error { return nil }
+
+// close writes the workbook, around the spooled rows.
+func (s *xlsxSink) close() error {
+	defer os.Remove(s.spool.Name())
+	defer s.spool.Close()
+	err := s.writeWorkbook()
+	err2 := s.w.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (s *xlsxSink) writeWorkbook() error {
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	z := zip.NewWriter(s.w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		w, err := z.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, xml.Header+part.body); err != nil {
+			return err
+		}
+	}
+
+	w, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if !s.opts.NoHeader && s.rows > 0 {
+		bw.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	if len(s.widths) > 0 {
+		bw.WriteString("<cols>")
+		for i, n := range s.widths {
+			width := n + 2
+			if width < 8 {
+				width = 8
+			} else if width > 60 {
+				width = 60
+			}
+			fmt.Fprintf(bw, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+		}
+		bw.WriteString("</cols>")
+	}
+	bw.WriteString("<sheetData>")
+	if _, err := io.Copy(bw, s.spool); err != nil {
+		return err
+	}
+	bw.WriteString("</sheetData></worksheet>")
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// The parts of the workbook around the sheet.
+const (
+	xlsxContentTypes = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+
+	xlsxRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	xlsxWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+
+	xlsxWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+
+	// style 1 is the bold of the header.
+	xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+		`</styleSheet>`
+)
@@ -0,0 +1,156 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// xlsxSheet is as much of a worksheet as the tests look at.
+type xlsxSheet struct {
+	Pane *struct {
+		YSplit int    `xml:"ySplit,attr"`
+		State  string `xml:"state,attr"`
+	} `xml:"sheetViews>sheetView>pane"`
+	Cols []struct {
+		Width int `xml:"width,attr"`
+	} `xml:"cols>col"`
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			T      string `xml:"t,attr"`
+			S      string `xml:"s,attr"`
+			V      string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXlsx returns the sheet of the workbook b, after checking that
+// each of its parts is well formed, and that the content types name
+// the parts that are there.
+func readXlsx(t *testing.T, b []byte) xlsxSheet {
+	t.Helper()
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := xml.NewDecoder(bytes.NewReader(p))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%v: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = p
+	}
+	var types struct {
+		Overrides []struct {
+			PartName string `xml:",attr"`
+		} `xml:"Override"`
+	}
+	if err := xml.Unmarshal(parts["[Content_Types].xml"], &types); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range types.Overrides {
+		if parts[strings.TrimPrefix(o.PartName, "/")] == nil {
+			t.Errorf("the content types name %v, which is not there", o.PartName)
+		}
+	}
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	return sheet
+}
+
+func TestXlsx(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(shopXML), &out, Options{Format: "xlsx"}); err != nil {
+		t.Fatal(err)
+	}
+	sheet := readXlsx(t, out.Bytes())
+	if sheet.Pane == nil || sheet.Pane.YSplit != 1 || sheet.Pane.State != "frozen" {
+		t.Errorf("the header row is not frozen")
+	}
+	if len(sheet.Cols) != 4 || sheet.Cols[0].Width != 12 || sheet.Cols[1].Width != 8 {
+		t.Errorf("column widths %+v, want 4, the first 12 wide, for a date, and the second 8", sheet.Cols)
+	}
+
+	// each cell as ref:value, a number bare, text quoted, and bold text
+	// starred.
+	var got []string
+	for i, row := range sheet.Rows {
+		if row.R != i+1 {
+			t.Errorf("row %v numbered %v", i+1, row.R)
+		}
+		for _, c := range row.Cells {
+			switch {
+			case c.T == "":
+				got = append(got, c.R+":"+c.V)
+			case c.S == "1":
+				got = append(got, c.R+":*"+c.Inline+"*")
+			default:
+				got = append(got, c.R+":'"+c.Inline+"'")
+			}
+		}
+	}
+	want := []string{
+		"A1:*added*", "B1:*price*", "C1:*qty*", "D1:*sku*",
+		"A2:'2023-01-02'", "B2:1.25", "C2:3", "D2:'a-1'",
+		"B3:10", "D3:'b-2'",
+		"A4:'2023-12-31'", "C4:-7", "D4:'c&3'",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got cells\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestXlsxNumber(t *testing.T) {
+	for s, want := range map[string]bool{
+		"12.50":             true,
+		"-7":                true,
+		"0.5":               true,
+		"0":                 true,
+		"0123":              false,
+		"+1":                false,
+		"1.":                false,
+		"1e5":               false,
+		"12345678901":       true,
+		"123456789012":      false,
+		"9780306406157":     false,
+		"1.23456789012345":  true,
+		"1.234567890123456": false,
+	} {
+		if got := xlsxNumber(s); got != want {
+			t.Errorf("xlsxNumber(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestXlsxColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%v) = %v, want %v", i, got, want)
+		}
+	}
+}
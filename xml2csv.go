@@ -1,4 +1,4 @@
-package main
+package xml2csv
 
 // Copyright (C) 2023, Jason E. Aten, Ph.D.
 // License: MIT; see LICENSE file.
@@ -6,16 +6,19 @@ package main
 // xml2csv: parse an XML file on stdin, and write out a csv file version of it to stdout.
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"html"
 	"io"
-	"os"
 	"sort"
+	"strconv"
 	"strings"
-)
+	"unicode/utf8"
 
-// ls -1 *.xml > list
-// for i in `cat list`; do k=${i/xml}; ./xml2csv < $i > ${k}csv; done
+	"golang.org/x/text/unicode/norm"
+)
 
 // escape double quotes
 func esc(s string) (r string) {
@@ -23,30 +26,117 @@ func esc(s string) (r string) {
 }
 
 var newline = []byte("\n")
+var crlf = []byte("\r\n")
+
+// unescapeEntities decodes the character references, like &#8212; and
+// &#x2014;, and the predefined entities &amp; &lt; &gt; &quot; &apos; in s.
+// Any other entity, defined in a DTD we don't read, is left as is.
+//
+// Never expanding the entities of a DTD is also what keeps us safe from
+// entity expansion attacks, like "billion laughs", where entities are
+// defined in terms of each other to expand into gigabytes. Each reference
+// we do decode is at least four bytes, and becomes at most four, so the
+// text never grows, and there is nothing to recurse into.
+func unescapeEntities(s string) string {
+	amp := strings.IndexByte(s, '&')
+	if amp < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(s[:amp])
+	s = s[amp:]
+	for len(s) > 0 {
+		if s[0] != '&' {
+			amp := strings.IndexByte(s, '&')
+			if amp < 0 {
+				amp = len(s)
+			}
+			b.WriteString(s[:amp])
+			s = s[amp:]
+			continue
+		}
+		semi := strings.IndexByte(s, ';')
+		if semi < 0 {
+			b.WriteString(s)
+			break
+		}
+		if r, ok := decodeEntity(s[1:semi]); ok {
+			b.WriteString(r)
+		} else {
+			b.WriteString(s[:semi+1])
+		}
+		s = s[semi+1:]
+	}
+	return b.String()
+}
 
-// tag represents one XML tag, like "<person>" in the line "<person>John Smith</person>".
+var predefinedEntities = map[string]string{
+	"amp":  "&",
+	"lt":   "<",
+	"gt":   ">",
+	"quot": `"`,
+	"apos": "'",
+}
+
+// decodeEntity decodes the name between & and ; of one reference.
+func decodeEntity(name string) (string, bool) {
+	if r, ok := predefinedEntities[name]; ok {
+		return r, true
+	}
+	if !strings.HasPrefix(name, "#") {
+		return "", false
+	}
+	num, base := name[1:], 10
+	if strings.HasPrefix(num, "x") || strings.HasPrefix(num, "X") {
+		num, base = num[1:], 16
+	}
+	n, err := strconv.ParseUint(num, base, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return "", false
+	}
+	return string(rune(n)), true
+}
+
+// Tag represents one XML tag, like "<person>" in the line "<person>John Smith</person>".
 // The "</person>" is also a tag, a closing tag, and we may point to our paired begin or end tag.
-type tag struct {
+// The tree that Parse returns is of the opening tags, one per element.
+type Tag struct {
 	btwn    string // what is between the < > angle brackets
 	name    string // the name of the node, stopping after the first whitespace. <name or </name
 	beg     int    // byte position in the file
 	endx    int
+	line    int // line and column of beg, from 1
+	col     int
 	isClose bool // do we start with </name
 
 	isSimple   bool
 	selfClosed bool
-	endTag     *tag
-	begTag     *tag
+	endTag     *Tag
+	begTag     *Tag
 	content    string
+	pre        string // the text between the previous tag and this one
 
-	firstChild *tag
-	nextSib    *tag
+	firstChild *Tag
+	lastChild  *Tag
+	nextSib    *Tag
 	numChild   int
 
 	discard  bool // mark true if this is a simple tag with no content variation in content
 	compound bool // if numChild > 0
+	skipped  bool // left out of the columns, as opts.SkipTags says, or emptied by -relational
+	repeat   bool // a repeat of a simple sibling, joined to its column
 	colname  string
-	dupcount int // number of times this colname is duplicated among siblings
+	base     string // the colname before any prefix or duplicate count is added
+	dupcount int    // number of times this colname is duplicated among siblings
+
+	xmlns map[string]string // the namespaces this tag declares, by prefix
+	isNil bool              // marked xsi:nil="true"; content is then Options.NilString
+	lang  string            // from xml:lang, here or on an ancestor
+	skip  bool              // leave this one out, as not in the Options.Lang
+
+	broken   bool // a record we had to repair, so leave it out
+	record   bool // this becomes a row
+	preserve bool // keep content that is only whitespace, by xml:space="preserve"
 }
 
 func intMin(a, b int) int {
@@ -56,55 +146,358 @@ func intMin(a, b int) int {
 	return b
 }
 
-func (t *tag) String() string {
+// mark returns where t starts in the input.
+func (t *Tag) mark() mark {
+	return mark{pos: t.beg, line: t.line, col: t.col}
+}
+
+// removeLast removes the last child of t.
+func (t *Tag) removeLast() {
+	if t.firstChild == nil {
+		return
+	}
+	if t.firstChild == t.lastChild {
+		t.firstChild, t.lastChild, t.numChild = nil, nil, 0
+		return
+	}
+	c := t.firstChild
+	for c.nextSib != t.lastChild {
+		c = c.nextSib
+	}
+	c.nextSib = nil
+	t.lastChild = c
+	t.numChild--
+}
+
+// adoptChildren moves all the children of from over to t,
+// after any that t already has.
+func (t *Tag) adoptChildren(from *Tag) {
+	for c := from.firstChild; c != nil; {
+		next := c.nextSib
+		c.nextSib = nil
+		t.addChild(c)
+		c = next
+	}
+	from.firstChild, from.lastChild, from.numChild = nil, nil, 0
+}
+
+// addChild appends c to the children of t.
+func (t *Tag) addChild(c *Tag) {
+	if t.firstChild == nil {
+		t.firstChild = c
+	} else {
+		t.lastChild.nextSib = c
+	}
+	t.lastChild = c
+	t.numChild++
+}
+
+func (t *Tag) String() string {
 	//return fmt.Sprintf("%v%v", t.btwn, t.content)
 	return fmt.Sprintf("%v:%v", strings.ReplaceAll(t.name, ":", "_"), t.content)
 }
 
-// split into tags
-func tokenize(by []byte) (tags []*tag) {
-	n := len(by)
-	var i, j, k, beg, endx int
-	for k = bytes.IndexByte(by[i:], '<'); k >= 0 && i < n; k = bytes.IndexByte(by[i:], '<') {
-		beg = i + k
-		j = bytes.IndexByte(by[i:], '>')
-		if j == -1 {
-			panic(fmt.Sprintf("begin tag without matching end tag!: beg=%v; by[beg:(beg+100)]='%v'", beg, string(by[beg:intMin(n, beg+100)])))
-		}
-		endx = i + j + 1
-		mytag := &tag{
-			beg:  beg,
-			endx: endx,
-		}
-		mytag.btwn = string(by[mytag.beg:mytag.endx])
-		//vv("n=%v; i=%v; beg=%v, endx=%v between='%v'", n, i, beg, mytag.endx, mytag.btwn)
-		if mytag.btwn[1] == '/' {
-			mytag.isClose = true
-			mytag.name = mytag.btwn[2 : len(mytag.btwn)-1]
-		} else {
-			mytag.name = mytag.btwn[1 : len(mytag.btwn)-1]
+// scanner splits the XML read from r into tags. It works incrementally,
+// so we never need to hold the whole file in memory at once.
+type scanner struct {
+	r    *bufio.Reader
+	pos  int // byte position in the file of the next byte to be read
+	line int // line number of the next byte to be read, from 1
+	col  int // characters read so far on the line
+
+	opts       *Options
+	encoding   string // of the input, if not to be detected
+	started    bool
+	transcoded bool // so pos counts bytes of the UTF-8 we decoded
+
+	// with opts.HTML, the <script> or <style> we are in, whose
+	// text may hold a '<' that is not markup.
+	rawText string
+}
+
+func newScanner(r io.Reader, opts *Options) *scanner {
+	return &scanner{r: bufio.NewReaderSize(r, 64<<10), line: 1, opts: opts, encoding: opts.Encoding}
+}
+
+// advance notes that s has read text.
+func (s *scanner) advance(text string) {
+	s.pos += len(text)
+	if nl := strings.LastIndexByte(text, '\n'); nl >= 0 {
+		s.line += strings.Count(text, "\n")
+		s.col = utf8.RuneCountInString(text[nl+1:])
+	} else {
+		s.col += utf8.RuneCountInString(text)
+	}
+}
+
+// last returns the mark of the last character read.
+func (s *scanner) last() mark {
+	return mark{pos: s.pos - 1, line: s.line, col: s.col}
+}
+
+// next returns the next tag, or nil at the end of the input. The text
+// between the previous tag and this one is kept in the tag's pre.
+// Comments are skipped, along with any tags inside them, as are
+// the DOCTYPE declaration and processing instructions like <?xml ...?>.
+// The text of a CDATA section is part of pre, markup and all.
+func (s *scanner) next() (*Tag, error) {
+	if !s.started {
+		s.started = true
+		if err := s.transcode(); err != nil {
+			return nil, err
+		}
+	}
+	var pre string
+	var beg mark
+	for {
+		text, err := s.r.ReadString('<')
+		s.advance(text)
+		if err == io.EOF {
+			// any text after the last tag is ignored.
+			return nil, nil
 		}
-		// get actual name, by reducing
-		// "namespace:tag rdf:about=..." -> "namespace:tag"
-		space := strings.Index(mytag.name, " ")
-		if space >= 0 {
-			mytag.name = mytag.name[:space]
+		if err != nil {
+			return nil, err
 		}
-		mytag.name = strings.TrimSpace(mytag.name)
+		beg = s.last()
+		pre += text[:len(text)-1]
 
-		// set initial colname here, without the namespace "institute:" or "schema:" prefix
-		mytag.colname = stripNamespace(mytag.name)
+		start := s.peekStart()
+		switch {
+		case s.rawText != "":
+			if !hasPrefixFold(start, "/"+s.rawText) {
+				pre += "<"
+				continue
+			}
+			s.rawText = ""
+			goto haveTag
+		case strings.HasPrefix(start, "!--"):
+			s.r.Discard(3)
+			s.advance("!--")
+			err = s.skipComment(beg)
+		case start == "![CDATA[":
+			s.r.Discard(8)
+			s.advance("![CDATA[")
+			var cdata string
+			cdata, err = s.readCDATA(beg)
+			pre += cdata
+		case strings.EqualFold(start, "!DOCTYPE"):
+			err = s.skipDoctype(beg)
+		case len(start) > 0 && start[0] == '?':
+			err = s.skipPI(beg)
+		default:
+			goto haveTag
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+haveTag:
+
+	rest, err := s.readTag()
+	if err == io.EOF {
+		return nil, beg.errorf("tag '<%v' has no closing '>'", rest[:intMin(len(rest), 99)])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mytag := &Tag{
+		beg:  beg.pos,
+		line: beg.line,
+		col:  beg.col,
+		endx: s.pos,
+		btwn: "<" + rest,
+		pre:  pre,
+	}
+	//vv("beg=%v, endx=%v between='%v'", beg, mytag.endx, mytag.btwn)
+	if mytag.btwn[1] == '/' {
+		mytag.isClose = true
+		mytag.name = mytag.btwn[2 : len(mytag.btwn)-1]
+	} else {
+		mytag.name = mytag.btwn[1 : len(mytag.btwn)-1]
+	}
+	// get actual name, by reducing
+	// "namespace:tag rdf:about=..." -> "namespace:tag", and "br/" -> "br"
+	end := strings.IndexAny(mytag.name, " \t\r\n/")
+	if end >= 0 {
+		mytag.name = mytag.name[:end]
+	}
+	if s.opts.HTML {
+		s.htmlTag(mytag)
+	}
 
-		// handle self-closing <tag />, like
-		// <schema:url rdf:resource="http://www..."/>
-		if mytag.btwn[len(mytag.btwn)-2] == '/' {
-			mytag.selfClosed = true
+	// set initial colname here, without the namespace "institute:" or "schema:" prefix,
+	// unless we are keeping them.
+	mytag.colname = s.opts.colName(mytag.name)
+	mytag.base = mytag.colname
+
+	// handle self-closing <tag />, like
+	// <schema:url rdf:resource="http://www..."/>
+	if mytag.btwn[len(mytag.btwn)-2] == '/' {
+		mytag.selfClosed = true
+	}
+	if s.opts.HTML && !mytag.isClose && !mytag.selfClosed && rawTextElements[mytag.name] {
+		s.rawText = mytag.name
+	}
+	return mytag, nil
+}
+
+// peekStart peeks at the start of what follows a '<', enough to tell
+// a comment, CDATA section, or DOCTYPE from a tag, but no more, so
+// that a short tag at the end of what has arrived through a pipe,
+// like </p>, is not held up waiting for the bytes after it.
+func (s *scanner) peekStart() string {
+	n := 1
+	start, _ := s.r.Peek(1)
+	switch {
+	case s.rawText != "":
+		n = 1 + len(s.rawText)
+	case len(start) > 0 && start[0] == '!':
+		n = 8
+	}
+	start, _ = s.r.Peek(n)
+	return string(start)
+}
+
+// readTag reads the rest of a tag, through its closing '>'. A '>'
+// inside a quoted attribute value, as in <note label="a > b">,
+// does not end the tag.
+func (s *scanner) readTag() (rest string, err error) {
+	var quote byte // that opened the value we are in, if any
+	afterEq := false
+	for {
+		more, err := s.r.ReadString('>')
+		s.advance(more)
+		rest += more
+		if err != nil {
+			return rest, err
+		}
+		for i := 0; i < len(more); i++ {
+			c := more[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '=':
+				afterEq = true
+			case afterEq && (c == '"' || c == '\''):
+				quote = c
+				afterEq = false
+			case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+				// an unquoted value, or a name.
+				afterEq = false
+			}
 		}
+		if quote == 0 {
+			return rest, nil
+		}
+	}
+}
 
-		tags = append(tags, mytag)
-		i = endx
+// skipComment reads past the rest of the comment that began at beg,
+// through its closing "-->". The opening "<!--" has already been read.
+func (s *scanner) skipComment(beg mark) error {
+	var comment string
+	for !strings.HasSuffix(comment, "-->") {
+		more, err := s.r.ReadString('>')
+		s.advance(more)
+		comment += more
+		if err == io.EOF {
+			return beg.errorf("comment '<!--%v' has no closing '-->'", comment[:intMin(len(comment), 99)])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCDATA reads the rest of the CDATA section that began at beg,
+// through its closing "]]>", returning its text. Unless we are
+// leaving entities raw, the '&'s in it are escaped, so that when
+// the entities of pre are decoded, the text comes out as written.
+func (s *scanner) readCDATA(beg mark) (string, error) {
+	var cdata string
+	for !strings.HasSuffix(cdata, "]]>") {
+		more, err := s.r.ReadString('>')
+		s.advance(more)
+		cdata += more
+		if err == io.EOF {
+			return "", beg.errorf("CDATA section '<![CDATA[%v' has no closing ']]>'", cdata[:intMin(len(cdata), 99)])
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	cdata = strings.TrimSuffix(cdata, "]]>")
+	if !s.opts.RawEntities {
+		cdata = strings.ReplaceAll(cdata, "&", "&amp;")
+	}
+	return cdata, nil
+}
+
+// skipPI reads past the rest of the processing instruction, like
+// <?xml-stylesheet href="style.xsl"?>, that began at beg.
+func (s *scanner) skipPI(beg mark) error {
+	var pi string
+	for !strings.HasSuffix(pi, "?>") || len(pi) < 3 {
+		more, err := s.r.ReadString('>')
+		s.advance(more)
+		pi += more
+		if err == io.EOF {
+			return beg.errorf("processing instruction '<%v' has no closing '?>'", pi[:intMin(len(pi), 99)])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipDoctype reads past the rest of the <!DOCTYPE ...> declaration
+// that began at beg, including any [internal subset] of markup
+// declarations, which have their own '>'s, quoted strings, and comments.
+func (s *scanner) skipDoctype(beg mark) error {
+	var quote byte
+	depth := 0 // inside [ ]
+	var last [4]byte
+	for {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			return beg.errorf("<!DOCTYPE has no closing '>'")
+		}
+		if err != nil {
+			return err
+		}
+		s.advance(string(c))
+		copy(last[:], last[1:])
+		last[3] = c
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case string(last[:]) == "<!--":
+			at := s.last()
+			at.pos -= 3
+			at.col -= 3
+			if err := s.skipComment(at); err != nil {
+				return err
+			}
+			last = [4]byte{}
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '>' && depth <= 0:
+			return nil
+		}
 	}
-	return
 }
 
 func stripNamespace(s string) (r string) {
@@ -115,214 +508,1213 @@ func stripNamespace(s string) (r string) {
 	return
 }
 
-type Map struct {
+// valueSet holds the values seen for a column, and whether they
+// are all ones to discard.
+type valueSet struct {
 	m       map[string]bool
 	discard bool
 }
 
-func newMap() *Map {
-	return &Map{m: make(map[string]bool)}
+func newValueSet() *valueSet {
+	return &valueSet{m: make(map[string]bool)}
 }
 
-func main() {
+// convert reads XML from r and writes the csv version of it to sink.
+func convert(ctx context.Context, r io.Reader, sink rowSink, opts *Options) error {
+	if opts.Stream {
+		return convertStream(ctx, r, sink, opts)
+	}
+	d, err := parse(ctx, r, opts)
+	if err == errInterrupted && d.tree != nil {
+		// write out the records we did get.
+		if err := writeCsv(ctx, sink, d, opts); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w after %v records", errInterrupted, d.tree.numChild)
+	}
+	if err != nil {
+		return err
+	}
+	return writeCsv(ctx, sink, d, opts)
+}
 
-	// convert XML file to tree of tag(s)
+// convertStream is convert for input that is too big to hold in memory,
+// or that arrives slowly through a pipe. The columns are generated from
+// just the first sample records. After those are written out, each later
+// record is written as soon as it has been read, and then forgotten.
+// Columns that first appear after the sample are not in the header,
+// so they are dropped, with a warning. A recordSink has no columns,
+// but learns from the sample which elements repeat.
+func convertStream(ctx context.Context, r io.Reader, sink rowSink, opts *Options) error {
+	sample := opts.streamSample()
+	p := newParser(ctx, r, opts)
+	d := &doc{simpleMap: p.simpleMap}
+	var cs *colset
+	sampled := false
+	written := 0
 
-	data, err := io.ReadAll(os.Stdin)
-	panicOn(err)
+	p.onRecord = func(rec *Tag) error {
+		rs, whole := sink.(recordSink)
+		if !sampled {
+			if d.tree == nil {
+				d.tree = &Tag{btwn: p.tree.btwn, name: p.tree.name}
+			}
+			d.tree.addChild(rec)
+			if d.tree.numChild < sample {
+				return nil
+			}
+			// have our sample
+			sampled = true
+			var err error
+			if whole {
+				err = writeRecords(ctx, rs, d.tree, opts)
+			} else {
+				cs = newColset(d, opts)
+				noteDiscarded(cs, opts)
+				p.simpleMap = nil // stop collecting stats, they would only grow.
+				if err := writeHeader(ctx, sink, d.tree, cs, opts); err != nil {
+					return err
+				}
+				err = printAsCsv(ctx, sink, d.tree, cs, opts)
+			}
+			written += d.tree.numChild
+			d.tree = nil
+			if err != nil {
+				return err
+			}
+			return sink.flush()
+		}
+		if whole {
+			rs.repeats(rec)
+			if err := rs.record(rec); err != nil {
+				return err
+			}
+			opts.manifest.records(sink, 1)
+			written++
+			return sink.flush()
+		}
+		for _, nm := range filterColumns(cs.add(rec), opts) {
+			if len(opts.Columns) > 0 {
+				break // only the columns asked for are wanted.
+			}
+			if opts.StrictWidth {
+				return fmt.Errorf("column '%v' first appears in record %v, after the first %v records that the header was taken from; -strict-width won't drop it", nm, written+1, sample)
+			}
+			opts.warnf("warning: column '%v' first appears after the first %v records, so it is not in the header; dropping it.\n", nm, sample)
+		}
+		if err := sink.row(csvCells(rec.firstChild, cs)); err != nil {
+			var mismatch *typeMismatch
+			if errors.As(err, &mismatch) {
+				return fmt.Errorf("%w from the first %v records; give -stream-sample more records", err, sample)
+			}
+			return err
+		}
+		opts.manifest.records(sink, 1)
+		written++
+		// whoever is reading from our pipe shouldn't have to wait.
+		return sink.flush()
+	}
 
-	tags := tokenize(data)
-	n := len(tags)
+	var root *Tag
+	var stopped error
+	for {
+		if err := p.run(); err == errInterrupted {
+			stopped = err
+			if root == nil {
+				root = p.tree
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		if p.tree == nil {
+			break
+		}
+		if root == nil {
+			root = p.tree
+		}
+		p.reset()
+	}
+	if !sampled {
+		// fewer records than the sample size.
+		if d.tree == nil {
+			d.tree = root
+		}
+		if err := writeCsv(ctx, sink, d, opts); err != nil {
+			return err
+		}
+		if d.tree != nil {
+			written += d.tree.numChild
+		}
+	}
+	if stopped != nil {
+		return fmt.Errorf("%w after %v records", stopped, written)
+	}
+	return nil
+}
 
-	// build up the parse tree here, by filling in
-	// 	firstChild, nextSib
+// doc is the parse tree of one XML document, along with
+// the content stats we keep to discard no-content columns.
+type doc struct {
+	tree      *Tag
+	simpleMap map[string]*valueSet
+}
+
+// sourceColumn names the column that tells which input a row came from,
+// recordTypeColumn the one that tells what element it came from, and
+// rowColumn the one that tells which record of the input it was, and
+// offsetColumn and lineColumn where in the input that record began.
+const (
+	sourceColumn     = "_source_file"
+	recordTypeColumn = "_record_type"
+	rowColumn        = "_row"
+	offsetColumn     = "_offset"
+	lineColumn       = "_line"
+)
+
+// noteSource adds a sourceColumn field holding source to every record of d.
+func (d *doc) noteSource(source string) {
+	if d.tree == nil {
+		return
+	}
+	for rec := d.tree.firstChild; rec != nil; rec = rec.nextSib {
+		rec.addField(sourceColumn, source)
+	}
+}
 
-	var tree *tag
-	var stack []*tag
+// addField adds a column to record t that isn't in the XML.
+func (t *Tag) addField(name, content string) {
+	t.addChild(&Tag{
+		btwn:     "<" + name + ">",
+		name:     name,
+		colname:  name,
+		base:     name,
+		isSimple: true,
+		content:  content,
+	})
+}
 
-	push := func(t *tag) {
-		stack = append(stack, t)
+// merge appends the records of b after those of d, so
+// that both documents can be written out as one csv.
+func (d *doc) merge(b *doc) {
+	if b.tree == nil {
+		return
 	}
-	pop := func() {
-		m := len(stack)
-		if m > 0 {
-			stack = stack[:m-1]
+	if d.tree == nil {
+		*d = *b
+		return
+	}
+	d.tree.adoptChildren(b.tree)
+	for name, bm := range b.simpleMap {
+		m, ok := d.simpleMap[name]
+		if !ok {
+			d.simpleMap[name] = bm
+			continue
+		}
+		for s := range bm.m {
+			m.m[s] = true
 		}
 	}
-	top := func() *tag {
-		m := len(stack)
-		if m == 0 {
+}
+
+// parse converts an XML file to tree of tag(s). If the input holds several
+// documents back to back, the records of the later ones are added to the
+// first, so they all come out in one csv.
+func parse(ctx context.Context, r io.Reader, opts *Options) (*doc, error) {
+	p := newParser(ctx, r, opts)
+	d := &doc{simpleMap: p.simpleMap}
+	for {
+		err := p.run()
+		if err != nil && err != errInterrupted {
+			return d, err
+		}
+		if p.tree == nil {
+			return d, nil
+		}
+		if d.tree == nil {
+			d.tree = p.tree
+		} else {
+			d.tree.adoptChildren(p.tree)
+		}
+		if err != nil {
+			// interrupted, but between records, so what we have is whole.
+			return d, err
+		}
+		p.reset()
+	}
+}
+
+// convertDocs is convert for input that holds several XML documents back
+// to back, writing each document to its own csv. For outPath "out.csv",
+// these are out-doc-0001.csv, out-doc-0002.csv, and so on.
+func convertDocs(r io.Reader, outPath string, opts *Options) error {
+	if outPath == "" || outPath == "-" {
+		return usagef("-split-docs needs an output file (-o) to name the csv files after")
+	}
+	base, ext := splitCsvExt(outPath)
+	p := newParser(context.Background(), r, opts)
+	for n := 1; ; n++ {
+		if err := p.run(); err != nil {
+			return err
+		}
+		if p.tree == nil {
 			return nil
 		}
-		return stack[m-1]
+		sink, err := openSink(fmt.Sprintf("%v-doc-%04d%v", base, n, ext), opts)
+		if err != nil {
+			return err
+		}
+		err = writeCsv(context.Background(), sink, &doc{tree: p.tree, simpleMap: p.simpleMap}, opts)
+		err2 := sink.close()
+		if err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
+		}
+		p.reset()
+		p.simpleMap = make(map[string]*valueSet)
+	}
+}
+
+// fragmentRoot names the synthetic root element that -fragment
+// wraps the records in. It can't be the name of a real element.
+const fragmentRoot = "(fragment)"
+
+func newFragmentRoot() *Tag {
+	return &Tag{btwn: "<" + fragmentRoot + ">", name: fragmentRoot, colname: fragmentRoot, base: fragmentRoot}
+}
+
+// convertRecordTypes is convert for input that holds more than one kind of
+// record, like <Product> and <DeletedProduct>, writing each kind to its
+// own csv. For outPath "out.csv", these are out-Product.csv, and so on.
+func convertRecordTypes(r io.Reader, outPath string, opts *Options) error {
+	if outPath == "" || outPath == "-" {
+		return usagef("-split-records needs an output file (-o) to name the csv files after")
+	}
+	base, ext := splitCsvExt(outPath)
+	d, err := parse(context.Background(), r, opts)
+	if err != nil {
+		return err
+	}
+	if d.tree == nil {
+		return nil
 	}
-	add_child := func(t *tag) {
-		m := len(stack)
-		if m == 0 {
-			panic("cannot add child to empty stack")
+
+	// sort the records by type, in the order the types first appear.
+	var types []string
+	docs := make(map[string]*doc)
+	for rec := d.tree.firstChild; rec != nil; {
+		next := rec.nextSib
+		rec.nextSib = nil
+		td, ok := docs[rec.base]
+		if !ok {
+			td = &doc{tree: &Tag{btwn: d.tree.btwn, name: d.tree.name}, simpleMap: d.simpleMap}
+			docs[rec.base] = td
+			types = append(types, rec.base)
 		}
-		tp := top()
-		if tp.firstChild == nil {
-			tp.firstChild = t
-			tp.numChild = 1
-		} else {
-			tp.numChild++
-			sib := tp.firstChild
-			for sib.nextSib != nil {
-				sib = sib.nextSib
-			}
-			sib.nextSib = t
+		td.tree.addChild(rec)
+		rec = next
+	}
+
+	for _, typ := range types {
+		sink, err := openSink(fmt.Sprintf("%v-%v%v", base, typ, ext), opts)
+		if err != nil {
+			return err
+		}
+		err = writeCsv(context.Background(), sink, docs[typ], opts)
+		err2 := sink.close()
+		if err == nil {
+			err = err2
+		}
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// parser builds up the parse tree from the tags of a scanner,
+// by filling in firstChild, nextSib.
+type parser struct {
+	sc     *scanner
+	peeked *Tag
+	opts   *Options
+	ctx    context.Context // stops the parse once it is done
+
+	tree  *Tag
+	stack []*Tag
 
 	// keep simple stats so we can discard no-content columns.
 	// NB: did not get this simpleMap mechanism fully working as of yet; seemed to be
 	// throwing out baby with the bathwater.
-	//
-	simpleMap := make(map[string]*Map)
-	addSimple := func(t *tag) {
-		m, ok := simpleMap[t.name]
-		if !ok {
-			m = newMap()
-			simpleMap[t.name] = m
+	// Set to nil to stop collecting.
+	simpleMap map[string]*valueSet
+
+	// if onRecord is set, each depth 1 record is handed to it as
+	// soon as it is complete, and then removed from the tree.
+	onRecord func(rec *Tag) error
+
+	// if onProblem is set, problems with the XML are handed to it,
+	// and repaired where possible, instead of stopping the parse.
+	onProblem func(at mark, msg string)
+
+	// the results of checking the input against opts.XSD.
+	schema *schemaCheck
+
+	recordPath []string // from opts.Record
+	rec        *Tag     // the record we are in, if any
+
+	tags    int64 // elements read so far, for opts.MaxTags
+	records int64 // records read so far, for opts.RowNumbers
+
+	norm *norm.Form // from opts.Normalize
+}
+
+func newParser(ctx context.Context, r io.Reader, opts *Options) *parser {
+	return &parser{
+		ctx:        ctx,
+		sc:         newScanner(r, opts),
+		opts:       opts,
+		simpleMap:  make(map[string]*valueSet),
+		recordPath: opts.recordPath(),
+		norm:       opts.normForm(),
+	}
+}
+
+// next returns the next tag, or nil at the end of the input.
+func (p *parser) next() (*Tag, error) {
+	if p.peeked != nil {
+		t := p.peeked
+		p.peeked = nil
+		return t, nil
+	}
+	return p.sc.next()
+}
+
+// peek returns the tag that next will return, without consuming it.
+func (p *parser) peek() (*Tag, error) {
+	if p.peeked == nil {
+		t, err := p.sc.next()
+		if err != nil {
+			return nil, err
 		}
-		m.m[strings.TrimSpace(t.content)] = true
+		p.peeked = t
 	}
+	return p.peeked, nil
+}
 
-	for i := 0; i < len(tags); i++ {
-		tag := tags[i]
-		if strings.HasPrefix(tag.btwn, "<?xml") {
-			// ignore <?xml version="1.0"?>
-			continue
+func (p *parser) push(t *Tag) {
+	p.stack = append(p.stack, t)
+}
+
+func (p *parser) pop() {
+	m := len(p.stack)
+	if m > 0 {
+		p.stack = p.stack[:m-1]
+	}
+}
+
+func (p *parser) top() *Tag {
+	m := len(p.stack)
+	if m == 0 {
+		return nil
+	}
+	return p.stack[m-1]
+}
+
+func (p *parser) addChild(t *Tag) {
+	if len(p.stack) == 0 {
+		panic("cannot add child to empty stack")
+	}
+	if t.record {
+		// wherever it is in the XML, it goes under the root.
+		p.tree.addChild(t)
+		return
+	}
+	p.top().addChild(t)
+}
+
+// place decides what t, just opened, is: a record, or within one, or
+// else outside of them all, like a header, or the elements that hold
+// the records, and so skipped.
+func (p *parser) place(t *Tag) {
+	if p.rec != nil {
+		return
+	}
+	if p.isRecord(t) {
+		t.record = true
+	} else {
+		t.skip = true
+	}
+}
+
+// isRecord reports whether t, opened under the top of the stack,
+// is a record: by its path, or else by being a child of the root.
+func (p *parser) isRecord(t *Tag) bool {
+	if p.recordPath == nil {
+		return len(p.stack) == 1
+	}
+	if len(p.stack)+1 != len(p.recordPath) {
+		return false
+	}
+	for i, open := range p.stack {
+		if !stepMatches(p.recordPath[i], open.name) {
+			return false
+		}
+	}
+	return stepMatches(p.recordPath[len(p.stack)], t.name)
+}
+
+// stepMatches reports whether the element name, like "onix:Product",
+// matches the step of a record path: "*", or the name, with or without
+// its namespace prefix, or one of several names, as in "Product|Deleted".
+func stepMatches(step, name string) bool {
+	if step == "*" {
+		return true
+	}
+	for _, alt := range strings.Split(step, "|") {
+		if alt == name || alt == stripNamespace(name) {
+			return true
 		}
+	}
+	return false
+}
 
-		if tree == nil {
-			tree = tag
-			push(tag)
-			continue
+func (p *parser) addSimple(t *Tag) {
+	if p.simpleMap == nil {
+		return
+	}
+	m, ok := p.simpleMap[t.name]
+	if !ok {
+		m = newValueSet()
+		p.simpleMap[t.name] = m
+	}
+	content := t.content
+	if !t.preserve {
+		content = strings.TrimSpace(content)
+	}
+	m.m[content] = true
+}
+
+// checkLimits fails if opening t would go past opts.MaxDepth or MaxTags.
+func (p *parser) checkLimits(t *Tag) error {
+	p.tags++
+	if p.tags%1024 == 0 {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if max := p.opts.MaxTags; max > 0 && p.tags > max {
+		return t.mark().errorf("more than %v elements; see -max-tags", max)
+	}
+	if max := p.opts.MaxDepth; max > 0 && len(p.stack) >= max {
+		return t.mark().errorf("'<%v>' is nested more than %v deep; see -max-depth", t.name, max)
+	}
+	return nil
+}
+
+// noteSpace notes whether t is to keep content that is only whitespace:
+// if it says xml:space="preserve", or else if its parent does.
+func (p *parser) noteSpace(t *Tag) {
+	if p.opts.PreserveSpace {
+		t.preserve = true
+		return
+	}
+	if parent := p.top(); parent != nil {
+		t.preserve = parent.preserve
+	}
+	if strings.Contains(t.btwn, "xml:space") {
+		if space, ok := t.attr("xml:space"); ok {
+			t.preserve = space == "preserve"
+		}
+	}
+}
+
+// markNil notes whether t is marked xsi:nil="true", and if
+// so gives it the NilString as its content.
+func (p *parser) markNil(t *Tag) bool {
+	if !strings.Contains(t.btwn, "nil") {
+		return false
+	}
+	for _, a := range t.attrs() {
+		if a.name == "xsi:nil" || strings.HasSuffix(a.name, ":nil") {
+			if a.value == "true" || a.value == "1" {
+				t.isNil = true
+				t.content = p.opts.NilString
+			}
+		}
+	}
+	return t.isNil
+}
+
+// noteLang works out the language of t from its xml:lang, or its
+// parent's. With Options.Lang, t is skipped if in another language;
+// with Options.LangColumns, its column is named for its language,
+// as in title_en, rather than numbered like the other repeats.
+func (p *parser) noteLang(t *Tag) {
+	if p.rec == nil || t.record {
+		// whole records are kept, whatever their language,
+		// so only the languages inside a record matter.
+		return
+	}
+	parent := p.top()
+	if lang, ok := t.attr("xml:lang"); ok {
+		t.lang = lang
+		if p.opts.LangColumns {
+			t.colname += "_" + lang
+			t.base = t.colname
+		}
+	} else {
+		t.lang = parent.lang
+	}
+	if parent.skip || (p.opts.Lang != "" && t.lang != "" && !langMatches(t.lang, p.opts.Lang)) {
+		t.skip = true
+	}
+}
+
+// langMatches reports whether the language tag lang, like "en-US",
+// is the language want, like "en" or "en-US".
+func langMatches(lang, want string) bool {
+	lang, want = strings.ToLower(lang), strings.ToLower(want)
+	return lang == want || strings.HasPrefix(lang, want+"-")
+}
+
+// attrValue gives the self-closed tag t, which has no content of
+// its own, the value of the first of its attributes that is listed
+// in Options.ValueAttrs, as with <schema:url rdf:resource="http://..."/>.
+func (p *parser) attrValue(t *Tag) bool {
+	if len(p.opts.ValueAttrs) == 0 {
+		return false
+	}
+	attrs := t.attrs()
+	for _, name := range p.opts.ValueAttrs {
+		for _, a := range attrs {
+			if a.name == name {
+				t.content = p.text(a.value)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closeTop closes the tag at the top of the stack with the close tag
+// end, reporting whether that was the root, so the document is done.
+func (p *parser) closeTop(end *Tag) (done bool, err error) {
+	open := p.top()
+	p.pop()
+	if open.skip {
+		return false, nil
+	}
+	open.endTag = end
+	if len(p.stack) == 0 {
+		// the root is closed, so the document is done.
+		if open.firstChild == nil {
+			open.content = p.trimHTML(p.text(end.pre))
+		}
+		return true, nil
+	}
+	if p.opts.Mixed && !open.record && p.hasText(open) {
+		p.flattenMixed(open)
+	}
+	if open.record {
+		p.rec = nil
+		return false, p.recordDone(open)
+	}
+	return false, nil
+}
+
+// recoverClose is how Options.Lenient deals with a close tag that does
+// not match the open tag: the open tags are closed for it, up to the
+// matching one, or if none matches, the close tag is ignored. Either
+// way, the record it is in is broken and will be left out. It
+// reports whether the close tag should now go ahead.
+func (p *parser) recoverClose(tag *Tag) bool {
+	if p.rec != nil && !p.rec.broken {
+		p.rec.broken = true
+		if p.onProblem == nil {
+			p.opts.warnf("warning: bad xml at %v: leaving out the broken record that starts at %v.\n", tag.mark(), p.rec.mark())
+		}
+	}
+	i := len(p.stack) - 1
+	for i >= 0 && p.stack[i].name != tag.name {
+		i--
+	}
+	if i < 0 {
+		p.problem(tag.mark(), "'</%v>' has no open tag, so ignoring it", tag.name)
+		return false
+	}
+	p.problem(tag.mark(), "'<%v>' is not closed before '</%v>', so closing it", p.top().name, tag.name)
+	for _, open := range p.stack[i+1:] {
+		if open == p.rec {
+			// closing around a record that never will close.
+			p.tree.removeLast()
+			p.rec = nil
+		}
+	}
+	p.stack = p.stack[:i+1]
+	return true
+}
+
+// problem reports a problem with the XML at, that we can work around:
+// to onProblem, if set, or else as a warning.
+func (p *parser) problem(at mark, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if p.onProblem != nil {
+		p.onProblem(at, msg)
+		return
+	}
+	p.opts.warnf("warning: bad xml at %v: %v.\n", at, msg)
+}
+
+// text returns s with its entities decoded, unless we keep them raw.
+func (p *parser) text(s string) string {
+	switch {
+	case p.opts.RawEntities:
+	case p.opts.HTML:
+		// knows all of HTML's named entities, like &nbsp;
+		s = html.UnescapeString(collapseSpace(s))
+	default:
+		s = unescapeEntities(s)
+	}
+	if p.norm != nil {
+		s = p.norm.String(s)
+	}
+	return s
+}
+
+// hasText reports whether the compound tag t has any text directly
+// inside it, between its children, making it mixed content, as in
+// <p>Hello <b>world</b> again</p>.
+func (p *parser) hasText(t *Tag) bool {
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		if strings.TrimSpace(c.pre) != "" {
+			return true
+		}
+	}
+	return strings.TrimSpace(t.endTag.pre) != ""
+}
+
+// flattenMixed turns the mixed content tag t into a simple one, whose
+// content is all the text inside it, with the inline tags dropped.
+func (p *parser) flattenMixed(t *Tag) {
+	var b strings.Builder
+	p.allText(&b, t)
+	t.content = p.trimHTML(b.String())
+	t.isSimple = true
+	t.firstChild, t.lastChild, t.numChild = nil, nil, 0
+	p.addSimple(t)
+}
+
+func (p *parser) allText(b *strings.Builder, t *Tag) {
+	if t.isSimple {
+		b.WriteString(t.content)
+		return
+	}
+	if t.selfClosed {
+		return
+	}
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		b.WriteString(p.text(c.pre))
+		p.allText(b, c)
+	}
+	b.WriteString(p.text(t.endTag.pre))
+}
+
+// unclosed deals with the elements still open at the end of the input,
+// as when it was cut short: an error, unless we are repairing the XML.
+// Options.Lenient leaves out the record that was cut off, with a
+// warning; the root that Options.Fragment wraps the records in is
+// never closed, so it doesn't count.
+func (p *parser) unclosed() error {
+	open := len(p.stack)
+	for open > 0 && p.stack[open-1].name != fragmentRoot {
+		open--
+	}
+	if open == len(p.stack) {
+		return nil
+	}
+	if p.onProblem == nil && !p.opts.Lenient {
+		t := p.top()
+		return t.mark().errorf("'<%v>' is never closed", t.name)
+	}
+	for i := len(p.stack) - 1; i >= open; i-- {
+		p.problem(p.stack[i].mark(), "'<%v>' is never closed", p.stack[i].name)
+	}
+	if p.rec != nil && p.onProblem == nil {
+		p.opts.warnf("warning: bad xml: leaving out the record that starts at %v, which the input ends inside of.\n", p.rec.mark())
+		p.tree.removeLast()
+		p.rec = nil
+	}
+	return nil
+}
+
+// reset readies p for the next document in the input.
+func (p *parser) reset() {
+	p.tree = nil
+	p.rec = nil
+	p.stack = p.stack[:0]
+}
+
+// recordDone is called once the depth 1 record rec is complete.
+// Between records is where we stop, if we have been interrupted,
+// so that no half read record is ever written out.
+func (p *parser) recordDone(rec *Tag) error {
+	p.records++
+	if p.opts.Checksum != "" {
+		// before any of the added fields, which aren't in the XML.
+		rec.addField(checksumColumn, recordChecksum(rec, p.opts.Checksum))
+	}
+	if p.opts.UUIDKey != "" {
+		if id := recordUUID(rec, p.opts); id != "" {
+			rec.addField(uuidColumn, id)
+		}
+	}
+	if p.opts.RowNumbers {
+		rec.addField(rowColumn, strconv.FormatInt(p.records, 10))
+	}
+	switch p.opts.SourceOffset {
+	case "byte":
+		rec.addField(offsetColumn, strconv.Itoa(rec.beg))
+	case "line":
+		rec.addField(lineColumn, strconv.Itoa(rec.line))
+	}
+	if p.opts.RecordTypeColumn {
+		rec.addField(recordTypeColumn, rec.base)
+	}
+	if p.schema != nil {
+		if v := p.rejects(rec); len(v) > 0 && !rec.broken {
+			if err := p.reject(rec, v); err != nil {
+				return err
+			}
+			rec.broken = true
+		}
+	}
+	if rec.broken {
+		p.tree.removeLast()
+	} else {
+		recs := []*Tag{rec}
+		if p.opts.Explode != "" {
+			recs = append(recs, explode(rec, strings.Split(p.opts.Explode, "/"), p.opts.Carry)...)
+			for _, r := range recs[1:] {
+				p.tree.addChild(r)
+			}
+		}
+		if p.onRecord != nil {
+			// detach them, so the tree doesn't keep growing.
+			p.tree.firstChild, p.tree.lastChild, p.tree.numChild = nil, nil, 0
+			for _, r := range recs {
+				r.nextSib = nil
+				if err := p.onRecord(r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	if interrupted() {
+		return errInterrupted
+	}
+	return nil
+}
+
+// run reads the tags of one XML document and assembles them into
+// p.tree. It returns at the end of the document, when the root is
+// closed, with any further documents in the input left unread.
+// p.tree is nil if there were no more documents.
+func (p *parser) run() error {
+	if p.opts.XSD != "" && !p.sc.started {
+		if err := p.checkSchema(); err != nil {
+			return err
+		}
+	}
+	if p.recordPath == nil && p.onProblem == nil && !p.opts.Stream && !p.opts.rootRecords && !p.sc.started {
+		if err := p.detectRecord(); err != nil {
+			return err
+		}
+	}
+	for {
+		tag, err := p.next()
+		if err != nil {
+			return err
+		}
+		if tag == nil {
+			if p.opts.HTML {
+				if err := p.closeAll(); err != nil {
+					return err
+				}
+			}
+			if p.schema != nil {
+				if err := p.schemaDone(); err != nil {
+					return err
+				}
+			}
+			return p.unclosed()
+		}
+		if p.onProblem != nil {
+			p.checkTag(tag)
+		}
+		if p.opts.NamespaceMap != nil && !tag.isClose {
+			p.canonicalName(tag)
+		}
+		if !tag.isClose {
+			if err := p.checkLimits(tag); err != nil {
+				return err
+			}
+			p.noteSpace(tag)
+		}
+
+		if p.tree == nil {
+			if !p.opts.Fragment {
+				p.tree = tag
+				if tag.selfClosed {
+					// an empty root is the whole document.
+					return nil
+				}
+				p.push(tag)
+				continue
+			}
+			// the root we wrap the records in, which is
+			// never closed; the end of the input ends it.
+			p.tree = newFragmentRoot()
+			p.push(p.tree)
+		}
+		if p.opts.HTML && !tag.isClose {
+			if done, err := p.closeImplied(tag); done || err != nil {
+				return err
+			}
+		}
+		if !tag.isClose {
+			p.place(tag)
+			if p.opts.Lang != "" || p.opts.LangColumns {
+				p.noteLang(tag)
+			}
 		}
 
 		if tag.selfClosed {
-			add_child(tag)
+			if tag.skip {
+				continue
+			}
+			if !p.markNil(tag) && p.attrValue(tag) {
+				p.addSimple(tag)
+			}
+			p.addChild(tag)
+			if tag.record {
+				if err := p.recordDone(tag); err != nil {
+					return err
+				}
+			}
 			continue
 		}
 
-		// peek 1 ahead for simple tags
-		if i < n-1 {
-			if !tag.isClose && tags[i+1].isClose && tag.name == tags[i+1].name {
+		if tag.isClose {
+			open := p.top()
+			if open == nil {
+				return tag.mark().errorf("close of '%v' without an open tag", tag.name)
+			}
+			if tag.name != open.name {
+				switch {
+				case p.opts.HTML:
+					if ok, err := p.closeUpTo(tag); !ok || err != nil {
+						return err
+					}
+				case !p.opts.Lenient && p.onProblem == nil:
+					return tag.mark().errorf("'</%v>' does not match the open '<%v>'", tag.name, open.name)
+				case !p.recoverClose(tag):
+					continue
+				}
+			}
+			if done, err := p.closeTop(tag); done || err != nil {
+				return err
+			}
+			continue
+		}
 
-				tag.isSimple = true
-				endTag := tags[i+1]
-				endTag.isSimple = true
-				tag.endTag = endTag
-				endTag.begTag = tag
-				tag.content = string(data[tag.endx:endTag.beg])
-				addSimple(tag)
+		// peek 1 ahead for simple tags. (We don't peek past
+		// close tags, so a record on a pipe is done as soon
+		// as its close tag arrives.)
+		nxt, err := p.peek()
+		if err != nil {
+			return err
+		}
+		if nxt == nil {
+			// an open tag at the very end; nothing more to do.
+			continue
+		}
+		if nxt.isClose && tag.name == nxt.name {
 
-				// skip past the closing tag
-				i++
-				add_child(tag)
+			tag.isSimple = true
+			endTag, _ := p.next() // skip past the closing tag
+			endTag.isSimple = true
+			if p.onProblem != nil {
+				p.checkTag(endTag)
+			}
+			tag.endTag = endTag
+			endTag.begTag = tag
+			if tag.skip {
 				continue
 			}
+			tag.content = p.trimHTML(p.text(endTag.pre))
+			if !p.markNil(tag) {
+				p.addSimple(tag)
+			}
 
-			// have a compound tag
-			if !tag.isClose {
-				if len(stack) > 0 {
-					add_child(tag)
+			p.addChild(tag)
+			if tag.record {
+				if err := p.recordDone(tag); err != nil {
+					return err
 				}
-				push(tag)
-			} else {
-				if tag.name != top().name {
-					panic(fmt.Sprintf("maybe bad xml at i=%v trying to close '%v' against open '%v'", i, tag.name, top().name))
-				}
-				pop()
 			}
+			continue
+		}
+
+		// have a compound tag. (One we skip still goes on
+		// the stack, to gather up its children, but is never
+		// added to the tree.)
+		if !tag.skip {
+			p.addChild(tag)
+		}
+		p.push(tag)
+		if tag.record {
+			p.rec = tag
 		}
 		//vv("tag = '%v'", tag)
 	}
+}
+
+// colset holds the csv columns generated from the records.
+type colset struct {
+	colnm  []string       // every column name generated, in order
+	colmap map[string]int // index of each name in colnm
+	final  []string       // the columns we actually write, in order
+	fmap   map[string]int // index of each name in final
+	header []string       // final, as renamed for the header
+	sep    string         // joins the names of nested elements
+	skip   []string       // the elements to leave out, as opts.skipTags
+	join   string         // joins the values of repeated siblings, if set
+	suffix string         // numbers the columns of repeated siblings
+	start  int            // what the first of the repeats counts as
+
+	discarded []string // the columns left out for holding only discard values
+}
 
-	exclude := noteDiscards(simpleMap)
+// newColset generates the columns for the records of d, ordered
+// as opts.ColumnOrder says, and filtered by opts.Include and
+// opts.Exclude. The ones written are opts.Columns, when given,
+// and the header names them as opts.Rename says.
+func newColset(d *doc, opts *Options) *colset {
+	exclude := make(map[string]bool)
+	if !opts.KeepAllColumns {
+		exclude = noteDiscards(d.simpleMap, opts.discardValues())
+	}
 	//vv("exclude dicards = '%v'", exclude)
-	markZeroContentTags(tags, simpleMap)
+	markZeroContentTags(d.tree, d.simpleMap)
 
-	//vv("top node has %v children", tree.numChild)
+	//vv("top node has %v children", d.tree.numChild)
 
-	//printXMLTree(tree, 0)
+	//printXMLTree(d.tree, 0)
 
-	stack = stack[:0] // clear the stack
+	var stack []*Tag
 
-	var colnm []string
-	colmap := make(map[string]int)
-	cur := tree.firstChild
+	cs := &colset{colmap: make(map[string]int), sep: opts.pathSep(), skip: opts.skipTags(), join: opts.JoinRepeats,
+		suffix: opts.dupSuffix(), start: opts.DupStart}
+	cur := d.tree.firstChild
 	sibnames := make(map[string]int)
-	genColnames(&colnm, colmap, stack, sibnames, cur)
+	cs.genColnames(stack, sibnames, cur)
 
-	// sort the columns for final output
-	var final []string
-	for _, cn := range colnm {
+	// sort the columns for final output, unless they are
+	// wanted in the order they first appeared.
+	for _, cn := range cs.colnm {
 		// excludes does nothing at the moment because it includes the namespace for
 		// dis-ambiguation, whereas the colnm has had the namespace stripped out.
 		if !exclude[cn] {
-			final = append(final, cn)
+			cs.final = append(cs.final, cn)
+		} else {
+			cs.discarded = append(cs.discarded, cn)
 		}
 	}
-	sort.Strings(final)
-	fmap := make(map[string]int)
-	for i, s := range final {
-		fmap[s] = i
+	cs.final = filterColumns(cs.final, opts)
+	if opts.ColumnOrder != "document" {
+		sort.Strings(cs.final)
 	}
+	if opts.RowNumbers {
+		// first, however the rest are ordered.
+		cs.final = moveToFront(cs.final, rowColumn)
+	}
+	if opts.Relational {
+		cs.final = moveToFront(cs.final, parentIDColumn)
+		cs.final = moveToFront(cs.final, idColumn)
+	}
+	if len(opts.Columns) > 0 {
+		cs.final = opts.Columns
+	}
+	cs.fmap = make(map[string]int)
+	for i, s := range cs.final {
+		cs.fmap[s] = i
+	}
+	cs.header = renameColumns(cs.final, opts)
 
 	// why no _id field? b/c was wrongly being detected as a discard, weird.
-	//vv("colnm (%v) = '%#v'", len(colnm), colnm)
-	//vv("final (%v) = '%#v'", len(final), final)
+	//vv("colnm (%v) = '%#v'", len(cs.colnm), cs.colnm)
+	//vv("final (%v) = '%#v'", len(cs.final), cs.final)
+	return cs
+}
 
-	// print header
-	for i, s := range final {
-		if i == 0 {
-			fmt.Printf("%v", s)
-		} else {
-			fmt.Printf(",%v", s)
+// add generates the column names for a record that arrived after
+// the header was written, returning any that are not in the header.
+func (cs *colset) add(rec *Tag) (missing []string) {
+	n := len(cs.colnm)
+	cs.genColnames(nil, make(map[string]int), rec)
+	for _, nm := range cs.colnm[n:] {
+		if _, ok := cs.fmap[nm]; !ok {
+			missing = append(missing, nm)
 		}
 	}
-	fmt.Printf("\n")
-	printAsCsv(tree, fmap)
+	return
+}
+
+// noteDiscarded reports the columns that were left out of the csv
+// for holding nothing but the discard values.
+func noteDiscarded(cs *colset, opts *Options) {
+	if len(cs.discarded) == 0 {
+		return
+	}
+	opts.warnf("note: leaving out %v, which only held %q. Use -keep-all-columns to keep them.\n",
+		strings.Join(cs.discarded, ", "), opts.discardValues())
+}
+
+// writeHeader sends the header for cs to sink, with the types of
+// the columns, as the records of tree show them, if opts asks.
+func writeHeader(ctx context.Context, sink rowSink, tree *Tag, cs *colset, opts *Options) error {
+	var types []string
+	if opts.TypesRow || opts.typed() || len(schemaFiles(opts)) > 0 {
+		types = columnTypes(tree, cs)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	opts.manifest.columns(sink, cs)
+	return sink.header(cs.header, types)
+}
+
+// writeCsv writes the header and then one csv line per record of d.
+func writeCsv(ctx context.Context, sink rowSink, d *doc, opts *Options) error {
+	if d.tree == nil {
+		return nil
+	}
+	if rs, ok := sink.(recordSink); ok {
+		return writeRecords(ctx, rs, d.tree, opts)
+	}
+	cs := newColset(d, opts)
+	opts.progressf("%v records, %v columns", d.tree.numChild, len(cs.final))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	noteDiscarded(cs, opts)
+
+	// print header
+	if err := writeHeader(ctx, sink, d.tree, cs, opts); err != nil {
+		return err
+	}
+	return printAsCsv(ctx, sink, d.tree, cs, opts)
 }
 
-func printAsCsv(tree *tag, fmap map[string]int) {
+func printAsCsv(ctx context.Context, sink rowSink, tree *Tag, cs *colset, opts *Options) error {
 
 	cur := tree.firstChild
-	for cur != nil {
-		fmt.Printf("%v\n", asCsvLine(cur.firstChild, fmap))
+	for n := 1; cur != nil; n++ {
+		if err := sink.row(csvCells(cur.firstChild, cs)); err != nil {
+			return err
+		}
+		if n%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 		cur = cur.nextSib
 	}
+	opts.manifest.records(sink, tree.numChild)
+	return nil
 }
 
-func asCsvLine(cur *tag, fmap map[string]int) string {
-	fld := make([]string, len(fmap))
+// csvCells returns the row for the record whose first child is cur:
+// one cell for each column of the header, whatever the record holds.
+func csvCells(cur *Tag, cs *colset) []cell {
+	fld := make([]cell, len(cs.final))
 
-	fillFields(cur, fmap, fld)
+	fillFields(cur, cs, fld)
 
-	return strings.Join(fld, ",")
+	return fld
 }
 
-func fillFields(cur *tag, fmap map[string]int, fld []string) {
+func fillFields(cur *Tag, cs *colset, fld []cell) {
 	if cur == nil {
 		return
 	}
-	w, ok := fmap[cur.colname]
+	if cur.skipped {
+		fillFields(cur.nextSib, cs, fld)
+		return
+	}
+	w, ok := cs.fmap[cur.colname]
 	if ok {
-		fld[w] = `"` + esc(trimAllSpace(cur.content)) + `"`
+		var c cell
+		if cur.isNil {
+			// unquoted, so that even "" is told apart from a real empty string.
+			c = cell{value: cur.content, null: true}
+		} else {
+			c = cell{value: cur.Text(), quoted: true}
+		}
+		if cur.repeat {
+			c.value = fld[w].value + cs.join + c.value
+			c.quoted = c.quoted || fld[w].quoted
+		}
+		fld[w] = c
 	}
 
 	if cur.firstChild != nil {
-		fillFields(cur.firstChild, fmap, fld)
+		fillFields(cur.firstChild, cs, fld)
 	}
 	if cur.nextSib != nil {
-		fillFields(cur.nextSib, fmap, fld)
+		fillFields(cur.nextSib, cs, fld)
 	}
 }
 
-func prefix(stack []*tag) (r string) {
+// skipTag reports whether cur, under the elements in stack, is one
+// to leave out. A pattern without a "/" is matched against its name,
+// wherever it is; one with, against its path from the record, like
+// "Product/Contributor/Role". Each step is matched as stepMatches does.
+func skipTag(patterns []string, stack []*Tag, cur *Tag) bool {
+	for _, pat := range patterns {
+		steps := strings.Split(pat, "/")
+		if len(steps) == 1 {
+			if stepMatches(pat, cur.name) {
+				return true
+			}
+			continue
+		}
+		if len(steps) != len(stack)+1 {
+			continue
+		}
+		match := stepMatches(steps[len(stack)], cur.name)
+		for i, open := range stack {
+			if !match {
+				break
+			}
+			match = stepMatches(steps[i], open.name)
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// prefix joins the names of the elements in stack, below the
+// record, each followed by sep.
+func prefix(stack []*Tag, sep string) (r string) {
 	for i, tag := range stack {
 		if i == 0 {
 			// skip the top level record name
@@ -330,24 +1722,25 @@ func prefix(stack []*tag) (r string) {
 		}
 		//r += strings.ReplaceAll(tag.colname, ":", "_") + "_"
 		r += tag.colname
-		r += "_"
+		r += sep
 	}
 	return
 }
 
 // Use sibnames to detect repeated xml elements that have the same tag.
 //
-func genColnames(colnm *[]string, colmap map[string]int, stack []*tag, sibnames map[string]int, cur *tag) {
+func (cs *colset) genColnames(stack []*Tag, sibnames map[string]int, cur *Tag) {
 
 	if cur == nil {
 		return
 	}
-	if cur.name == "schema:created" || cur.name == "schema:modified" { // || cur.discard {
+	if cur.skipped || skipTag(cs.skip, stack, cur) { // || cur.discard {
 		// can skip these but have to do their siblings, and since
 		// we use nextSib links, these records are the only way to
 		// get to their siblings, so it must be done now.
+		cur.skipped = true
 		if cur.nextSib != nil {
-			genColnames(colnm, colmap, stack, sibnames, cur.nextSib)
+			cs.genColnames(stack, sibnames, cur.nextSib)
 		}
 		return
 	}
@@ -358,89 +1751,96 @@ func genColnames(colnm *[]string, colmap map[string]int, stack []*tag, sibnames
 	// have to do this before we push our cur onto the stack.
 	// also we don't want to give each depth 1 record its own name, so require len(stack) > 0
 	if len(stack) > 0 {
-		dup, already := sibnames[cur.name]
-		if already {
-			sibnames[cur.name] = dup + 1
+		// the base is part of the key, so title_en and title_fr
+		// are not taken for repeats of each other.
+		key := cur.name + "/" + cur.base
+		dup, already := sibnames[key]
+		if already && cs.join != "" && cur.numChild == 0 {
+			// its value goes in the first one's column.
+			cur.repeat = true
+		} else if already {
+			sibnames[key] = dup + 1
 			cur.dupcount = dup + 1
-			cur.colname = fmt.Sprintf("%v%v", stripNamespace(cur.name), cur.dupcount)
+			cur.colname = cur.base + fmt.Sprintf(cs.suffix, cur.dupcount+cs.start)
 			//vv("detected duplicate cur.name='%v'; cur.dupcount=%v -> cur.colname='%v'; sibnames is now: '%v'; stack[0]='%v'", cur.name, cur.dupcount, cur.colname, sibnames, stack[0].btwn)
 		} else {
-			sibnames[cur.name] = 0
+			sibnames[key] = 0
 		}
 	}
 
 	if cur.numChild == 0 {
-		nm := prefix(stack) + cur.colname
+		nm := prefix(stack, cs.sep) + cur.colname
 		//vv("at leaf, nm = '%v' from cur.colname='%v'; cur.name='%v'", nm, cur.colname, cur.name)
 
 		//if cur.colname == "ID" {
 		//vv("found simple ID tag: '%v' with colname = '%v'; nm='%v'", cur, cur.colname, nm)
 		//}
 
-		k, ok := colmap[nm]
+		k, ok := cs.colmap[nm]
 		if !ok {
-			colmap[nm] = len(*colnm)
-			*colnm = append(*colnm, nm)
+			cs.colmap[nm] = len(cs.colnm)
+			cs.colnm = append(cs.colnm, nm)
 			cur.colname = nm
 		} else {
-			cur.colname = (*colnm)[k]
+			cur.colname = cs.colnm[k]
 		}
 	} else {
 		//vv("cur '%v' has %v children", cur.name, cur.numChild)
 		cur.compound = true
 		if cur.firstChild != nil {
-			genColnames(colnm, colmap, append(stack, cur), make(map[string]int), cur.firstChild)
+			cs.genColnames(append(stack, cur), make(map[string]int), cur.firstChild)
 		}
 	}
 
 	if cur.nextSib != nil {
-		genColnames(colnm, colmap, stack, sibnames, cur.nextSib)
+		cs.genColnames(stack, sibnames, cur.nextSib)
 	}
 }
 
-// if a column has only empty string "" or the just the value "None", or just both of these,
-// the mark it as a discard.
-func noteDiscards(simpleMap map[string]*Map) (r map[string]bool) {
+// if a column holds nothing but the discard values, by default the empty
+// string "" and "None", then mark it as a discard.
+func noteDiscards(simpleMap map[string]*valueSet, values []string) (r map[string]bool) {
+	discard := make(map[string]bool)
+	for _, s := range values {
+		discard[s] = true
+	}
 	r = make(map[string]bool)
 	for name, m := range simpleMap {
 		_ = name
 		n := len(m.m)
 		if n == 0 {
 			m.discard = true
-			//vv("discarding tag '%v'", name)
 			r[name] = true
 			continue
 		}
-		if n > 2 {
+		if n > len(discard) {
 			continue
 		}
 		keep := false
 		for s := range m.m {
-			if s != "" && s != "None" {
+			if !discard[s] {
 				keep = true
 			}
 		}
 		if !keep {
 			m.discard = true
-			//vv("discarding tag '%v'", name)
 			r[name] = true
 		}
 	}
 	return
 }
 
-func markZeroContentTags(tags []*tag, simpleMap map[string]*Map) {
-	for _, tag := range tags {
-		m, ok := simpleMap[tag.name]
-		if !ok {
-			continue
+func markZeroContentTags(cur *Tag, simpleMap map[string]*valueSet) {
+	for ; cur != nil; cur = cur.nextSib {
+		if m, ok := simpleMap[cur.name]; ok {
+			cur.discard = m.discard
 		}
-		tag.discard = m.discard
+		markZeroContentTags(cur.firstChild, simpleMap)
 	}
 }
 
 // printXMLTree re-displays the parsed XML
-func printXMLTree(cur *tag, level int) {
+func printXMLTree(cur *Tag, level int) {
 
 	indent := strings.Repeat(" ", level*4)
 	fmt.Printf("%v%v\n", indent, cur)
@@ -0,0 +1,162 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// scanAll returns the tags that the scanner splits in into, like
+// `<a> "text" </a>`, each preceded by its pre text, if it has any.
+func scanAll(in string, opts *Options) (string, error) {
+	s := newScanner(strings.NewReader(in), opts)
+	var out []string
+	for {
+		t, err := s.next()
+		if err != nil {
+			return strings.Join(out, " "), err
+		}
+		if t == nil {
+			return strings.Join(out, " "), nil
+		}
+		if t.pre != "" {
+			out = append(out, fmt.Sprintf("%q", t.pre))
+		}
+		switch {
+		case t.isClose:
+			out = append(out, "</"+t.name+">")
+		case t.selfClosed:
+			out = append(out, "<"+t.name+"/>")
+		default:
+			out = append(out, "<"+t.name+">")
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	cases := []struct {
+		what, in, want string
+	}{
+		{"elements", `<a><b>1</b></a>`, `<a> <b> "1" </b> </a>`},
+		{"self-closed", `<a><b/><c /></a>`, `<a> <b/> <c/> </a>`},
+		{"namespaced", `<x:a xmlns:x="u"><x:b>1</x:b></x:a>`, `<x:a> <x:b> "1" </x:b> </x:a>`},
+		{"close with space", `<a>t</a >`, `<a> "t" </a>`},
+		{"comment", `<a>x<!-- <b>no</b> -->y</a>`, `<a> "xy" </a>`},
+		{"comment before the root", `<!-- <b> --><a/>`, `<a/>`},
+		{"comment with < and >", `<a><!-- if a < b && b > c --></a>`, `<a> </a>`},
+		{"cdata", `<a><![CDATA[<b>&</b>]]></a>`, `<a> "<b>&amp;</b>" </a>`},
+		{"cdata with ]]", `<a><![CDATA[x]]y]]></a>`, `<a> "x]]y" </a>`},
+		{"cdata with a comment", `<a><![CDATA[<!-- x -->]]></a>`, `<a> "<!-- x -->" </a>`},
+		{"lines", "<a>\n  <b>1</b>\n</a>\n", `<a> "\n  " <b> "1" </b> "\n" </a>`},
+		{"text after the end", `<a/>tail`, `<a/>`},
+		{"doctype", `<!DOCTYPE a><a/>`, `<a/>`},
+		{"doctype system", `<!DOCTYPE ONIXMessage SYSTEM "http://x/onix.dtd"><ONIXMessage/>`, `<ONIXMessage/>`},
+		{"doctype subset", `<!DOCTYPE a [<!ENTITY e "x>"><!-- ]> --><!ELEMENT a ANY>]><a/>`, `<a/>`},
+		{"pi", `<?xml version="1.0"?><a/>`, `<a/>`},
+		{"stylesheet pi", `<?xml version="1.0"?><?xml-stylesheet href="s.xsl"?><a><?php echo 1 ?>t</a>`, `<a> "t" </a>`},
+		{"pi with >", `<?pi a > b?><a/>`, `<a/>`},
+		{"quoted >", `<a x="1 > 2">t</a>`, `<a> "t" </a>`},
+		{"single quoted >", `<a><b x='>' y="/>"/></a>`, `<a> <b/> </a>`},
+		{"unquoted quote", `<a x=1"2>t</a>`, `<a> "t" </a>`},
+	}
+	for _, c := range cases {
+		got, err := scanAll(c.in, &Options{})
+		if err != nil {
+			t.Errorf("%v: %v: unexpected error: %v", c.what, c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%v: %v:\n got %v\nwant %v", c.what, c.in, got, c.want)
+		}
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	cases := []struct {
+		what, in, want string
+	}{
+		{"unclosed comment", `<a><!-- x`, `comment '<!-- x' has no closing '-->'`},
+		{"unclosed cdata", `<a><![CDATA[x`, `has no closing ']]>'`},
+		{"unclosed tag", `<a><b x="1"`, `tag '<b x="1"' has no closing '>'`},
+		{"unclosed quote", `<a x="1>t</a>`, `has no closing '>'`},
+		{"unclosed doctype", `<!DOCTYPE a [<!ENTITY e ">">`, `<!DOCTYPE has no closing '>'`},
+		{"unclosed pi", `<?xml x`, `has no closing '?>'`},
+	}
+	for _, c := range cases {
+		_, err := scanAll(c.in, &Options{})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: %v: got error %v, want one with %q", c.what, c.in, err, c.want)
+		}
+	}
+}
+
+// A '>' in a quoted value is kept in it, and the tag goes on.
+func TestQuotedAttr(t *testing.T) {
+	root, err := Parse(strings.NewReader(`<note label="a > b" by='c>d'>t</note>`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"label": "a > b", "by": "c>d"} {
+		if v, ok := root.Attr(name); !ok || v != want {
+			t.Errorf("%v is %q, %v; want %q", name, v, ok, want)
+		}
+	}
+	if root.Text() != "t" {
+		t.Errorf("text %q, want %q", root.Text(), "t")
+	}
+}
+
+// Markup in a comment or a CDATA section is not taken for tags.
+func TestCommentsAndCDATA(t *testing.T) {
+	in := `<r><p><t><![CDATA[A <b> & </t> tale]]></t><!-- <u>1</u> --></p><p><t>x</t></p></r>`
+	var out bytes.Buffer
+	if _, err := Convert(strings.NewReader(in), &out, Options{Quote: "minimal"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "t\nA <b> & </t> tale\nx\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestScannerPositions(t *testing.T) {
+	s := newScanner(strings.NewReader("<a>\n  <b x='>'/>\n</a>"), &Options{})
+	var got []string
+	for {
+		tag, err := s.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag == nil {
+			break
+		}
+		got = append(got, fmt.Sprintf("%v@%v", tag.name, tag.mark()))
+	}
+	want := "a@line 1, column 1 (byte 0) b@line 2, column 3 (byte 6) a@line 3, column 1 (byte 17)"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got  %v\nwant %v", strings.Join(got, " "), want)
+	}
+}
+
+// A ParseError gives the line and the column, in characters, of where
+// the trouble is.
+func TestParseErrorPosition(t *testing.T) {
+	_, err := Convert(strings.NewReader("<a>\n  <é>1</é><b x=\"1\""), io.Discard, Options{})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got %v, want a *ParseError", err)
+	}
+	if parseErr.Line != 2 || parseErr.Col != 11 || parseErr.Pos != 16 {
+		t.Errorf("got line %v, column %v, byte %v; want 2, 11, 16", parseErr.Line, parseErr.Col, parseErr.Pos)
+	}
+	parseErr.File = "in.xml"
+	if want := "in.xml:2:11: bad xml: "; !strings.HasPrefix(parseErr.Error(), want) {
+		t.Errorf("got %q, want it to start %q", parseErr.Error(), want)
+	}
+}
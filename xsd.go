@@ -0,0 +1,237 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// There is no XML Schema support in the standard library, so -xsd uses
+// the xmllint tool from libxml2. It validates the whole input, and each
+// violation it finds is pinned to the record whose lines hold it; those
+// records are left out of the csv, and written instead, each after a
+// comment listing its violations, to Options.Rejects.
+
+// violation is one schema error reported by xmllint.
+type violation struct {
+	line int
+	msg  string
+}
+
+// schemaCheck holds the violations found in one input, and the
+// spooled copy of it that we parse and copy rejected records from.
+type schemaCheck struct {
+	spool      *os.File
+	violations []violation // by line
+	next       int         // index of the first violation not yet pinned
+	rejected   int
+}
+
+// xmllintError matches "file.xml:12: element price: Schemas validity
+// error : Element 'price': 'abc' is not a valid value of ...".
+var xmllintError = regexp.MustCompile(`^.*?:(\d+): .*?Schemas validity error : (.*)$`)
+
+// checkSchema spools the input to a temporary file, validates it
+// against opts.XSD, and then has the scanner read the spooled copy.
+func (p *parser) checkSchema() error {
+	spool, err := os.CreateTemp("", "xml2csv-*.xml")
+	if err != nil {
+		return err
+	}
+	// unlinked now, it goes away once closed.
+	defer os.Remove(spool.Name())
+
+	if _, err := io.Copy(spool, p.sc.r); err != nil {
+		spool.Close()
+		return err
+	}
+	violations, err := xmllint(p.opts.XSD, spool.Name())
+	if err != nil {
+		spool.Close()
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		return err
+	}
+	p.sc.r.Reset(spool)
+	p.schema = &schemaCheck{spool: spool, violations: violations}
+	return nil
+}
+
+// xmllint validates the XML at path against the schema xsd.
+func xmllint(xsd, path string) (r []violation, err error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("xmllint", "--noout", "--schema", xsd, path)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return nil, fmt.Errorf("-xsd needs the xmllint tool (from libxml2) on the PATH")
+	case errors.As(err, &exitErr):
+		// 3 means the XML doesn't match the schema, and 1 that it isn't
+		// well-formed, which our own parse will report; any other code
+		// is a problem with the schema.
+		if code := exitErr.ExitCode(); code != 1 && code != 3 {
+			msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+			return nil, usagef("-xsd '%v': xmllint failed: %v", xsd, msg)
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(&stderr)
+	for sc.Scan() {
+		m := xmllintError.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		r = append(r, violation{line: line, msg: m[2]})
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].line < r[j].line })
+	return r, nil
+}
+
+// rejects returns the violations that fall within the lines of rec,
+// noting as problems any earlier ones that were outside all records.
+// A line holding several records pins its violations on the first.
+func (p *parser) rejects(rec *Tag) (r []violation) {
+	sc := p.schema
+	end := rec.line
+	if rec.endTag != nil {
+		end = rec.endTag.line
+	}
+	for ; sc.next < len(sc.violations); sc.next++ {
+		v := sc.violations[sc.next]
+		if v.line > end {
+			break
+		}
+		if v.line < rec.line {
+			p.outsideRecords(v)
+			continue
+		}
+		r = append(r, v)
+	}
+	return
+}
+
+// outsideRecords reports v, which is not within any record,
+// so it can't be left out with one.
+func (p *parser) outsideRecords(v violation) {
+	if p.onProblem != nil {
+		p.onProblem(mark{line: v.line}, v.msg)
+		return
+	}
+	p.opts.warnf("warning: -xsd: line %v, outside any record: %v\n", v.line, v.msg)
+}
+
+// reject writes rec, after a comment listing its violations, to
+// opts.Rejects, or stderr. It reports the violations as problems
+// instead, for validate.
+func (p *parser) reject(rec *Tag, violations []violation) error {
+	if p.onProblem != nil {
+		for _, v := range violations {
+			p.onProblem(mark{line: v.line}, v.msg)
+		}
+		return nil
+	}
+	sc := p.schema
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- %v fails the schema:\n", rec.mark())
+	for _, v := range violations {
+		fmt.Fprintf(&b, "     line %v: %v\n", v.line, strings.ReplaceAll(v.msg, "--", "- -"))
+	}
+	b.WriteString("-->\n")
+
+	end := rec.endx
+	if rec.endTag != nil {
+		end = rec.endTag.endx
+	}
+	if p.sc.transcoded {
+		// our offsets are into the UTF-8 we decoded, not the file.
+		b.WriteString("<!-- not copied: the input is not in UTF-8 -->\n")
+	} else {
+		raw := make([]byte, end-rec.beg)
+		if _, err := sc.spool.ReadAt(raw, int64(rec.beg)); err != nil {
+			return err
+		}
+		b.Write(raw)
+		b.WriteString("\n")
+	}
+	w := p.opts.Rejects
+	if w == nil {
+		w = os.Stderr
+	}
+	_, err := io.WriteString(w, b.String())
+	sc.rejected++
+	return err
+}
+
+// schemaDone is called at the end of the input. It reports any
+// violations left after the last record, and removes the spool.
+func (p *parser) schemaDone() error {
+	sc := p.schema
+	for ; sc.next < len(sc.violations); sc.next++ {
+		p.outsideRecords(sc.violations[sc.next])
+	}
+	if sc.rejected > 0 {
+		p.opts.warnf("warning: left out %v records that fail the schema '%v'.\n", sc.rejected, p.opts.XSD)
+	}
+	p.schema = nil
+	return sc.spool.Close()
+}
+
+// withRejects returns opts, set to write the records that fail -xsd
+// beside the csv at outPath: for out.csv, to out.rejects.xml, which is
+// only created if there are any. For csv on stdout, they go to stderr.
+// Close the returned Closer when done.
+func withRejects(outPath string, opts *Options) (*Options, io.Closer) {
+	if opts.XSD == "" || opts.Rejects != nil || outPath == "" || outPath == "-" {
+		return opts, nopWriteCloser{}
+	}
+	base, _ := splitCsvExt(outPath)
+	rejects := &lazyOutput{path: base + ".rejects.xml", manifest: opts.manifest}
+	o := *opts
+	o.Rejects = rejects
+	return &o, rejects
+}
+
+// lazyOutput creates the output at path on the first write,
+// so that nothing is created if nothing is written.
+type lazyOutput struct {
+	path     string
+	manifest *manifest
+	w        io.WriteCloser
+}
+
+func (l *lazyOutput) Write(b []byte) (int, error) {
+	if l.w == nil {
+		w, err := createOutput(l.path, &Options{manifest: l.manifest})
+		if err != nil {
+			return 0, err
+		}
+		l.w = w
+	}
+	return l.w.Write(b)
+}
+
+func (l *lazyOutput) Close() error {
+	if l.w == nil {
+		return nil
+	}
+	return l.w.Close()
+}
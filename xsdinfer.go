@@ -0,0 +1,304 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// xml2csv schema -xsd infers an XML Schema from the XML: the one the
+// input itself would be valid against, describing each element, by
+// where it appears, with its children, how many of each it holds,
+// and in what order, its attributes, and the type of its text, as
+// -types-row infers it. Children that always come in the same order
+// make a sequence; otherwise a choice of any of them, repeated. The
+// schema's target namespace is the root element's; elements in other
+// namespaces are allowed where they were seen, but not described, and
+// attributes in any namespace, like xml:lang, are allowed anywhere.
+
+// xsdElement is what we saw of an element, at one place in the tree.
+type xsdElement struct {
+	name  string // local name
+	count int    // times seen
+
+	kids      []*xsdElement // in the order they come in
+	unordered bool          // ... if they do
+	foreign   bool          // has children in other namespaces
+	parents   int           // times seen in its parent
+	most      int           // most times seen in one parent
+
+	attrs        []*xsdAttr
+	foreignAttrs bool
+
+	withKids int  // times seen with children
+	mixed    bool // ... and text between them
+	nillable bool
+	text     xsdValues
+}
+
+// xsdAttr is what we saw of an attribute of an element.
+type xsdAttr struct {
+	name    string
+	present int
+	values  xsdValues
+}
+
+// xsdValues is what the values of some text were like.
+type xsdValues struct {
+	typ        string // as valueType says, "" if none yet
+	date, time bool   // dates without, and with, a time of day
+	exponent   bool   // decimals like 1e3
+	empty      bool   // some were empty
+}
+
+func (v *xsdValues) add(s string) {
+	if strings.TrimSpace(s) == "" {
+		v.empty = true
+		return
+	}
+	typ := valueType(s)
+	v.typ = widen(v.typ, typ)
+	switch typ {
+	case typeDate:
+		if len(s) > len("2006-01-02") {
+			v.time = true
+		} else {
+			v.date = true
+		}
+	case typeDecimal:
+		v.exponent = v.exponent || strings.ContainsAny(s, "eE")
+	}
+}
+
+// xsdType returns the XML Schema type that holds all the values.
+func (v *xsdValues) xsdType() string {
+	if v.empty {
+		return "xs:string"
+	}
+	switch v.typ {
+	case typeInteger:
+		return "xs:integer"
+	case typeDecimal:
+		if v.exponent {
+			return "xs:double"
+		}
+		return "xs:decimal"
+	case typeDate:
+		switch {
+		case v.date && v.time:
+			return "xs:string"
+		case v.time:
+			return "xs:dateTime"
+		}
+		return "xs:date"
+	}
+	return "xs:string"
+}
+
+// xsdInferrer walks the tree, resolving namespaces as it goes.
+type xsdInferrer struct {
+	target string              // the root's namespace
+	scopes []map[string]string // the namespaces declared, by prefix, root first
+}
+
+// inferXSD returns an XML Schema for the document whose root is tree.
+func inferXSD(tree *Tag) string {
+	x := &xsdInferrer{}
+	x.scopes = append(x.scopes, xmlns(tree))
+	x.target = x.namespace(tree.name)
+	root := &xsdElement{name: localName(tree.name)}
+	x.observe(root, tree)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"`)
+	if x.target != "" {
+		uri := html.EscapeString(x.target)
+		fmt.Fprintf(&b, ` targetNamespace="%v" xmlns="%v" elementFormDefault="qualified"`, uri, uri)
+	}
+	b.WriteString(">\n")
+	root.write(&b, "  ", "")
+	b.WriteString("</xs:schema>\n")
+	return b.String()
+}
+
+// namespace returns the URI of the namespace of name, in the current scope.
+func (x *xsdInferrer) namespace(name string) string {
+	prefix, _, ok := strings.Cut(name, ":")
+	if !ok {
+		prefix = ""
+	}
+	for i := len(x.scopes) - 1; i >= 0; i-- {
+		if uri, ok := x.scopes[i][prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+func localName(name string) string {
+	if _, local, ok := strings.Cut(name, ":"); ok {
+		return local
+	}
+	return name
+}
+
+// observe notes what t, an instance of e, is like.
+func (x *xsdInferrer) observe(e *xsdElement, t *Tag) {
+	e.count++
+	if t.isNil {
+		e.nillable = true
+	}
+	for _, a := range t.attrs() {
+		switch {
+		case a.name == "xmlns" || strings.HasPrefix(a.name, "xmlns:"):
+		case strings.Contains(a.name, ":"):
+			e.foreignAttrs = true
+		default:
+			e.attr(a.name).add(unescapeEntities(a.value))
+		}
+	}
+	if t.isSimple || t.firstChild == nil {
+		if !t.isNil {
+			e.text.add(t.content)
+		}
+		return
+	}
+
+	e.withKids++
+	if t.endTag != nil && strings.TrimSpace(t.endTag.pre) != "" {
+		e.mixed = true
+	}
+	// the children are in order if each comes at or after the one
+	// before it in e.kids, a new one going right after that one.
+	counts := make(map[*xsdElement]int)
+	prev := -1
+	for c := t.firstChild; c != nil; c = c.nextSib {
+		if strings.TrimSpace(c.pre) != "" {
+			e.mixed = true
+		}
+		x.scopes = append(x.scopes, xmlns(c))
+		if x.namespace(c.name) != x.target {
+			e.foreign = true
+			x.scopes = x.scopes[:len(x.scopes)-1]
+			continue
+		}
+		kid, i := e.kid(localName(c.name), prev)
+		if i < prev {
+			e.unordered = true
+		}
+		prev = i
+		counts[kid]++
+		x.observe(kid, c)
+		x.scopes = x.scopes[:len(x.scopes)-1]
+	}
+	for kid, n := range counts {
+		kid.parents++
+		if n > kid.most {
+			kid.most = n
+		}
+	}
+}
+
+// kid returns e's child element name, and where it is in e.kids,
+// adding it after the one at prev if it is new.
+func (e *xsdElement) kid(name string, prev int) (*xsdElement, int) {
+	for i, k := range e.kids {
+		if k.name == name {
+			return k, i
+		}
+	}
+	k := &xsdElement{name: name}
+	i := prev + 1
+	e.kids = append(e.kids[:i], append([]*xsdElement{k}, e.kids[i:]...)...)
+	return k, i
+}
+
+func (e *xsdElement) attr(name string) *xsdValues {
+	for _, a := range e.attrs {
+		if a.name == name {
+			a.present++
+			return &a.values
+		}
+	}
+	a := &xsdAttr{name: name, present: 1}
+	e.attrs = append(e.attrs, a)
+	return &a.values
+}
+
+// write writes the declaration of e, at indent, with occurs giving
+// its minOccurs and maxOccurs, if not the default of once.
+func (e *xsdElement) write(b *strings.Builder, indent, occurs string) {
+	fmt.Fprintf(b, `%v<xs:element name="%v"%v`, indent, e.name, occurs)
+	if e.nillable {
+		b.WriteString(` nillable="true"`)
+	}
+	if e.withKids == 0 && !e.foreign && len(e.attrs) == 0 && !e.foreignAttrs {
+		fmt.Fprintf(b, " type=\"%v\"/>\n", e.text.xsdType())
+		return
+	}
+	b.WriteString(">\n")
+	in := indent + "  "
+
+	if e.withKids == 0 && !e.foreign {
+		// text, with attributes.
+		fmt.Fprintf(b, "%v<xs:complexType>\n%v  <xs:simpleContent>\n", in, in)
+		fmt.Fprintf(b, "%v    <xs:extension base=\"%v\">\n", in, e.text.xsdType())
+		e.writeAttrs(b, in+"      ")
+		fmt.Fprintf(b, "%v    </xs:extension>\n%v  </xs:simpleContent>\n%v</xs:complexType>\n", in, in, in)
+		fmt.Fprintf(b, "%v</xs:element>\n", indent)
+		return
+	}
+
+	// the element sometimes holds just text, as mixed content does.
+	if e.mixed || e.text.typ != "" {
+		fmt.Fprintf(b, "%v<xs:complexType mixed=\"true\">\n", in)
+	} else {
+		fmt.Fprintf(b, "%v<xs:complexType>\n", in)
+	}
+	if e.unordered || e.foreign {
+		fmt.Fprintf(b, "%v  <xs:choice minOccurs=\"0\" maxOccurs=\"unbounded\">\n", in)
+		for _, k := range e.kids {
+			k.write(b, in+"    ", "")
+		}
+		if e.foreign {
+			fmt.Fprintf(b, "%v    <xs:any namespace=\"##other\" processContents=\"lax\"/>\n", in)
+		}
+		fmt.Fprintf(b, "%v  </xs:choice>\n", in)
+	} else if len(e.kids) > 0 {
+		fmt.Fprintf(b, "%v  <xs:sequence>\n", in)
+		for _, k := range e.kids {
+			k.write(b, in+"    ", k.occurs(e))
+		}
+		fmt.Fprintf(b, "%v  </xs:sequence>\n", in)
+	}
+	e.writeAttrs(b, in+"  ")
+	fmt.Fprintf(b, "%v</xs:complexType>\n%v</xs:element>\n", in, indent)
+}
+
+// occurs returns the minOccurs and maxOccurs of e in parent, as attributes.
+func (e *xsdElement) occurs(parent *xsdElement) (r string) {
+	if e.parents < parent.count {
+		r += ` minOccurs="0"`
+	}
+	if e.most > 1 {
+		r += ` maxOccurs="unbounded"`
+	}
+	return
+}
+
+func (e *xsdElement) writeAttrs(b *strings.Builder, indent string) {
+	for _, a := range e.attrs {
+		use := ""
+		if a.present == e.count {
+			use = ` use="required"`
+		}
+		fmt.Fprintf(b, "%v<xs:attribute name=\"%v\" type=\"%v\"%v/>\n", indent, a.name, a.values.xsdType(), use)
+	}
+	if e.foreignAttrs {
+		fmt.Fprintf(b, "%v<xs:anyAttribute namespace=\"##other\" processContents=\"lax\"/>\n", indent)
+	}
+}
@@ -0,0 +1,167 @@
+package xml2csv
+
+// Copyright (C) 2023, Jason E. Aten, Ph.D.
+// License: MIT; see LICENSE file.
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// inferred returns the XML Schema inferred from in.
+func inferred(t *testing.T, in string) string {
+	t.Helper()
+	d, err := parse(context.Background(), strings.NewReader(in), &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inferXSD(d.tree)
+}
+
+// Children in order make a sequence, with how many of each there are,
+// and out of order a choice; an element with text between its
+// children is mixed.
+func TestInferXSD(t *testing.T) {
+	in := `<lib>
+  <book id="1" lang="en"><title>A</title><author>Ann</author><author>Bob</author><price>1.5</price><at>2023-01-02T03:04:05Z</at></book>
+  <book id="2"><title>B</title><price>2</price><at>2023-01-02T03:04:05</at><day></day></book>
+  <mag><title>M</title><issue>3</issue></mag>
+  <mag><issue>4</issue><title>N</title><day>2023-01-02</day><day>2023-01-02T03:04:05</day></mag>
+  <note>some <b>bold</b> text</note>
+</lib>
+`
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="lib">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="book" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:sequence>
+              <xs:element name="title" type="xs:string"/>
+              <xs:element name="author" minOccurs="0" maxOccurs="unbounded" type="xs:string"/>
+              <xs:element name="price" type="xs:decimal"/>
+              <xs:element name="at" type="xs:dateTime"/>
+              <xs:element name="day" minOccurs="0" type="xs:string"/>
+            </xs:sequence>
+            <xs:attribute name="id" type="xs:integer" use="required"/>
+            <xs:attribute name="lang" type="xs:string"/>
+          </xs:complexType>
+        </xs:element>
+        <xs:element name="mag" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:choice minOccurs="0" maxOccurs="unbounded">
+              <xs:element name="title" type="xs:string"/>
+              <xs:element name="day" type="xs:string"/>
+              <xs:element name="issue" type="xs:integer"/>
+            </xs:choice>
+          </xs:complexType>
+        </xs:element>
+        <xs:element name="note">
+          <xs:complexType mixed="true">
+            <xs:sequence>
+              <xs:element name="b" type="xs:string"/>
+            </xs:sequence>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>
+`
+	if got := inferred(t, in); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+// The schema is of the root's namespace, and allows what is in others
+// where it was seen.
+func TestInferXSDNamespaces(t *testing.T) {
+	in := `<lib xmlns="urn:lib" xmlns:x="urn:x" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <book id="1" lang="en"><title>A</title><author>Ann</author><author>Bob</author><price>1.5</price><at>2023-01-02T03:04:05Z</at><x:note>n</x:note></book>
+  <book id="2"><title>B</title><price>2e3</price><at>2023-01-02T03:04:05</at><pages xsi:nil="true"/></book>
+  <mag><title>M</title><issue>3</issue></mag>
+  <mag><issue>4</issue><title>N</title><day>2023-01-02</day><day>2023-01-02T03:04:05</day></mag>
+  <note x:lang="en">some <b>bold</b> text</note>
+</lib>
+`
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:lib" xmlns="urn:lib" elementFormDefault="qualified">
+  <xs:element name="lib">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="book" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:choice minOccurs="0" maxOccurs="unbounded">
+              <xs:element name="title" type="xs:string"/>
+              <xs:element name="author" type="xs:string"/>
+              <xs:element name="price" type="xs:double"/>
+              <xs:element name="at" type="xs:dateTime"/>
+              <xs:element name="pages" nillable="true">
+                <xs:complexType>
+                  <xs:simpleContent>
+                    <xs:extension base="xs:string">
+                      <xs:anyAttribute namespace="##other" processContents="lax"/>
+                    </xs:extension>
+                  </xs:simpleContent>
+                </xs:complexType>
+              </xs:element>
+              <xs:any namespace="##other" processContents="lax"/>
+            </xs:choice>
+            <xs:attribute name="id" type="xs:integer" use="required"/>
+            <xs:attribute name="lang" type="xs:string"/>
+          </xs:complexType>
+        </xs:element>
+        <xs:element name="mag" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:choice minOccurs="0" maxOccurs="unbounded">
+              <xs:element name="title" type="xs:string"/>
+              <xs:element name="day" type="xs:string"/>
+              <xs:element name="issue" type="xs:integer"/>
+            </xs:choice>
+          </xs:complexType>
+        </xs:element>
+        <xs:element name="note">
+          <xs:complexType mixed="true">
+            <xs:sequence>
+              <xs:element name="b" type="xs:string"/>
+            </xs:sequence>
+            <xs:anyAttribute namespace="##other" processContents="lax"/>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>
+`
+	if got := inferred(t, in); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestXSDType(t *testing.T) {
+	for _, c := range []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"1", "-20"}, "xs:integer"},
+		{[]string{"1", "2.5"}, "xs:decimal"},
+		{[]string{"1.5", "2e3"}, "xs:double"},
+		{[]string{"2023-01-02"}, "xs:date"},
+		{[]string{"2023-01-02T03:04:05Z", "2023-01-02T03:04:05"}, "xs:dateTime"},
+		{[]string{"2023-01-02", "2023-01-02T03:04:05"}, "xs:string"},
+		{[]string{"1", ""}, "xs:string"},
+		{[]string{"1", "x"}, "xs:string"},
+		{[]string{"007"}, "xs:string"},
+		{nil, "xs:string"},
+	} {
+		var v xsdValues
+		for _, s := range c.values {
+			v.add(s)
+		}
+		if got := v.xsdType(); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.values, got, c.want)
+		}
+	}
+}